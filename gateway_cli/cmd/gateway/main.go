@@ -10,6 +10,7 @@ import (
 
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/server"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/version"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
 )
 
@@ -19,6 +20,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
 
 	// Initialize Redis client
 	redisClient, err := redis.NewClient(cfg.Redis)
@@ -31,12 +35,30 @@ func main() {
 	srv := server.New(cfg, redisClient)
 
 	go func() {
-		log.Printf("Gateway starting on port %s", cfg.Server.Port)
+		log.Printf("Gateway %s (%s) starting on port %s", version.Version, version.Commit, cfg.Server.Port)
 		if err := srv.Start(); err != nil {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
+	// Reload configuration on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			newCfg, err := config.Reload()
+			if err != nil {
+				log.Printf("Config reload failed: %v", err)
+				continue
+			}
+			if err := srv.Reload(newCfg); err != nil {
+				log.Printf("Config reload rejected, keeping current config: %v", err)
+				continue
+			}
+			log.Println("Config reloaded")
+		}
+	}()
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -1,27 +1,79 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/joho/godotenv"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/models"
 )
 
 type Config struct {
-	Server    ServerConfig
-	Redis     models.RedisConfig
-	Services  ServicesConfig
-	RateLimit RateLimitConfig
+	Server         ServerConfig
+	Redis          models.RedisConfig
+	Services       ServicesConfig
+	RateLimit      RateLimitConfig
+	Auth           AuthConfig
+	Outlier        OutlierConfig
+	HealthCheck    HealthCheckConfig
+	Metrics        MetricsConfig
+	Reload         ReloadConfig
+	Routes         RoutesConfig
+	Cache          CacheConfig
+	Features       FeatureFlagsConfig
+	CircuitBreaker CircuitBreakerConfig
+	Streaming      StreamingConfig
+	Retry          RetryConfig
+	Bulkhead       BulkheadConfig
+	Headers        ResponseHeadersConfig
+	Compression    CompressionConfig
+	Logging        LoggingConfig
+	CORS           CORSConfig
+	ServiceControl ServiceControlConfig
+	Idempotency    IdempotencyConfig
 }
 
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  int
-	WriteTimeout int
+	Port          string
+	ReadTimeout   int
+	WriteTimeout  int
+	PublicBaseURL string
+	// RequestBudgetSeconds bounds the whole request (auth, queue and upstream); 0 disables it
+	RequestBudgetSeconds int
+	RequestIDMode        string
+	// UpstreamOverrideCIDRs lists the client networks allowed to pin an
+	// upstream instance with X-Upstream-Target; empty disables the override
+	UpstreamOverrideCIDRs []string
+	// Body size limits in bytes, overridable per service; 0 disables a limit
+	MaxRequestBodyBytes  int64
+	MaxResponseBodyBytes int64
+	// ResponseMode is how buffered proxy responses are returned, overridable per route
+	ResponseMode string
 }
 
+// Handling of client-supplied X-Request-ID headers
+const (
+	RequestIDAccept   = "accept"   // use the client ID as-is
+	RequestIDValidate = "validate" // use the client ID only if it is well-formed
+	RequestIDGenerate = "generate" // always generate a fresh ID
+)
+
+// Proxy response modes
+const (
+	ResponseTransparent = "transparent" // relay the upstream status, headers and body
+	ResponseEnvelope    = "envelope"    // wrap the upstream body in the standard response envelope
+)
+
 type RedisConfig struct {
 	URL      string
 	Password string
@@ -30,49 +82,1028 @@ type RedisConfig struct {
 
 type ServicesConfig struct {
 	Registry map[string]ServiceInfo
+	// DisableDevDefaults starts with an empty registry instead of the localhost
+	// development services when SERVICES is unset
+	DisableDevDefaults bool
+	// Discovery selects where the registry comes from: static (SERVICES) or
+	// redis (heartbeat keys under DiscoveryPrefix, polled every DiscoveryPollSeconds)
+	Discovery            string
+	DiscoveryPrefix      string
+	DiscoveryPollSeconds int
 }
 
+// Service discovery modes
+const (
+	DiscoveryStatic = "static"
+	DiscoveryRedis  = "redis"
+)
+
 type ServiceInfo struct {
-	URL         string
-	HealthCheck string
-	Timeout     int
+	URL       string
+	Instances []string
+	// InstanceWeights holds the round-robin weight of each entry in Instances
+	InstanceWeights []int
+	HealthCheck     string
+	HealthPath      string
+	// HealthCheckInterval overrides HEALTH_CHECK_INTERVAL for this service, in seconds
+	HealthCheckInterval int
+	// DependsOn lists services that must be healthy for this one to be; while
+	// one is down, this service is reported unhealthy without being probed
+	DependsOn           []string
+	HealthHeaders       map[string]string
+	GRPCHealthService   string
+	Timeout             int
+	StartupGraceSeconds int
+	Critical            bool
+	StreamNDJSON        bool
+	CacheTTLSeconds     int
+	CachePerUser        bool
+	DisableKeepAlive    bool
+	MaxConcurrent       int
+	// Connection pool of the service's own transport; MaxConnsPerHost 0 = unlimited
+	MaxIdleConns           int
+	MaxIdleConnsPerHost    int
+	MaxConnsPerHost        int
+	IdleConnTimeoutSeconds int
+	DialTimeoutMs          int
+	// DegradedLatencyMs marks a passing health check slower than this as degraded, 0 = off
+	DegradedLatencyMs int
+	// CaptureBodies logs redacted request and response bodies for debugging
+	CaptureBodies bool
+	// RequiredRoles restricts proxying to users with one of these roles; empty = any user
+	RequiredRoles []string
+	// Restart targets: a container name (default: the service name) or a label
+	// selector key=value for the docker backend, a unit for systemd
+	Container      string
+	ContainerLabel string
+	SystemdUnit    string
+	// UpstreamEncoding is the Accept-Encoding sent upstream, gzip or identity
+	UpstreamEncoding string
+	// Body size limits overriding the server defaults, 0 = use the default
+	MaxRequestBodyBytes  int64
+	MaxResponseBodyBytes int64
+	Fallback             *FallbackResponse
+	StatusRemap          *StatusRemap
+	RetryOnBody          *RetryBodyTrigger
+	TLS                  *TLSConfig
+	Transform            *RequestTransform
+}
+
+// TLSConfig sets the verification policy for a single upstream, e.g. a private
+// CA, and the client certificate presented to upstreams requiring mutual TLS
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Build creates a tls.Config trusting only the configured CA bundle, if any,
+// and presenting the configured client certificate
+func (t *TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CAFile != "" {
+		caPEM, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// HealthCheckURL resolves the health endpoint. A relative HealthPath is joined to
+// the service URL so changing the base URL doesn't require updating the health URL.
+func (s ServiceInfo) HealthCheckURL() string {
+	if s.HealthPath != "" {
+		return strings.TrimRight(s.URL, "/") + "/" + strings.TrimLeft(s.HealthPath, "/")
+	}
+	return s.HealthCheck
+}
+
+// ForInstance returns a copy of the service info pointed at a single instance.
+// ok is false when the health check can't be derived for the instance, e.g.
+// because it targets an unrelated host.
+func (s ServiceInfo) ForInstance(instance string) (ServiceInfo, bool) {
+	info := s
+	info.URL = instance
+	if s.HealthPath != "" {
+		return info, true
+	}
+	if !strings.HasPrefix(s.HealthCheck, s.URL) {
+		return info, false
+	}
+	info.HealthCheck = instance + strings.TrimPrefix(s.HealthCheck, s.URL)
+	return info, true
+}
+
+// RequestTransform adapts requests for a legacy upstream before they are sent.
+// StripPrefix is removed from the path and PathPrefix prepended, so both
+// together rewrite one prefix into another. Headers in RenameHeaders are moved
+// to their new name, then SetHeaders are injected, replacing client values.
+type RequestTransform struct {
+	StripPrefix   string
+	PathPrefix    string
+	RenameHeaders map[string]string
+	SetHeaders    map[string]string
+}
+
+// StatusRemap turns 2xx JSON responses that report an error in their body into
+// a proper error status. Field is a dotted path into the body; its value is
+// looked up in Codes ("*" matches any other non-empty value), and numeric
+// values in the 4xx/5xx range are used as the status directly.
+type StatusRemap struct {
+	Field string
+	Codes map[string]int
+}
+
+// RetryBodyTrigger marks 2xx JSON responses as retryable when the dotted Field
+// in the body equals Value, for upstreams that report transient errors that way
+type RetryBodyTrigger struct {
+	Field string
+	Value string
+}
+
+// FallbackResponse is returned instead of a 502 when an optional service is down
+type FallbackResponse struct {
+	StatusCode  int
+	Body        string
+	ContentType string
 }
 
 type RateLimitConfig struct {
+	// Default limit, applied per client IP to requests matching no tier
 	RequestsPerMinute int
 	BurstSize         int
+	Tiers             []RateLimitTier
+	// Persist saves the buckets to Redis on shutdown and restores them on startup
+	Persist bool
+}
+
+// Rate limit tier scopes, checked in this order
+const (
+	TierScopePath = "path" // requests under a path prefix, whoever sends them
+	TierScopeRole = "role" // authenticated users with a role
+	TierScopeUser = "user" // any authenticated user
+)
+
+// RateLimitTier is a named limit for a class of requests. Authenticated
+// requests are counted per user, anonymous ones per client IP.
+type RateLimitTier struct {
+	Name              string
+	Scope             string
+	Match             string // path prefix or role
+	RequestsPerMinute int
+	BurstSize         int
+}
+
+// Missing user policies for protected routes without a resolved user
+const (
+	MissingUserForward   = "forward"   // proxy with an empty X-User-ID
+	MissingUserReject    = "reject"    // respond 401
+	MissingUserAnonymous = "anonymous" // proxy with X-User-ID: anonymous
+)
+
+// CORSConfig is the cross-origin policy. AllowedOrigins entries are "*", exact
+// origins or wildcard subdomains like https://*.example.com.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAgeSeconds    int
+}
+
+// ServiceControlConfig selects how the admin API restarts services. A restart
+// may take TimeoutSeconds, then the gateway waits up to HealthWaitSeconds for
+// the service to pass a health check. Docker Engine API calls are pinned to
+// DockerAPIVersion; DockerTLS, if set, secures a tcp:// or https:// host.
+type ServiceControlConfig struct {
+	Backend           string
+	DockerHost        string
+	DockerAPIVersion  string
+	DockerTLS         *TLSConfig
+	TimeoutSeconds    int
+	HealthWaitSeconds int
+}
+
+// IdempotencyConfig controls replay of POSTs sent with an Idempotency-Key. The
+// response is kept for TTLSeconds (0 disables the feature); a request arriving
+// while the first is in flight waits up to ClaimSeconds for its response. The
+// first request's claim lasts ClaimSeconds and is refreshed while it's in flight.
+type IdempotencyConfig struct {
+	TTLSeconds   int
+	ClaimSeconds int
+}
+
+// Service control backends
+const (
+	ServiceControlNone    = "none"
+	ServiceControlDocker  = "docker"
+	ServiceControlSystemd = "systemd"
+)
+
+// Console log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LoggingConfig configures the structured console log; LOG_LEVEL only governs
+// what is published to the Redis logs stream
+type LoggingConfig struct {
+	Level  string
+	Output string // stdout or stderr
+	Format string
+	// Bodies captured for services with CaptureBodies are cut to CaptureMaxBytes
+	// after masking the values of CaptureRedactFields (JSON keys, any case)
+	CaptureMaxBytes     int
+	CaptureRedactFields []string
+}
+
+type AuthConfig struct {
+	MissingUserPolicy string
+	// BypassPaths are protected paths served without a token, exact or as a
+	// prefix when ending in "*"
+	BypassPaths []string
+	// LocalFallback verifies tokens locally with JWTSecret when the auth service
+	// doesn't answer over Redis, so a brief auth outage doesn't fail every request
+	LocalFallback bool
+	JWTSecret     string
+	// TimeoutMs bounds the wait for the auth service's answer; sending the request
+	// is retried up to Retries times on transient Redis errors
+	TimeoutMs    int
+	Retries      int
+	RetryDelayMs int
+	// ResponseRetentionSeconds is how long answers stay in the auth-responses
+	// stream before the gateway trims them, and how long a consumer may stay
+	// idle before it's removed
+	ResponseRetentionSeconds int
+	// ConsumerGroup is this instance's group on the auth-responses stream and
+	// must be unique per gateway instance, as each instance needs every answer.
+	// Consumers is the number of named consumers reading through it.
+	ConsumerGroup string
+	Consumers     int
+	// RouteRoles restrict proxied paths to users with one of the listed roles,
+	// taking precedence over the target service's RequiredRoles
+	RouteRoles []RouteRoles
+}
+
+// RouteRoles lists the roles allowed on proxied routes under PathPrefix
+type RouteRoles struct {
+	PathPrefix string
+	Roles      []string
+}
+
+type HealthCheckConfig struct {
+	IntervalSeconds int
+	// Stagger spreads probes within a cycle across the interval instead of firing them together
+	Stagger bool
+	// Dedupe shares an in-flight probe between manual and scheduled checks of the same service
+	Dedupe bool
+	// MaxConcurrent bounds probes in flight across scheduled, manual and reload checks
+	MaxConcurrent int
+	// HistorySize results are kept per service; a service is flapping when its
+	// status changed at least FlapThreshold times within FlapWindowSeconds
+	HistorySize       int
+	FlapThreshold     int
+	FlapWindowSeconds int
+	Notify            HealthNotifyConfig
+}
+
+// HealthNotifyConfig configures notifications on healthy/unhealthy transitions.
+// A transition is only reported once it has held for DebounceSeconds, so a
+// flapping service doesn't cause an alert storm.
+type HealthNotifyConfig struct {
+	WebhookURL string
+	// PayloadTemplate is a text/template rendered with the transition; JSON by default
+	PayloadTemplate string
+	DebounceSeconds int
+}
+
+// BulkheadConfig sizes the wait queue of services with a concurrency limit
+// (SERVICE_<NAME>_MAX_CONCURRENT). QueuePerClient caps the slots one client may hold.
+type BulkheadConfig struct {
+	QueueSize      int
+	QueuePerClient int
+	QueueTimeoutMs int
+}
+
+// ResponseHeadersConfig caps the upstream response headers relayed to clients;
+// excess headers are dropped and the response is marked X-Gateway-Headers-Truncated
+type ResponseHeadersConfig struct {
+	MaxCount int
+	MaxBytes int
+}
+
+// Upstream content encodings the gateway asks for
+const (
+	EncodingGzip     = "gzip"     // request gzip and decompress in the gateway
+	EncodingIdentity = "identity" // request uncompressed bodies
+)
+
+// CompressionConfig controls gzip between the gateway and its clients. Upstream
+// negotiation is per service (SERVICE_<NAME>_UPSTREAM_ENCODING).
+type CompressionConfig struct {
+	// ClientGzip compresses buffered responses of at least ClientMinBytes for
+	// clients that accept gzip
+	ClientGzip     bool
+	ClientMinBytes int
+}
+
+// RetryConfig controls retries of idempotent requests on transport errors and 5xx.
+// MaxAttempts includes the first attempt; 1 disables retries.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelayMs int
+	MaxDelayMs  int
+}
+
+// StreamingConfig bounds memory used to relay streamed responses. A client that
+// can't accept a write within SlowClientTimeoutSeconds is disconnected.
+// Responses larger than BufferThresholdBytes are streamed instead of buffered.
+type StreamingConfig struct {
+	MaxBufferBytes           int
+	SlowClientTimeoutSeconds int
+	BufferThresholdBytes     int
+}
+
+// CircuitBreakerConfig controls per-service circuit breaking on consecutive failures
+type CircuitBreakerConfig struct {
+	Enabled          bool
+	FailureThreshold int
+	CooldownSeconds  int
+	HalfOpenProbes   int
+}
+
+// OutlierConfig controls latency-based ejection of slow upstream instances
+type OutlierConfig struct {
+	Enabled           bool
+	LatencyMultiplier float64
+	MinSamples        int
+	EjectionSeconds   int
+}
+
+type RoutesConfig struct {
+	Direct     []DirectRoute
+	BodyLimits []RouteBodyLimit
+	Links      []RouteLinks
+	Aggregates []AggregateRoute
+	Tombstones []RouteTombstone
+	Flush      []RouteFlushPolicy
+	Responses  []RouteResponseMode
+}
+
+// RouteResponseMode overrides the response mode for routes under PathPrefix
+type RouteResponseMode struct {
+	PathPrefix string
+	Mode       string
+}
+
+// Response flush policies
+const (
+	FlushBuffered  = "buffered"  // let the server flush when the handler returns
+	FlushImmediate = "immediate" // flush as soon as the response is written
+)
+
+// RouteFlushPolicy sets how responses under PathPrefix are flushed to the client
+type RouteFlushPolicy struct {
+	PathPrefix string
+	Policy     string
+}
+
+// RouteTombstone remembers successful DELETEs under PathPrefix for TTLSeconds so
+// a retried DELETE gets the original success instead of a 404
+type RouteTombstone struct {
+	PathPrefix string
+	TTLSeconds int
+}
+
+// DirectRoute proxies a public path under /api to a service. TargetPath is the
+// upstream path template, with {name} filled from the public path's variables;
+// empty forwards the public path as is. Public routes skip authentication.
+type DirectRoute struct {
+	Methods    []string
+	Path       string
+	Service    string
+	TargetPath string
+	Public     bool
+}
+
+// UpstreamPath expands TargetPath with the matched path variables, escaped
+func (r DirectRoute) UpstreamPath(vars map[string]string) string {
+	path := r.TargetPath
+	for name, value := range vars {
+		path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+	}
+	return path
+}
+
+// AggregateRoute fans a GET out to several services and combines the results.
+// Parts that don't answer within BudgetMillis are reported as timed out.
+type AggregateRoute struct {
+	Path         string
+	BudgetMillis int
+	Parts        []AggregatePart
+}
+
+// AggregatePart is one upstream call of an aggregate route, keyed by Name in the result
+type AggregatePart struct {
+	Name    string
+	Service string
+	Path    string
+}
+
+// RouteLinks enables _links injection into JSON responses for paths under PathPrefix.
+// Related maps link relation names to gateway paths.
+type RouteLinks struct {
+	PathPrefix string
+	Related    map[string]string
+}
+
+// RouteBodyLimit overrides the maximum request body size for paths under PathPrefix
+type RouteBodyLimit struct {
+	PathPrefix          string
+	MaxRequestBodyBytes int64
+}
+
+// CacheConfig bounds the upstream response cache. Caching is enabled per service
+// with SERVICE_<NAME>_CACHE_TTL.
+type CacheConfig struct {
+	MaxEntries int
+	// Requests carrying any of BypassHeaders skip the shared cache, unless the
+	// service keys its cache per user (SERVICE_<NAME>_CACHE_PER_USER)
+	BypassHeaders []string
+}
+
+// FeatureFlagsConfig is the static feature flag source. Flags from the user's
+// token claims are always honored in addition to these.
+type FeatureFlagsConfig struct {
+	Flags []FeatureFlag
+}
+
+// FeatureFlag enables Name for the listed user IDs, or for everyone if Users contains "*"
+type FeatureFlag struct {
+	Name  string
+	Users []string
+}
+
+// ReloadConfig controls validation of configuration reloads
+type ReloadConfig struct {
+	ProbeCritical bool
+}
+
+type MetricsConfig struct {
+	Labels []MetricLabel
+	// Latency percentiles are computed over the last LatencyWindowSize samples,
+	// ignoring samples older than LatencyWindowSeconds if set
+	LatencyWindowSize    int
+	LatencyWindowSeconds int
+	// TagHeader values are mapped to request tags through Tags (value -> tag);
+	// unmapped values are tagged "other"
+	TagHeader string
+	Tags      map[string]string
+}
+
+// MetricLabel maps a request header to a metric label with a bounded set of values.
+// Values outside AllowedValues are reported as "other" to keep cardinality bounded.
+type MetricLabel struct {
+	Name          string
+	Header        string
+	AllowedValues []string
 }
 
 func Load() (*Config, error) {
 	// Load .env file if exists
 	godotenv.Load()
 
+	return build()
+}
+
+// Reload re-reads the .env file, overriding previously loaded values, and
+// builds a fresh config. The result should be checked with Validate before use.
+func Reload() (*Config, error) {
+	godotenv.Overload()
+
+	return build()
+}
+
+func build() (*Config, error) {
+	disableDevDefaults := getEnvBool("DISABLE_DEV_DEFAULTS", false)
+
+	publicBaseURL := getEnv("GATEWAY_PUBLIC_URL", "")
+	if publicBaseURL != "" {
+		u, err := url.Parse(publicBaseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid GATEWAY_PUBLIC_URL %q: expected scheme://host[:port]", publicBaseURL)
+		}
+	}
+
 	return &Config{
 		Server: ServerConfig{
-			Port:         getEnv("GATEWAY_PORT", "8080"),
-			ReadTimeout:  getEnvInt("SERVER_READ_TIMEOUT", 10),
-			WriteTimeout: getEnvInt("SERVER_WRITE_TIMEOUT", 10),
+			Port:          getEnv("GATEWAY_PORT", "8080"),
+			ReadTimeout:   getEnvInt("SERVER_READ_TIMEOUT", 10),
+			WriteTimeout:  getEnvInt("SERVER_WRITE_TIMEOUT", 10),
+			PublicBaseURL: publicBaseURL,
+
+			RequestBudgetSeconds: getEnvInt("REQUEST_BUDGET_SECONDS", 0),
+			RequestIDMode:        getEnv("REQUEST_ID_MODE", RequestIDAccept),
+
+			UpstreamOverrideCIDRs: parseList(getEnv("UPSTREAM_OVERRIDE_TRUSTED_CIDRS", "")),
+
+			MaxRequestBodyBytes:  int64(getEnvInt("MAX_REQUEST_BODY_BYTES", 10<<20)),
+			MaxResponseBodyBytes: int64(getEnvInt("MAX_RESPONSE_BODY_BYTES", 0)),
+
+			ResponseMode: getEnv("RESPONSE_MODE", ResponseTransparent),
 		},
 		Redis: models.RedisConfig{
 			URL:      getEnv("REDIS_URL", "redis://localhost:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvInt("REDIS_DB", 0),
+
+			LogsStream:      getEnv("REDIS_LOGS_STREAM", "logs-stream"),
+			AccessLogStream: getEnv("REDIS_ACCESS_LOG_STREAM", "access-log-stream"),
+			MetricsStream:   getEnv("REDIS_METRICS_STREAM", "metrics-stream"),
+			LogLevel:        getEnv("LOG_LEVEL", "info"),
+
+			AuthRequestsStream:  getEnv("REDIS_AUTH_REQUESTS_STREAM", "auth-requests"),
+			AuthResponsesStream: getEnv("REDIS_AUTH_RESPONSES_STREAM", "auth-responses"),
+			StreamMaxLen:        int64(getEnvInt("REDIS_STREAM_MAX_LEN", 100000)),
+
+			FallbackURL:          getEnv("REDIS_FALLBACK_URL", ""),
+			FallbackRetrySeconds: getEnvInt("REDIS_FALLBACK_RETRY_SECONDS", 10),
 		},
 		Services: ServicesConfig{
-			Registry: parseServices(),
+			Registry:             parseServices(disableDevDefaults),
+			DisableDevDefaults:   disableDevDefaults,
+			Discovery:            getEnv("SERVICE_DISCOVERY", DiscoveryStatic),
+			DiscoveryPrefix:      getEnv("SERVICE_DISCOVERY_PREFIX", "gateway:discovery:"),
+			DiscoveryPollSeconds: getEnvInt("SERVICE_DISCOVERY_POLL_SECONDS", 10),
 		},
 		RateLimit: RateLimitConfig{
 			RequestsPerMinute: getEnvInt("RATE_LIMIT_RPM", 100),
 			BurstSize:         getEnvInt("RATE_LIMIT_BURST", 20),
+			Tiers:             parseRateLimitTiers(),
+			Persist:           getEnvBool("RATE_LIMIT_PERSIST", false),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   parseList(getEnv("CORS_ALLOWED_ORIGINS", "*")),
+			AllowedMethods:   parseList(getEnv("CORS_ALLOWED_METHODS", "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS")),
+			AllowedHeaders:   parseList(getEnv("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-Request-ID")),
+			ExposedHeaders:   parseList(getEnv("CORS_EXPOSED_HEADERS", "X-Request-ID,X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After")),
+			AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAgeSeconds:    getEnvInt("CORS_MAX_AGE_SECONDS", 86400),
+		},
+		ServiceControl: ServiceControlConfig{
+			Backend:           getEnv("SERVICE_CONTROL", ServiceControlNone),
+			DockerHost:        getEnv("SERVICE_CONTROL_DOCKER_HOST", "unix:///var/run/docker.sock"),
+			DockerAPIVersion:  getEnv("SERVICE_CONTROL_DOCKER_API_VERSION", "v1.41"),
+			DockerTLS:         parseDockerTLS(),
+			TimeoutSeconds:    getEnvInt("SERVICE_CONTROL_TIMEOUT", 30),
+			HealthWaitSeconds: getEnvInt("SERVICE_CONTROL_HEALTH_WAIT", 30),
+		},
+		Idempotency: IdempotencyConfig{
+			TTLSeconds:   getEnvInt("IDEMPOTENCY_TTL_SECONDS", 86400),
+			ClaimSeconds: getEnvInt("IDEMPOTENCY_CLAIM_SECONDS", 30),
+		},
+		Logging: LoggingConfig{
+			Level:  getEnv("CONSOLE_LOG_LEVEL", "info"),
+			Output: getEnv("CONSOLE_LOG_OUTPUT", "stdout"),
+			Format: getEnv("CONSOLE_LOG_FORMAT", LogFormatJSON),
+
+			CaptureMaxBytes:     getEnvInt("BODY_CAPTURE_MAX_BYTES", 4096),
+			CaptureRedactFields: parseList(getEnv("BODY_CAPTURE_REDACT", "password,token,access_token,refresh_token,secret,api_key,authorization")),
+		},
+		Auth: AuthConfig{
+			MissingUserPolicy:        getEnv("AUTH_MISSING_USER_POLICY", MissingUserForward),
+			BypassPaths:              parseList(getEnv("AUTH_BYPASS_PATHS", "")),
+			LocalFallback:            getEnvBool("AUTH_LOCAL_FALLBACK", false),
+			JWTSecret:                getEnv("JWT_SECRET", ""),
+			TimeoutMs:                getEnvInt("AUTH_TIMEOUT_MS", 5000),
+			Retries:                  getEnvInt("AUTH_RETRIES", 2),
+			RetryDelayMs:             getEnvInt("AUTH_RETRY_DELAY_MS", 100),
+			ResponseRetentionSeconds: getEnvInt("AUTH_RESPONSE_RETENTION_SECONDS", 300),
+			ConsumerGroup:            getEnv("AUTH_CONSUMER_GROUP", defaultAuthConsumerGroup()),
+			Consumers:                getEnvInt("AUTH_CONSUMERS", 4),
+			RouteRoles:               parseRouteRoles(),
+		},
+		Outlier: OutlierConfig{
+			Enabled:           getEnvBool("OUTLIER_DETECTION_ENABLED", false),
+			LatencyMultiplier: getEnvFloat("OUTLIER_LATENCY_MULTIPLIER", 3.0),
+			MinSamples:        getEnvInt("OUTLIER_MIN_SAMPLES", 10),
+			EjectionSeconds:   getEnvInt("OUTLIER_EJECTION_SECONDS", 30),
+		},
+		HealthCheck: HealthCheckConfig{
+			IntervalSeconds:   getEnvInt("HEALTH_CHECK_INTERVAL", 30),
+			Stagger:           getEnvBool("HEALTH_CHECK_STAGGER", false),
+			Dedupe:            getEnvBool("HEALTH_CHECK_DEDUPE", true),
+			MaxConcurrent:     getEnvInt("HEALTH_CHECK_MAX_CONCURRENT", 16),
+			HistorySize:       getEnvInt("HEALTH_HISTORY_SIZE", 50),
+			FlapThreshold:     getEnvInt("HEALTH_FLAP_THRESHOLD", 4),
+			FlapWindowSeconds: getEnvInt("HEALTH_FLAP_WINDOW", 600),
+			Notify: HealthNotifyConfig{
+				WebhookURL:      getEnv("HEALTH_WEBHOOK_URL", ""),
+				PayloadTemplate: getEnv("HEALTH_WEBHOOK_TEMPLATE", ""),
+				DebounceSeconds: getEnvInt("HEALTH_WEBHOOK_DEBOUNCE", 60),
+			},
+		},
+		Metrics: MetricsConfig{
+			Labels:               parseMetricLabels(),
+			LatencyWindowSize:    getEnvInt("METRICS_LATENCY_WINDOW", 1024),
+			LatencyWindowSeconds: getEnvInt("METRICS_LATENCY_WINDOW_SECONDS", 0),
+			TagHeader:            getEnv("REQUEST_TAG_HEADER", ""),
+			Tags:                 parseRequestTags(),
+		},
+		Reload: ReloadConfig{
+			ProbeCritical: getEnvBool("RELOAD_PROBE_CRITICAL", false),
+		},
+		Routes: RoutesConfig{
+			BodyLimits: parseRouteBodyLimits(),
+			Links:      parseRouteLinks(),
+			Direct:     parseDirectRoutes(),
+			Aggregates: parseAggregateRoutes(),
+			Tombstones: parseRouteTombstones(),
+			Flush:      parseRouteFlushPolicies(),
+			Responses:  parseRouteResponseModes(),
+		},
+		Cache: CacheConfig{
+			MaxEntries:    getEnvInt("RESPONSE_CACHE_MAX_ENTRIES", 1000),
+			BypassHeaders: parseList(getEnv("CACHE_BYPASS_HEADERS", "Authorization,Cookie")),
+		},
+		Features: FeatureFlagsConfig{
+			Flags: parseFeatureFlags(),
+		},
+		Bulkhead: BulkheadConfig{
+			QueueSize:      getEnvInt("BULKHEAD_QUEUE_SIZE", 50),
+			QueuePerClient: getEnvInt("BULKHEAD_QUEUE_PER_CLIENT", 5),
+			QueueTimeoutMs: getEnvInt("BULKHEAD_QUEUE_TIMEOUT_MS", 1000),
+		},
+		Headers: ResponseHeadersConfig{
+			MaxCount: getEnvInt("RESPONSE_MAX_HEADERS", 100),
+			MaxBytes: getEnvInt("RESPONSE_MAX_HEADER_BYTES", 32*1024),
+		},
+		Compression: CompressionConfig{
+			ClientGzip:     getEnvBool("COMPRESSION_CLIENT_GZIP", false),
+			ClientMinBytes: getEnvInt("COMPRESSION_CLIENT_MIN_BYTES", 1024),
+		},
+		Retry: RetryConfig{
+			MaxAttempts: getEnvInt("RETRY_MAX_ATTEMPTS", 1),
+			BaseDelayMs: getEnvInt("RETRY_BASE_DELAY_MS", 100),
+			MaxDelayMs:  getEnvInt("RETRY_MAX_DELAY_MS", 2000),
+		},
+		Streaming: StreamingConfig{
+			MaxBufferBytes:           getEnvInt("STREAM_MAX_BUFFER_BYTES", 64*1024),
+			SlowClientTimeoutSeconds: getEnvInt("STREAM_SLOW_CLIENT_TIMEOUT", 30),
+			BufferThresholdBytes:     getEnvInt("STREAM_BUFFER_THRESHOLD_BYTES", 4*1024*1024),
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Enabled:          getEnvBool("CIRCUIT_BREAKER_ENABLED", false),
+			FailureThreshold: getEnvInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5),
+			CooldownSeconds:  getEnvInt("CIRCUIT_BREAKER_COOLDOWN_SECONDS", 30),
+			HalfOpenProbes:   getEnvInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", 1),
 		},
 	}, nil
 }
 
-func parseServices() map[string]ServiceInfo {
+// Validate checks the config for semantic errors, returning all problems found
+func (c *Config) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateRegistry(c.Services.Registry)...)
+
+	for _, route := range c.Routes.Direct {
+		if !strings.HasPrefix(route.Path, "/") || (route.TargetPath != "" && !strings.HasPrefix(route.TargetPath, "/")) {
+			errs = append(errs, fmt.Errorf("direct route %s: paths must start with /", route.Path))
+		}
+		if len(route.Methods) == 0 || route.Service == "" {
+			errs = append(errs, fmt.Errorf("direct route %s: needs methods and a target service", route.Path))
+		}
+		for _, name := range pathVariables(route.TargetPath) {
+			if !slices.Contains(pathVariables(route.Path), name) {
+				errs = append(errs, fmt.Errorf("direct route %s: target path uses unknown variable %q", route.Path, name))
+			}
+		}
+	}
+
+	for _, route := range c.Routes.Aggregates {
+		if route.BudgetMillis <= 0 {
+			errs = append(errs, fmt.Errorf("aggregate route %s: budget must be positive", route.Path))
+		}
+	}
+
+	for _, route := range c.Routes.Flush {
+		if route.Policy != FlushBuffered && route.Policy != FlushImmediate {
+			errs = append(errs, fmt.Errorf("route %s: unknown flush policy %q", route.PathPrefix, route.Policy))
+		}
+	}
+
+	for _, route := range c.Routes.Responses {
+		if route.Mode != ResponseTransparent && route.Mode != ResponseEnvelope {
+			errs = append(errs, fmt.Errorf("route %s: unknown response mode %q", route.PathPrefix, route.Mode))
+		}
+	}
+
+	if c.Server.ResponseMode != ResponseTransparent && c.Server.ResponseMode != ResponseEnvelope {
+		errs = append(errs, fmt.Errorf("server: unknown response mode %q", c.Server.ResponseMode))
+	}
+
+	switch c.Server.RequestIDMode {
+	case RequestIDAccept, RequestIDValidate, RequestIDGenerate:
+	default:
+		errs = append(errs, fmt.Errorf("server: unknown request ID mode %q", c.Server.RequestIDMode))
+	}
+
+	for _, cidr := range c.Server.UpstreamOverrideCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			errs = append(errs, fmt.Errorf("server: invalid upstream override network %q", cidr))
+		}
+	}
+
+	if c.Server.RequestBudgetSeconds < 0 {
+		errs = append(errs, fmt.Errorf("server: request budget must not be negative"))
+	}
+
+	if c.Server.MaxRequestBodyBytes < 0 || c.Server.MaxResponseBodyBytes < 0 {
+		errs = append(errs, fmt.Errorf("server: body size limits must not be negative"))
+	}
+
+	if c.HealthCheck.MaxConcurrent <= 0 {
+		errs = append(errs, fmt.Errorf("health check: max concurrent probes must be positive"))
+	}
+
+	if c.Headers.MaxCount <= 0 || c.Headers.MaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("response headers: max count and max bytes must be positive"))
+	}
+
+	if c.RateLimit.RequestsPerMinute <= 0 || c.RateLimit.BurstSize <= 0 {
+		errs = append(errs, fmt.Errorf("rate limit: requests per minute and burst size must be positive"))
+	}
+	for _, tier := range c.RateLimit.Tiers {
+		if tier.RequestsPerMinute <= 0 || tier.BurstSize <= 0 {
+			errs = append(errs, fmt.Errorf("rate limit tier %s: requests per minute and burst size must be positive", tier.Name))
+		}
+		switch tier.Scope {
+		case TierScopeUser:
+		case TierScopePath, TierScopeRole:
+			if tier.Match == "" {
+				errs = append(errs, fmt.Errorf("rate limit tier %s: %s scope needs a value", tier.Name, tier.Scope))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("rate limit tier %s: unknown scope %q", tier.Name, tier.Scope))
+		}
+	}
+
+	switch c.Services.Discovery {
+	case DiscoveryStatic:
+	case DiscoveryRedis:
+		if c.Services.DiscoveryPrefix == "" || c.Services.DiscoveryPollSeconds <= 0 {
+			errs = append(errs, fmt.Errorf("service discovery: redis discovery needs a key prefix and a positive poll interval"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("service discovery: unknown mode %q", c.Services.Discovery))
+	}
+
+	switch c.ServiceControl.Backend {
+	case ServiceControlNone, ServiceControlSystemd:
+	case ServiceControlDocker:
+		if u, err := url.Parse(c.ServiceControl.DockerHost); err != nil || (u.Scheme != "unix" && u.Scheme != "tcp" && u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("service control: invalid docker host %q", c.ServiceControl.DockerHost))
+		}
+		if !validDockerAPIVersion(c.ServiceControl.DockerAPIVersion) {
+			errs = append(errs, fmt.Errorf("service control: invalid docker API version %q", c.ServiceControl.DockerAPIVersion))
+		}
+		if tlsCfg := c.ServiceControl.DockerTLS; tlsCfg != nil {
+			if _, err := tlsCfg.Build(); err != nil {
+				errs = append(errs, fmt.Errorf("service control: docker TLS: %w", err))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("service control: unknown backend %q", c.ServiceControl.Backend))
+	}
+	if c.ServiceControl.TimeoutSeconds <= 0 || c.ServiceControl.HealthWaitSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("service control: timeout and health wait must be positive"))
+	}
+	if c.Idempotency.TTLSeconds < 0 || c.Idempotency.ClaimSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("idempotency: ttl must not be negative and claim timeout must be positive"))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("cors: invalid allowed origin %q", origin))
+		}
+	}
+	if c.CORS.MaxAgeSeconds < 0 {
+		errs = append(errs, fmt.Errorf("cors: max age must not be negative"))
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("logging: unknown console log level %q", c.Logging.Level))
+	}
+	switch c.Logging.Output {
+	case "stdout", "stderr":
+	default:
+		errs = append(errs, fmt.Errorf("logging: console output must be stdout or stderr, got %q", c.Logging.Output))
+	}
+	switch c.Logging.Format {
+	case LogFormatJSON, LogFormatText:
+	default:
+		errs = append(errs, fmt.Errorf("logging: unknown console log format %q", c.Logging.Format))
+	}
+	if c.Logging.CaptureMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("logging: body capture size must be positive"))
+	}
+
+	switch c.Auth.MissingUserPolicy {
+	case MissingUserForward, MissingUserReject, MissingUserAnonymous:
+	default:
+		errs = append(errs, fmt.Errorf("auth: unknown missing user policy %q", c.Auth.MissingUserPolicy))
+	}
+
+	for _, route := range c.Auth.RouteRoles {
+		if len(route.Roles) == 0 {
+			errs = append(errs, fmt.Errorf("auth: route %s has no roles", route.PathPrefix))
+		}
+	}
+
+	if c.Auth.LocalFallback && c.Auth.JWTSecret == "" {
+		errs = append(errs, fmt.Errorf("auth: local fallback requires JWT_SECRET"))
+	}
+	if c.Auth.TimeoutMs <= 0 {
+		errs = append(errs, fmt.Errorf("auth: timeout must be positive"))
+	}
+	if c.Auth.Retries < 0 || c.Auth.RetryDelayMs < 0 {
+		errs = append(errs, fmt.Errorf("auth: retries and retry delay must not be negative"))
+	}
+	if c.Auth.ResponseRetentionSeconds*1000 <= c.Auth.TimeoutMs {
+		errs = append(errs, fmt.Errorf("auth: response retention must be longer than the auth timeout"))
+	}
+	if c.Auth.ConsumerGroup == "" || c.Auth.Consumers <= 0 {
+		errs = append(errs, fmt.Errorf("auth: consumer group must be set and consumers must be positive"))
+	}
+
+	if c.HealthCheck.HistorySize <= 0 || c.HealthCheck.FlapThreshold <= 0 || c.HealthCheck.FlapWindowSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("health check: history size, flap threshold and flap window must be positive"))
+	}
+	if c.HealthCheck.IntervalSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("health check: interval must be positive"))
+	}
+	if webhookURL := c.HealthCheck.Notify.WebhookURL; webhookURL != "" {
+		if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("health webhook: invalid URL %q", webhookURL))
+		}
+	}
+	if payload := c.HealthCheck.Notify.PayloadTemplate; payload != "" {
+		if _, err := template.New("payload").Parse(payload); err != nil {
+			errs = append(errs, fmt.Errorf("health webhook template: %w", err))
+		}
+	}
+
+	if c.Bulkhead.QueueSize < 0 || c.Bulkhead.QueuePerClient < 0 || c.Bulkhead.QueueTimeoutMs <= 0 {
+		errs = append(errs, fmt.Errorf("bulkhead: queue sizes must not be negative and queue timeout must be positive"))
+	}
+
+	if c.Retry.MaxAttempts < 1 || c.Retry.BaseDelayMs <= 0 || c.Retry.MaxDelayMs < c.Retry.BaseDelayMs {
+		errs = append(errs, fmt.Errorf("retry: max attempts must be at least 1 and delays positive with max >= base"))
+	}
+
+	if c.Streaming.MaxBufferBytes < 16 || c.Streaming.SlowClientTimeoutSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("streaming: buffer must be at least 16 bytes and slow client timeout positive"))
+	}
+	if c.Streaming.BufferThresholdBytes <= 0 {
+		errs = append(errs, fmt.Errorf("streaming: buffer threshold must be positive"))
+	}
+
+	if c.CircuitBreaker.Enabled && (c.CircuitBreaker.FailureThreshold <= 0 || c.CircuitBreaker.CooldownSeconds <= 0 || c.CircuitBreaker.HalfOpenProbes <= 0) {
+		errs = append(errs, fmt.Errorf("circuit breaker: threshold, cooldown and half-open probes must be positive"))
+	}
+
+	if c.Outlier.Enabled && c.Outlier.LatencyMultiplier <= 1 {
+		errs = append(errs, fmt.Errorf("outlier detection: latency multiplier must be greater than 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateRegistry checks a service registry on its own, as Validate does for
+// the configured one, e.g. after runtime registrations were merged into it
+func ValidateRegistry(registry map[string]ServiceInfo) error {
+	return errors.Join(validateRegistry(registry)...)
+}
+
+func validateRegistry(registry map[string]ServiceInfo) []error {
+	var errs []error
+
+	for name, info := range registry {
+		instances := info.Instances
+		if len(instances) == 0 {
+			instances = []string{info.URL}
+		}
+		for _, instance := range instances {
+			if err := validateServiceURL(instance); err != nil {
+				errs = append(errs, fmt.Errorf("service %s: %w", name, err))
+			}
+		}
+		if healthURL := info.HealthCheckURL(); healthURL != "" {
+			if err := validateServiceURL(healthURL); err != nil {
+				errs = append(errs, fmt.Errorf("service %s health check: %w", name, err))
+			}
+		}
+		if info.HealthCheckInterval < 0 {
+			errs = append(errs, fmt.Errorf("service %s: health check interval must not be negative", name))
+		}
+		if info.MaxIdleConns < 0 || info.MaxIdleConnsPerHost < 0 || info.MaxConnsPerHost < 0 || info.IdleConnTimeoutSeconds < 0 || info.DialTimeoutMs < 0 {
+			errs = append(errs, fmt.Errorf("service %s: connection pool settings must not be negative", name))
+		}
+		if info.DegradedLatencyMs < 0 {
+			errs = append(errs, fmt.Errorf("service %s: degraded latency threshold must not be negative", name))
+		}
+		for _, dependency := range info.DependsOn {
+			if _, exists := registry[dependency]; !exists {
+				errs = append(errs, fmt.Errorf("service %s: depends on unknown service %q", name, dependency))
+			}
+		}
+		if info.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("service %s: timeout must be positive", name))
+		}
+		if info.UpstreamEncoding != EncodingGzip && info.UpstreamEncoding != EncodingIdentity {
+			errs = append(errs, fmt.Errorf("service %s: unknown upstream encoding %q", name, info.UpstreamEncoding))
+		}
+		if info.TLS != nil {
+			if _, err := info.TLS.Build(); err != nil {
+				errs = append(errs, fmt.Errorf("service %s tls: %w", name, err))
+			}
+		}
+		if t := info.Transform; t != nil {
+			for _, prefix := range []string{t.StripPrefix, t.PathPrefix} {
+				if prefix != "" && !strings.HasPrefix(prefix, "/") {
+					errs = append(errs, fmt.Errorf("service %s transform: path prefix %q must start with /", name, prefix))
+				}
+			}
+		}
+		if info.StatusRemap != nil {
+			for value, code := range info.StatusRemap.Codes {
+				if code < 400 || code > 599 {
+					errs = append(errs, fmt.Errorf("service %s status map: %s maps to %d, want a 4xx or 5xx status", name, value, code))
+				}
+			}
+		}
+	}
+
+	if cycle := dependencyCycle(registry); cycle != "" {
+		errs = append(errs, fmt.Errorf("services: dependency cycle through %s", cycle))
+	}
+
+	return errs
+}
+
+func validateServiceURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "grpc") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: expected http(s)://host[:port] or grpc://host:port", rawURL)
+	}
+	return nil
+}
+
+func parseServices(disableDevDefaults bool) map[string]ServiceInfo {
 	services := make(map[string]ServiceInfo)
 
 	// Parse services from env: SERVICES=auth:http://localhost:8081,device-registry:http://localhost:8082
+	// Multiple instances of a service are separated by ';': analytics:http://a:8083;http://b:8083
 	servicesEnv := getEnv("SERVICES", "")
+	if servicesEnv == "" && disableDevDefaults {
+		return services
+	}
 	if servicesEnv == "" {
 		// Default services for development
 		services["auth"] = ServiceInfo{
@@ -90,25 +1121,678 @@ func parseServices() map[string]ServiceInfo {
 			HealthCheck: "http://localhost:8083/health",
 			Timeout:     5,
 		}
+		for name := range services {
+			services[name] = applyServiceOverrides(name, services[name])
+		}
 		return services
 	}
 
+	// Health options may follow the instances: auth:http://localhost:8081|health=/healthz|interval=5
 	for _, serviceStr := range strings.Split(servicesEnv, ",") {
+		serviceStr, options, _ := strings.Cut(serviceStr, "|")
 		parts := strings.Split(serviceStr, ":")
 		if len(parts) >= 3 {
 			name := parts[0]
-			url := strings.Join(parts[1:], ":")
-			services[name] = ServiceInfo{
-				URL:         url,
-				HealthCheck: url + "/health",
-				Timeout:     5,
+			instances, weights := parseInstances(strings.Join(parts[1:], ":"))
+			url := instances[0]
+			healthCheck := url + "/health"
+			if strings.HasPrefix(url, "grpc://") {
+				// gRPC backends are checked with grpc.health.v1 on the service address
+				healthCheck = url
+			}
+			info := ServiceInfo{
+				URL:             url,
+				Instances:       instances,
+				InstanceWeights: weights,
+				HealthCheck:     healthCheck,
+				Timeout:         5,
+			}
+			for _, option := range strings.Split(options, "|") {
+				key, value, _ := strings.Cut(option, "=")
+				switch strings.TrimSpace(key) {
+				case "health":
+					info.HealthPath = strings.TrimSpace(value)
+				case "interval":
+					info.HealthCheckInterval, _ = strconv.Atoi(strings.TrimSpace(value))
+				}
 			}
+			services[name] = applyServiceOverrides(name, info)
 		}
 	}
 
 	return services
 }
 
+// NewServiceInfo builds a single-instance service registered at runtime, with
+// the same defaults and SERVICE_<NAME>_* overrides as one listed in SERVICES
+func NewServiceInfo(name, url, healthCheck string, timeout int) ServiceInfo {
+	if healthCheck == "" {
+		healthCheck = url + "/health"
+		if strings.HasPrefix(url, "grpc://") {
+			healthCheck = url
+		}
+	}
+	if timeout <= 0 {
+		timeout = 5
+	}
+
+	return applyServiceOverrides(name, ServiceInfo{
+		URL:             url,
+		Instances:       []string{url},
+		InstanceWeights: []int{1},
+		HealthCheck:     healthCheck,
+		Timeout:         timeout,
+	})
+}
+
+// parseInstances splits a semicolon list of instance URLs, each with an
+// optional "@weight" suffix (default 1)
+func parseInstances(s string) ([]string, []int) {
+	var instances []string
+	var weights []int
+	for _, entry := range strings.Split(s, ";") {
+		weight := 1
+		if at := strings.LastIndex(entry, "@"); at != -1 {
+			if w, err := strconv.Atoi(entry[at+1:]); err == nil && w > 0 {
+				entry = entry[:at]
+				weight = w
+			}
+		}
+		instances = append(instances, entry)
+		weights = append(weights, weight)
+	}
+	return instances, weights
+}
+
+// parseList splits a comma-separated list, dropping empty entries
+func parseList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseRateLimitTiers() []RateLimitTier {
+	var tiers []RateLimitTier
+
+	// Parse tiers from env: RATE_LIMIT_TIERS=users|user|600|100,admins|role=admin|3000|500,analytics|path=/api/proxy/analytics|30|5
+	for _, tierStr := range strings.Split(getEnv("RATE_LIMIT_TIERS", ""), ",") {
+		parts := strings.Split(tierStr, "|")
+		if len(parts) != 4 {
+			continue
+		}
+		scope, match, _ := strings.Cut(strings.TrimSpace(parts[1]), "=")
+		rpm, _ := strconv.Atoi(strings.TrimSpace(parts[2]))
+		burst, _ := strconv.Atoi(strings.TrimSpace(parts[3]))
+		tiers = append(tiers, RateLimitTier{
+			Name:              strings.TrimSpace(parts[0]),
+			Scope:             scope,
+			Match:             match,
+			RequestsPerMinute: rpm,
+			BurstSize:         burst,
+		})
+	}
+
+	return tiers
+}
+
+func parseMetricLabels() []MetricLabel {
+	var labels []MetricLabel
+
+	// Parse labels from env: METRIC_LABELS=device_type:X-Device-Type:thermostat|camera,tenant:X-Tenant-ID:acme
+	for _, labelStr := range strings.Split(getEnv("METRIC_LABELS", ""), ",") {
+		parts := strings.Split(strings.TrimSpace(labelStr), ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		labels = append(labels, MetricLabel{
+			Name:          parts[0],
+			Header:        parts[1],
+			AllowedValues: strings.Split(parts[2], "|"),
+		})
+	}
+
+	return labels
+}
+
+func parseRequestTags() map[string]string {
+	tags := make(map[string]string)
+
+	// Parse tags from env: REQUEST_TAGS=ios-2:2.0.1|2.0.2,android-5:5.0.0 (tag:header values)
+	for _, tagStr := range strings.Split(getEnv("REQUEST_TAGS", ""), ",") {
+		tag, values, ok := strings.Cut(strings.TrimSpace(tagStr), ":")
+		if !ok || tag == "" {
+			continue
+		}
+		for _, value := range strings.Split(values, "|") {
+			if value = strings.TrimSpace(value); value != "" {
+				tags[value] = tag
+			}
+		}
+	}
+
+	return tags
+}
+
+func parseRouteBodyLimits() []RouteBodyLimit {
+	var limits []RouteBodyLimit
+
+	// Parse limits from env: ROUTE_MAX_BODY_BYTES=/api/proxy/analytics/upload:52428800,/api/devices:65536
+	for _, limitStr := range strings.Split(getEnv("ROUTE_MAX_BODY_BYTES", ""), ",") {
+		sep := strings.LastIndex(limitStr, ":")
+		if sep <= 0 {
+			continue
+		}
+		maxBytes, err := strconv.ParseInt(strings.TrimSpace(limitStr[sep+1:]), 10, 64)
+		if err != nil || maxBytes <= 0 {
+			continue
+		}
+		limits = append(limits, RouteBodyLimit{
+			PathPrefix:          strings.TrimSpace(limitStr[:sep]),
+			MaxRequestBodyBytes: maxBytes,
+		})
+	}
+
+	return limits
+}
+
+func parseRouteTombstones() []RouteTombstone {
+	var tombstones []RouteTombstone
+
+	// Parse tombstones from env: ROUTE_DELETE_TOMBSTONES=/api/devices:300,/api/proxy/automation/rules:60
+	for _, tombstoneStr := range strings.Split(getEnv("ROUTE_DELETE_TOMBSTONES", ""), ",") {
+		sep := strings.LastIndex(tombstoneStr, ":")
+		if sep <= 0 {
+			continue
+		}
+		ttl, err := strconv.Atoi(strings.TrimSpace(tombstoneStr[sep+1:]))
+		if err != nil || ttl <= 0 {
+			continue
+		}
+		tombstones = append(tombstones, RouteTombstone{
+			PathPrefix: strings.TrimSpace(tombstoneStr[:sep]),
+			TTLSeconds: ttl,
+		})
+	}
+
+	return tombstones
+}
+
+func parseRouteFlushPolicies() []RouteFlushPolicy {
+	var policies []RouteFlushPolicy
+
+	// Parse flush policies from env: ROUTE_FLUSH_POLICIES=/api/devices:immediate,/api/proxy/analytics:buffered
+	for _, policyStr := range strings.Split(getEnv("ROUTE_FLUSH_POLICIES", ""), ",") {
+		sep := strings.LastIndex(policyStr, ":")
+		if sep <= 0 {
+			continue
+		}
+		policies = append(policies, RouteFlushPolicy{
+			PathPrefix: strings.TrimSpace(policyStr[:sep]),
+			Policy:     strings.TrimSpace(policyStr[sep+1:]),
+		})
+	}
+
+	return policies
+}
+
+// parseDockerTLS reads the CA and client certificate for a TLS Docker host
+func parseDockerTLS() *TLSConfig {
+	caFile := getEnv("SERVICE_CONTROL_DOCKER_TLS_CA_FILE", "")
+	certFile := getEnv("SERVICE_CONTROL_DOCKER_TLS_CERT_FILE", "")
+	keyFile := getEnv("SERVICE_CONTROL_DOCKER_TLS_KEY_FILE", "")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil
+	}
+	return &TLSConfig{
+		CAFile:   caFile,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+}
+
+// validDockerAPIVersion accepts Engine API versions like v1.41 or 1.41
+func validDockerAPIVersion(version string) bool {
+	major, minor, ok := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	if !ok {
+		return false
+	}
+	_, majorErr := strconv.Atoi(major)
+	_, minorErr := strconv.Atoi(minor)
+	return majorErr == nil && minorErr == nil
+}
+
+func parseRouteRoles() []RouteRoles {
+	var routes []RouteRoles
+
+	// Parse route roles from env: AUTH_ROUTE_ROLES=/api/proxy/analytics:admin|analyst,/api/devices:admin
+	for _, routeStr := range parseList(getEnv("AUTH_ROUTE_ROLES", "")) {
+		sep := strings.LastIndex(routeStr, ":")
+		if sep <= 0 {
+			continue
+		}
+		var roles []string
+		for _, role := range strings.Split(routeStr[sep+1:], "|") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+		routes = append(routes, RouteRoles{
+			PathPrefix: strings.TrimSpace(routeStr[:sep]),
+			Roles:      roles,
+		})
+	}
+
+	return routes
+}
+
+func parseRouteResponseModes() []RouteResponseMode {
+	var modes []RouteResponseMode
+
+	// Parse response modes from env: ROUTE_RESPONSE_MODES=/api/devices:envelope,/api/proxy/camera:transparent
+	for _, modeStr := range strings.Split(getEnv("ROUTE_RESPONSE_MODES", ""), ",") {
+		sep := strings.LastIndex(modeStr, ":")
+		if sep <= 0 {
+			continue
+		}
+		modes = append(modes, RouteResponseMode{
+			PathPrefix: strings.TrimSpace(modeStr[:sep]),
+			Mode:       strings.TrimSpace(modeStr[sep+1:]),
+		})
+	}
+
+	return modes
+}
+
+func parseRouteLinks() []RouteLinks {
+	var routes []RouteLinks
+
+	// Parse link routes from env: ROUTE_LINKS=/api/devices|health=/api/health/device-registry,/api/services
+	for _, routeStr := range strings.Split(getEnv("ROUTE_LINKS", ""), ",") {
+		parts := strings.Split(strings.TrimSpace(routeStr), "|")
+		if parts[0] == "" {
+			continue
+		}
+		route := RouteLinks{
+			PathPrefix: parts[0],
+			Related:    make(map[string]string),
+		}
+		for _, rel := range parts[1:] {
+			if name, href, ok := strings.Cut(rel, "="); ok && name != "" {
+				route.Related[name] = href
+			}
+		}
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// Default direct routes, used while ROUTE_DIRECT is unset
+const defaultDirectRoutes = "public POST /auth/login=auth:/login," +
+	"public POST /auth/refresh=auth:/refresh," +
+	"GET|HEAD|POST|OPTIONS /devices=device-registry," +
+	"GET|HEAD|PUT|PATCH|DELETE|OPTIONS /devices/{id}=device-registry"
+
+func parseDirectRoutes() []DirectRoute {
+	var routes []DirectRoute
+
+	// Parse routes from env: ROUTE_DIRECT=[public ]METHOD|METHOD /path=service[:/target/{var}]
+	for _, routeStr := range parseList(getEnv("ROUTE_DIRECT", defaultDirectRoutes)) {
+		public, target, ok := strings.Cut(routeStr, "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(public)
+		route := DirectRoute{}
+		if len(fields) == 3 && fields[0] == "public" {
+			route.Public = true
+			fields = fields[1:]
+		}
+		if len(fields) != 2 {
+			continue
+		}
+		route.Methods = strings.Split(strings.ToUpper(fields[0]), "|")
+		route.Path = fields[1]
+		route.Service, route.TargetPath, _ = strings.Cut(strings.TrimSpace(target), ":")
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// pathVariables returns the names of the {name} or {name:pattern} variables in a path template
+func pathVariables(template string) []string {
+	var names []string
+	for {
+		start := strings.Index(template, "{")
+		end := strings.Index(template, "}")
+		if start < 0 || end < start {
+			return names
+		}
+		name, _, _ := strings.Cut(template[start+1:end], ":")
+		names = append(names, name)
+		template = template[end+1:]
+	}
+}
+
+func parseAggregateRoutes() []AggregateRoute {
+	var routes []AggregateRoute
+	defaultBudget := getEnvInt("AGGREGATE_BUDGET_MS", 2000)
+
+	// Parse aggregates from env: ROUTE_AGGREGATES=/dashboard|1500|devices=device-registry:/devices|stats=analytics:/stats
+	// The budget is optional: /dashboard|devices=device-registry:/devices
+	for _, routeStr := range strings.Split(getEnv("ROUTE_AGGREGATES", ""), ",") {
+		parts := strings.Split(strings.TrimSpace(routeStr), "|")
+		if parts[0] == "" || len(parts) < 2 {
+			continue
+		}
+		route := AggregateRoute{
+			Path:         parts[0],
+			BudgetMillis: defaultBudget,
+		}
+		for _, part := range parts[1:] {
+			if budget, err := strconv.Atoi(part); err == nil {
+				route.BudgetMillis = budget
+				continue
+			}
+			name, target, ok := strings.Cut(part, "=")
+			if !ok || name == "" {
+				continue
+			}
+			service, path, ok := strings.Cut(target, ":")
+			if !ok || service == "" {
+				continue
+			}
+			route.Parts = append(route.Parts, AggregatePart{
+				Name:    name,
+				Service: service,
+				Path:    path,
+			})
+		}
+		if len(route.Parts) > 0 {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes
+}
+
+func parseFeatureFlags() []FeatureFlag {
+	var flags []FeatureFlag
+
+	// Parse flags from env: FEATURE_FLAGS=new-dashboard:*,beta-thermostat:user-1|user-2
+	for _, flagStr := range strings.Split(getEnv("FEATURE_FLAGS", ""), ",") {
+		name, users, ok := strings.Cut(strings.TrimSpace(flagStr), ":")
+		if !ok || name == "" || users == "" {
+			continue
+		}
+		flags = append(flags, FeatureFlag{
+			Name:  name,
+			Users: strings.Split(users, "|"),
+		})
+	}
+
+	return flags
+}
+
+// LinksFor returns the link config of the longest configured prefix matching path
+func (c RoutesConfig) LinksFor(path string) (RouteLinks, bool) {
+	var match RouteLinks
+	found := false
+	for _, route := range c.Links {
+		if strings.HasPrefix(path, route.PathPrefix) && (!found || len(route.PathPrefix) > len(match.PathPrefix)) {
+			match = route
+			found = true
+		}
+	}
+	return match, found
+}
+
+// BodyLimitFor returns the body limit of the longest configured prefix matching path, or 0 if none
+func (c RoutesConfig) BodyLimitFor(path string) int64 {
+	var limit int64
+	longest := -1
+	for _, route := range c.BodyLimits {
+		if strings.HasPrefix(path, route.PathPrefix) && len(route.PathPrefix) > longest {
+			limit = route.MaxRequestBodyBytes
+			longest = len(route.PathPrefix)
+		}
+	}
+	return limit
+}
+
+// TombstoneTTLFor returns the DELETE tombstone TTL of the longest configured prefix matching path, or 0 if none
+func (c RoutesConfig) TombstoneTTLFor(path string) int {
+	ttl := 0
+	longest := -1
+	for _, route := range c.Tombstones {
+		if strings.HasPrefix(path, route.PathPrefix) && len(route.PathPrefix) > longest {
+			ttl = route.TTLSeconds
+			longest = len(route.PathPrefix)
+		}
+	}
+	return ttl
+}
+
+// FlushPolicyFor returns the flush policy of the longest matching route prefix,
+// defaulting to buffered
+func (c RoutesConfig) FlushPolicyFor(path string) string {
+	policy := FlushBuffered
+	longest := -1
+	for _, route := range c.Flush {
+		if strings.HasPrefix(path, route.PathPrefix) && len(route.PathPrefix) > longest {
+			policy = route.Policy
+			longest = len(route.PathPrefix)
+		}
+	}
+	return policy
+}
+
+// RolesFor returns the roles allowed by the longest matching route prefix, or
+// nil when no route rule applies
+func (c AuthConfig) RolesFor(path string) []string {
+	var roles []string
+	longest := -1
+	for _, route := range c.RouteRoles {
+		if strings.HasPrefix(path, route.PathPrefix) && len(route.PathPrefix) > longest {
+			roles = route.Roles
+			longest = len(route.PathPrefix)
+		}
+	}
+	return roles
+}
+
+// ResponseModeFor returns the response mode of the longest matching route
+// prefix, or fallback when no route sets one
+func (c RoutesConfig) ResponseModeFor(path, fallback string) string {
+	mode := fallback
+	longest := -1
+	for _, route := range c.Responses {
+		if strings.HasPrefix(path, route.PathPrefix) && len(route.PathPrefix) > longest {
+			mode = route.Mode
+			longest = len(route.PathPrefix)
+		}
+	}
+	return mode
+}
+
+// dependencyCycle returns a service on a DependsOn cycle, or "" if there is none
+func dependencyCycle(registry map[string]ServiceInfo) string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(registry))
+
+	var visit func(name string) string
+	visit = func(name string) string {
+		switch state[name] {
+		case visiting:
+			return name
+		case done:
+			return ""
+		}
+		state[name] = visiting
+		if info, exists := registry[name]; exists {
+			for _, dependency := range info.DependsOn {
+				if cycle := visit(dependency); cycle != "" {
+					return cycle
+				}
+			}
+		}
+		state[name] = done
+		return ""
+	}
+
+	for name := range registry {
+		if cycle := visit(name); cycle != "" {
+			return cycle
+		}
+	}
+	return ""
+}
+
+// applyServiceOverrides reads per-service settings from SERVICE_<NAME>_<KEY> env vars,
+// e.g. SERVICE_DEVICE_REGISTRY_FALLBACK_BODY for the device-registry service
+func applyServiceOverrides(name string, info ServiceInfo) ServiceInfo {
+	prefix := "SERVICE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+	info.Critical = getEnvBool(prefix+"CRITICAL", false)
+	info.StartupGraceSeconds = getEnvInt(prefix+"STARTUP_GRACE", getEnvInt("HEALTH_CHECK_STARTUP_GRACE", 0))
+	info.DegradedLatencyMs = getEnvInt(prefix+"DEGRADED_LATENCY_MS", getEnvInt("HEALTH_DEGRADED_LATENCY_MS", 0))
+	info.CaptureBodies = getEnvBool(prefix+"CAPTURE_BODIES", getEnvBool("BODY_CAPTURE", false))
+	info.RequiredRoles = parseList(getEnv(prefix+"REQUIRED_ROLES", ""))
+	info.Container = getEnv(prefix+"CONTAINER", "")
+	info.ContainerLabel = getEnv(prefix+"CONTAINER_LABEL", "")
+	info.SystemdUnit = getEnv(prefix+"SYSTEMD_UNIT", "")
+	info.StreamNDJSON = getEnvBool(prefix+"NDJSON", false)
+	info.CacheTTLSeconds = getEnvInt(prefix+"CACHE_TTL", 0)
+	info.CachePerUser = getEnvBool(prefix+"CACHE_PER_USER", false)
+	info.DisableKeepAlive = getEnvBool(prefix+"DISABLE_KEEPALIVE", false)
+	info.MaxConcurrent = getEnvInt(prefix+"MAX_CONCURRENT", 0)
+	info.MaxIdleConns = getEnvInt(prefix+"MAX_IDLE_CONNS", getEnvInt("UPSTREAM_MAX_IDLE_CONNS", 100))
+	info.MaxIdleConnsPerHost = getEnvInt(prefix+"MAX_IDLE_CONNS_PER_HOST", getEnvInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 10))
+	info.MaxConnsPerHost = getEnvInt(prefix+"MAX_CONNS_PER_HOST", getEnvInt("UPSTREAM_MAX_CONNS_PER_HOST", 0))
+	info.IdleConnTimeoutSeconds = getEnvInt(prefix+"IDLE_CONN_TIMEOUT", getEnvInt("UPSTREAM_IDLE_CONN_TIMEOUT", 90))
+	info.DialTimeoutMs = getEnvInt(prefix+"DIAL_TIMEOUT_MS", getEnvInt("UPSTREAM_DIAL_TIMEOUT_MS", 5000))
+	info.UpstreamEncoding = getEnv(prefix+"UPSTREAM_ENCODING", getEnv("UPSTREAM_ACCEPT_ENCODING", EncodingGzip))
+	info.MaxRequestBodyBytes = int64(getEnvInt(prefix+"MAX_REQUEST_BODY_BYTES", 0))
+	info.MaxResponseBodyBytes = int64(getEnvInt(prefix+"MAX_RESPONSE_BODY_BYTES", 0))
+
+	// Per-upstream TLS verification
+	caFile := getEnv(prefix+"TLS_CA_FILE", "")
+	certFile := getEnv(prefix+"TLS_CERT_FILE", "")
+	keyFile := getEnv(prefix+"TLS_KEY_FILE", "")
+	serverName := getEnv(prefix+"TLS_SERVER_NAME", "")
+	insecure := getEnvBool(prefix+"TLS_INSECURE_SKIP_VERIFY", false)
+	if caFile != "" || certFile != "" || keyFile != "" || serverName != "" || insecure {
+		info.TLS = &TLSConfig{
+			CAFile:             caFile,
+			CertFile:           certFile,
+			KeyFile:            keyFile,
+			ServerName:         serverName,
+			InsecureSkipVerify: insecure,
+		}
+	}
+
+	// Health check: relative path plus optional headers and static bearer token
+	info.HealthPath = getEnv(prefix+"HEALTH_PATH", info.HealthPath)
+	info.HealthCheckInterval = getEnvInt(prefix+"HEALTH_INTERVAL", info.HealthCheckInterval)
+	info.DependsOn = parseList(getEnv(prefix+"DEPENDS_ON", ""))
+	info.GRPCHealthService = getEnv(prefix+"GRPC_HEALTH_SERVICE", "")
+	for _, header := range strings.Split(getEnv(prefix+"HEALTH_HEADERS", ""), ",") {
+		if key, value, ok := strings.Cut(header, ":"); ok && strings.TrimSpace(key) != "" {
+			if info.HealthHeaders == nil {
+				info.HealthHeaders = make(map[string]string)
+			}
+			info.HealthHeaders[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if token := getEnv(prefix+"HEALTH_TOKEN", ""); token != "" {
+		if info.HealthHeaders == nil {
+			info.HealthHeaders = make(map[string]string)
+		}
+		info.HealthHeaders["Authorization"] = "Bearer " + token
+	}
+
+	// Status normalization: SERVICE_X_STATUS_FIELD=error.code, SERVICE_X_STATUS_MAP=NOT_FOUND:404,*:500
+	if field := getEnv(prefix+"STATUS_FIELD", ""); field != "" {
+		codes := make(map[string]int)
+		for _, entry := range strings.Split(getEnv(prefix+"STATUS_MAP", ""), ",") {
+			sep := strings.LastIndex(entry, ":")
+			if sep <= 0 {
+				continue
+			}
+			if code, err := strconv.Atoi(strings.TrimSpace(entry[sep+1:])); err == nil {
+				codes[strings.TrimSpace(entry[:sep])] = code
+			}
+		}
+		info.StatusRemap = &StatusRemap{
+			Field: field,
+			Codes: codes,
+		}
+	}
+
+	// Request rewrites: SERVICE_X_STRIP_PREFIX=/v1, SERVICE_X_PATH_PREFIX=/legacy,
+	// SERVICE_X_RENAME_HEADERS=X-Api-Token:X-Legacy-Key, SERVICE_X_SET_HEADERS=X-Api-Key:secret
+	transform := RequestTransform{
+		StripPrefix:   strings.TrimSuffix(getEnv(prefix+"STRIP_PREFIX", ""), "/"),
+		PathPrefix:    strings.TrimSuffix(getEnv(prefix+"PATH_PREFIX", ""), "/"),
+		RenameHeaders: parseHeaderPairs(getEnv(prefix+"RENAME_HEADERS", "")),
+		SetHeaders:    parseHeaderPairs(getEnv(prefix+"SET_HEADERS", "")),
+	}
+	if transform.StripPrefix != "" || transform.PathPrefix != "" || transform.RenameHeaders != nil || transform.SetHeaders != nil {
+		info.Transform = &transform
+	}
+
+	// Body-based retries: SERVICE_X_RETRY_BODY_FIELD=retryable, SERVICE_X_RETRY_BODY_VALUE=true
+	if field := getEnv(prefix+"RETRY_BODY_FIELD", ""); field != "" {
+		info.RetryOnBody = &RetryBodyTrigger{
+			Field: field,
+			Value: getEnv(prefix+"RETRY_BODY_VALUE", "true"),
+		}
+	}
+
+	if body := getEnv(prefix+"FALLBACK_BODY", ""); body != "" {
+		info.Fallback = &FallbackResponse{
+			StatusCode:  getEnvInt(prefix+"FALLBACK_STATUS", 200),
+			Body:        body,
+			ContentType: getEnv(prefix+"FALLBACK_CONTENT_TYPE", "application/json"),
+		}
+	}
+
+	return info
+}
+
+// parseHeaderPairs parses comma-separated Name:value pairs, canonicalizing the
+// names. It returns nil when there are none.
+func parseHeaderPairs(value string) map[string]string {
+	var pairs map[string]string
+	for _, entry := range strings.Split(value, ",") {
+		if key, val, ok := strings.Cut(entry, ":"); ok && strings.TrimSpace(key) != "" {
+			if pairs == nil {
+				pairs = make(map[string]string)
+			}
+			pairs[http.CanonicalHeaderKey(strings.TrimSpace(key))] = strings.TrimSpace(val)
+		}
+	}
+	return pairs
+}
+
+// defaultAuthConsumerGroup names this instance's auth-responses group after
+// the host, which is unique per gateway container
+func defaultAuthConsumerGroup() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "gateway"
+	}
+	return "gateway-auth:" + hostname
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -124,3 +1808,21 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
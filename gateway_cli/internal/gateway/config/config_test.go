@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadDefaultsValidate(t *testing.T) {
+	cfg, err := build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config should validate: %v", err)
+	}
+}
+
+func TestValidateRegistryRejectsCycles(t *testing.T) {
+	scenes := NewServiceInfo("scenes", "http://scenes:8080", "", 5)
+	scenes.DependsOn = []string{"automation"}
+	automation := NewServiceInfo("automation", "http://automation:8080", "", 5)
+	automation.DependsOn = []string{"scenes"}
+
+	err := ValidateRegistry(map[string]ServiceInfo{"scenes": scenes, "automation": automation})
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Fatalf("err = %v, want a dependency cycle", err)
+	}
+
+	automation.DependsOn = nil
+	if err := ValidateRegistry(map[string]ServiceInfo{"scenes": scenes, "automation": automation}); err != nil {
+		t.Fatalf("acyclic registry rejected: %v", err)
+	}
+}
+
+func TestValidateRejectsUnsafeStartupValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "local fallback without secret",
+			env:  map[string]string{"AUTH_LOCAL_FALLBACK": "true", "JWT_SECRET": ""},
+			want: "JWT_SECRET",
+		},
+		{
+			name: "no auth consumers",
+			env:  map[string]string{"AUTH_CONSUMERS": "0"},
+			want: "consumers",
+		},
+		{
+			name: "bad docker API version",
+			env:  map[string]string{"SERVICE_CONTROL": "docker", "SERVICE_CONTROL_DOCKER_API_VERSION": "latest"},
+			want: "docker API version",
+		},
+		{
+			name: "docker TLS key without certificate",
+			env:  map[string]string{"SERVICE_CONTROL": "docker", "SERVICE_CONTROL_DOCKER_TLS_KEY_FILE": "/tmp/key.pem"},
+			want: "docker TLS",
+		},
+		{
+			name: "empty health history",
+			env:  map[string]string{"HEALTH_HISTORY_SIZE": "0"},
+			want: "health",
+		},
+		{
+			name: "negative health history",
+			env:  map[string]string{"HEALTH_HISTORY_SIZE": "-1"},
+			want: "health",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := build()
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			err = cfg.Validate()
+			if err == nil {
+				t.Fatal("expected a validation error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// userEchoUpstream answers with the user it was called for and counts calls
+func userEchoUpstream(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user":"` + r.Header.Get("X-User-ID") + `"}`))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, &calls
+}
+
+func TestCredentialedRequestsBypassSharedCache(t *testing.T) {
+	upstream, calls := userEchoUpstream(t)
+	h := newTestHandlerWith(t, upstream.URL, withService(func(info *config.ServiceInfo) {
+		info.CacheTTLSeconds = 60
+	}))
+
+	for i := 0; i < 2; i++ {
+		if rec := proxyAs(h, "", http.MethodGet, "/api/proxy/devices/devices", nil); rec.Code != http.StatusOK {
+			t.Fatalf("anonymous request %d: status = %d", i, rec.Code)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("upstream calls = %d for two anonymous requests, want 1 with the second cached", calls.Load())
+	}
+
+	authorized := http.Header{"Authorization": []string{"Bearer token-a"}}
+	for i := 0; i < 2; i++ {
+		rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", authorized)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("authorized request %d: status = %d", i, rec.Code)
+		}
+		if rec.Body.String() != `{"user":"user-a"}` {
+			t.Fatalf("authorized request %d got %s, want its own response", i, rec.Body)
+		}
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("upstream calls = %d, want both authorized requests forwarded", calls.Load())
+	}
+
+	// Nor did they replace the shared entry
+	if rec := proxyAs(h, "", http.MethodGet, "/api/proxy/devices/devices", nil); rec.Body.String() != `{"user":""}` || calls.Load() != 3 {
+		t.Fatalf("shared entry = %s after %d calls, want the anonymous response from cache", rec.Body, calls.Load())
+	}
+}
+
+func TestPerUserCacheIgnoresClaimedUser(t *testing.T) {
+	upstream, calls := userEchoUpstream(t)
+	h := newTestHandlerWith(t, upstream.URL, withService(func(info *config.ServiceInfo) {
+		info.CacheTTLSeconds = 60
+		info.CachePerUser = true
+	}))
+
+	if rec := proxyAs(h, "victim", http.MethodGet, "/api/proxy/devices/devices", nil); rec.Body.String() != `{"user":"victim"}` {
+		t.Fatalf("victim got %s", rec.Body)
+	}
+	if rec := proxyAs(h, "victim", http.MethodGet, "/api/proxy/devices/devices", nil); rec.Body.String() != `{"user":"victim"}` || calls.Load() != 1 {
+		t.Fatalf("victim's repeat = %s after %d calls, want a cache hit", rec.Body, calls.Load())
+	}
+
+	// Neither an authenticated nor an anonymous caller claiming the victim's
+	// X-User-ID is served from the victim's entry
+	spoofed := http.Header{"X-User-Id": []string{"victim"}}
+	proxyAs(h, "attacker", http.MethodGet, "/api/proxy/devices/devices", spoofed)
+	if calls.Load() != 2 {
+		t.Fatalf("upstream calls = %d, authenticated spoofed request was served from the victim's cache entry", calls.Load())
+	}
+	proxyAs(h, "", http.MethodGet, "/api/proxy/devices/devices", spoofed)
+	if calls.Load() != 3 {
+		t.Fatalf("upstream calls = %d, anonymous spoofed request was served from the victim's cache entry", calls.Load())
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip reports whether the client's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				weight, err := strconv.ParseFloat(q, 64)
+				return err == nil && weight > 0
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressBody gzips a buffered response body for clients that accept it, if
+// client compression is on and the body is large enough to be worth it
+func (h *GatewayHandler) compressBody(w http.ResponseWriter, r *http.Request, body []byte) []byte {
+	cfg := h.config.Compression
+	if !cfg.ClientGzip || len(body) < cfg.ClientMinBytes || w.Header().Get("Content-Encoding") != "" {
+		return body
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r) {
+		return body
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return body
+	}
+	if err := zw.Close(); err != nil {
+		return body
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	return buf.Bytes()
+}
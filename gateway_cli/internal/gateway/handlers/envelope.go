@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
+)
+
+// Headers describing the upstream body, dropped once it is wrapped in an envelope
+var envelopeDroppedHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Range",
+	"Content-Md5",
+	"Etag",
+	"Accept-Ranges",
+}
+
+// wantsEnvelope reports whether the response to r is wrapped in the standard
+// envelope. Bodies with a content coding the gateway didn't decode are always
+// relayed as-is.
+func (h *GatewayHandler) wantsEnvelope(r *http.Request, header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	return h.config.Routes.ResponseModeFor(r.URL.Path, h.config.Server.ResponseMode) == config.ResponseEnvelope
+}
+
+// envelopeBody wraps an upstream body in the standard envelope, replacing the
+// headers that described the original body
+func envelopeBody(r *http.Request, header http.Header, statusCode int, contentType string, body []byte) []byte {
+	var data interface{}
+	switch {
+	case len(body) == 0:
+	case isJSONContentType(contentType) && json.Valid(body):
+		data = json.RawMessage(body)
+	default:
+		data = string(body)
+	}
+
+	wrapped, err := json.Marshal(response.Wrap(r, statusCode, data))
+	if err != nil {
+		return body
+	}
+
+	for _, name := range envelopeDroppedHeaders {
+		header.Del(name)
+	}
+	header.Set("Content-Type", "application/json")
+	return wrapped
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
+)
+
+func TestResponseModes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/text"):
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello"))
+		case strings.HasSuffix(r.URL.Path, "/missing"):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"missing":true}`))
+		case strings.HasSuffix(r.URL.Path, "/encoded"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte("\x0b\x02\x80raw"))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`{"id":1}`))
+		}
+	}))
+	defer upstream.Close()
+
+	h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Server.ResponseMode = config.ResponseTransparent
+		cfg.Routes.Responses = []config.RouteResponseMode{
+			{PathPrefix: "/api/proxy/devices/wrapped", Mode: config.ResponseEnvelope},
+		}
+	})
+
+	// Routes outside the override are relayed byte for byte
+	raw := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/raw", nil)
+	if raw.Body.String() != `{"id":1}` || raw.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("raw response = %s with ETag %q, want the upstream body and headers", raw.Body, raw.Header().Get("ETag"))
+	}
+
+	envelope := func(t *testing.T, path string, wantStatus int) response.Response {
+		t.Helper()
+		rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/wrapped"+path, nil)
+		if rec.Code != wantStatus || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: status %d, Content-Type %q, want %d and application/json", path, rec.Code, rec.Header().Get("Content-Type"), wantStatus)
+		}
+		var wrapped response.Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &wrapped); err != nil {
+			t.Fatalf("%s: envelope %s: %v", path, rec.Body, err)
+		}
+		if wrapped.Timestamp == 0 || rec.Header().Get("ETag") != "" {
+			t.Fatalf("%s: envelope %s with ETag %q, want a timestamp and no ETag", path, rec.Body, rec.Header().Get("ETag"))
+		}
+		return wrapped
+	}
+
+	if wrapped := envelope(t, "/json", http.StatusOK); !wrapped.Success || wrapped.Error != nil {
+		t.Fatalf("JSON envelope = %+v, want success", wrapped)
+	} else if data, _ := json.Marshal(wrapped.Data); string(data) != `{"id":1}` {
+		t.Fatalf("JSON envelope data = %s, want the upstream object", data)
+	}
+
+	if wrapped := envelope(t, "/text", http.StatusOK); wrapped.Data != "hello" {
+		t.Fatalf("text envelope data = %v, want the body as a string", wrapped.Data)
+	}
+
+	wrapped := envelope(t, "/missing", http.StatusNotFound)
+	if wrapped.Success || wrapped.Data != nil || wrapped.Error == nil || wrapped.Error.Code != "Not Found" {
+		t.Fatalf("error envelope = %+v, want a failure with code Not Found", wrapped)
+	}
+	if details, _ := json.Marshal(wrapped.Error.Details); string(details) != `{"missing":true}` {
+		t.Fatalf("error envelope details = %s, want the upstream body", details)
+	}
+
+	// Bodies the gateway can't decode aren't wrapped
+	encoded := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/wrapped/encoded", nil)
+	if encoded.Body.String() != "\x0b\x02\x80raw" || encoded.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("encoded response = %q with Content-Encoding %q, want it relayed as-is", encoded.Body, encoded.Header().Get("Content-Encoding"))
+	}
+}
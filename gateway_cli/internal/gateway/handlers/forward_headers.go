@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+)
+
+// Request headers the gateway terminates or recomputes instead of forwarding.
+// Accept-Encoding is left to the upstream transport so bodies arrive decoded
+// for status remapping and link injection.
+var gatewayRequestHeaders = []string{
+	"Authorization",
+	"Content-Length",
+	"Host",
+	"Accept-Encoding",
+}
+
+// forwardHeaders returns the headers to send upstream for r: end-to-end client
+// headers plus X-Forwarded-For/Proto/Host describing the client connection.
+// A configured public URL overrides Proto and Host in the processor.
+func forwardHeaders(r *http.Request) map[string]string {
+	header := r.Header.Clone()
+	processors.RemoveHopByHopHeaders(header)
+	for _, name := range gatewayRequestHeaders {
+		header.Del(name)
+	}
+
+	headers := make(map[string]string, len(header)+3)
+	for key, values := range header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+
+	// Append the client to the chain of proxies
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	if prior := r.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		clientIP = strings.Join(prior, ", ") + ", " + clientIP
+	}
+	headers["X-Forwarded-For"] = clientIP
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	headers["X-Forwarded-Proto"] = proto
+	headers["X-Forwarded-Host"] = r.Host
+
+	return headers
+}
+
+// requestHeaderBytes returns the size of r's headers as sent on the wire
+func requestHeaderBytes(r *http.Request) int {
+	size := 0
+	for key, values := range r.Header {
+		for _, value := range values {
+			size += len(key) + len(value) + 4 // ": " and CRLF
+		}
+	}
+	return size
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestForwardedHeadersUsePublicURL(t *testing.T) {
+	var received atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Clone())
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	// Values a client might send to pose as another origin
+	spoofed := http.Header{
+		"X-Forwarded-Proto": []string{"ftp"},
+		"X-Forwarded-Host":  []string{"evil.example.net"},
+	}
+
+	tests := []struct {
+		name      string
+		publicURL string
+		proto     string
+		host      string
+		forwarded string
+	}{
+		{"configured", "https://home.example.com:8443", "https", "home.example.com:8443", `proto=https;host="home.example.com:8443"`},
+		{"unset", "", "http", "example.com", ""},
+	}
+	for _, tt := range tests {
+		h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+			cfg.Server.PublicBaseURL = tt.publicURL
+		})
+		if rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", spoofed); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", tt.name, rec.Code)
+		}
+
+		sent := received.Load().(http.Header)
+		if sent.Get("X-Forwarded-Proto") != tt.proto || sent.Get("X-Forwarded-Host") != tt.host || sent.Get("Forwarded") != tt.forwarded {
+			t.Errorf("%s: upstream got X-Forwarded-Proto %q, X-Forwarded-Host %q, Forwarded %q, want %q, %q, %q", tt.name,
+				sent.Get("X-Forwarded-Proto"), sent.Get("X-Forwarded-Host"), sent.Get("Forwarded"), tt.proto, tt.host, tt.forwarded)
+		}
+	}
+}
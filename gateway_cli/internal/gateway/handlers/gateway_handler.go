@@ -1,21 +1,36 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
 )
 
+// statusClientClosedRequest is the non-standard status logged for requests the
+// client abandoned (the nginx convention)
+const statusClientClosedRequest = 499
+
 type GatewayHandler struct {
+	config    *config.Config
 	processor *processors.GatewayProcessor
 }
 
-func NewGatewayHandler(processor *processors.GatewayProcessor) *GatewayHandler {
+func NewGatewayHandler(cfg *config.Config, processor *processors.GatewayProcessor) *GatewayHandler {
 	return &GatewayHandler{
+		config:    cfg,
 		processor: processor,
 	}
 }
@@ -25,95 +40,109 @@ func (h *GatewayHandler) Proxy(w http.ResponseWriter, r *http.Request) {
 	service := vars["service"]
 
 	if service == "" {
-		response.Error(w, http.StatusBadRequest, "service not specified", nil)
+		response.Error(w, r, http.StatusBadRequest, "service not specified", nil)
 		return
 	}
 
-	// Extract path after /api/proxy/{service}
-	path := strings.TrimPrefix(r.URL.Path, "/api/proxy/"+service)
-	if path == "" {
-		path = "/"
+	if !h.limitRequestBody(w, r) {
+		return
 	}
 
+	// Extract path after /api/proxy/{service}
+	path := upstreamPath(r, "/api/proxy/"+service)
+
 	// Get user context
-	userID := getUserID(r)
+	userID, ok := h.resolveUser(w, r)
+	if !ok {
+		return
+	}
 
 	// Extract headers
-	headers := make(map[string]string)
-	for key, values := range r.Header {
-		if len(values) > 0 && !isSystemHeader(key) {
-			headers[key] = values[0]
-		}
-	}
+	headers := forwardHeaders(r)
+	h.processor.RecordHeaderSize(service, requestHeaderBytes(r))
+	h.setFeatureFlags(r, headers)
 
 	// Proxy the request
-	proxyResp, err := h.processor.ProxyRequest(service, path, r.Method, r.Body, headers, userID)
+	proxyResp, err := h.proxyRequest(r, service, path, headers, userID)
 	if err != nil {
-		response.Error(w, http.StatusBadGateway, "proxy failed", map[string]interface{}{
-			"service": service,
-			"error":   err.Error(),
-		})
+		writeProxyError(w, r, service, err, "proxy failed")
 		return
 	}
 
-	// Copy response headers
-	for key, value := range proxyResp.Headers {
-		w.Header().Set(key, value)
+	if proxyResp.Stream != nil {
+		h.writeStream(w, service, proxyResp)
+		return
 	}
 
-	// Set status and write response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(proxyResp.StatusCode)
-
-	if proxyResp.Body != nil {
-		json.NewEncoder(w).Encode(proxyResp.Body)
-	}
+	h.writeResponse(w, r, proxyResp)
+	h.flushResponse(w, r)
 }
 
-func (h *GatewayHandler) ProxyToService(serviceName string) http.HandlerFunc {
+// ProxyRoute forwards a configured direct route to its service, rewriting the
+// path to the route's target when it has one
+func (h *GatewayHandler) ProxyRoute(route config.DirectRoute) http.HandlerFunc {
+	serviceName := route.Service
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.limitRequestBody(w, r) {
+			return
+		}
+
 		// Get user context
-		userID := getUserID(r)
+		userID, ok := h.resolveUser(w, r)
+		if !ok {
+			return
+		}
 
 		// Extract headers
-		headers := make(map[string]string)
-		for key, values := range r.Header {
-			if len(values) > 0 && !isSystemHeader(key) {
-				headers[key] = values[0]
+		headers := forwardHeaders(r)
+		h.processor.RecordHeaderSize(serviceName, requestHeaderBytes(r))
+		h.setFeatureFlags(r, headers)
+
+		// Use original path without /api prefix, or the route's target path
+		path := upstreamPath(r, "/api")
+		if route.TargetPath != "" {
+			path = route.UpstreamPath(mux.Vars(r))
+			if r.URL.RawQuery != "" {
+				path += "?" + r.URL.RawQuery
 			}
 		}
 
-		// Use original path without /api prefix
-		path := strings.TrimPrefix(r.URL.Path, "/api")
-
 		// Proxy the request
-		proxyResp, err := h.processor.ProxyRequest(serviceName, path, r.Method, r.Body, headers, userID)
+		proxyResp, err := h.proxyRequest(r, serviceName, path, headers, userID)
 		if err != nil {
-			response.Error(w, http.StatusBadGateway, "service unavailable", map[string]interface{}{
-				"service": serviceName,
-				"error":   err.Error(),
-			})
+			writeProxyError(w, r, serviceName, err, "service unavailable")
 			return
 		}
 
-		// Copy response headers
-		for key, value := range proxyResp.Headers {
-			w.Header().Set(key, value)
+		if proxyResp.Stream != nil {
+			h.writeStream(w, serviceName, proxyResp)
+			return
 		}
 
-		// Set status and write response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(proxyResp.StatusCode)
+		h.writeResponse(w, r, proxyResp)
+		h.flushResponse(w, r)
+	}
+}
 
-		if proxyResp.Body != nil {
-			json.NewEncoder(w).Encode(proxyResp.Body)
+// Aggregate serves a fan-out route, returning the parts that answered within its budget
+func (h *GatewayHandler) Aggregate(route config.AggregateRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.resolveUser(w, r)
+		if !ok {
+			return
 		}
+
+		headers := forwardHeaders(r)
+		h.setFeatureFlags(r, headers)
+
+		result := h.processor.Aggregate(h.cacheContext(r), route, routeTemplate(r), headers, userID)
+		response.Success(w, r, "aggregate retrieved", result)
 	}
 }
 
 func (h *GatewayHandler) ListServices(w http.ResponseWriter, r *http.Request) {
 	services := h.processor.GetServicesStatus()
-	response.Success(w, "services retrieved", services)
+	response.Success(w, r, "services retrieved", services)
 }
 
 func (h *GatewayHandler) CheckServiceHealth(w http.ResponseWriter, r *http.Request) {
@@ -121,62 +150,502 @@ func (h *GatewayHandler) CheckServiceHealth(w http.ResponseWriter, r *http.Reque
 	service := vars["service"]
 
 	if service == "" {
-		response.Error(w, http.StatusBadRequest, "service not specified", nil)
+		response.Error(w, r, http.StatusBadRequest, "service not specified", nil)
 		return
 	}
 
 	health, err := h.processor.CheckServiceHealth(service)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "service not found", map[string]interface{}{
+		response.Error(w, r, http.StatusNotFound, "service not found", map[string]interface{}{
 			"service": service,
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	response.Success(w, "health check completed", health)
+	response.Success(w, r, "health check completed", health)
 }
 
+// TestService sends an admin-supplied request to a service and returns the full
+// upstream response, without counting it in the gateway's metrics
+func (h *GatewayHandler) TestService(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)["service"]
+
+	var testReq models.TestProxyRequest
+	if err := json.NewDecoder(r.Body).Decode(&testReq); err != nil {
+		response.Error(w, r, http.StatusBadRequest, "invalid test request", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	userID, _ := reqctx.UserIDFromContext(r.Context())
+	result, err := h.processor.TestProxy(r.Context(), service, testReq, userID)
+	if err != nil {
+		if errors.Is(err, processors.ErrServiceNotFound) {
+			response.Error(w, r, http.StatusNotFound, "service not found", map[string]interface{}{
+				"service": service,
+			})
+			return
+		}
+		response.Error(w, r, http.StatusBadGateway, "test request failed", map[string]interface{}{
+			"service": service,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	response.Success(w, r, "test request completed", result)
+}
+
+// ReloadServices re-reads the service registry from the environment and
+// returns what changed; the running registry is kept if the reload is rejected
+func (h *GatewayHandler) ReloadServices(w http.ResponseWriter, r *http.Request) {
+	diff, err := h.processor.ReloadServices()
+	if err != nil {
+		response.Error(w, r, http.StatusUnprocessableEntity, "service reload rejected", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	response.Success(w, r, "services reloaded", diff)
+}
+
+// RegisterService adds a backend to the registry at runtime
+func (h *GatewayHandler) RegisterService(w http.ResponseWriter, r *http.Request) {
+	var reg models.ServiceRegistration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		response.Error(w, r, http.StatusBadRequest, "invalid service registration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	info, err := h.processor.RegisterService(reg)
+	if err != nil {
+		switch {
+		case errors.Is(err, processors.ErrInvalidRegistration):
+			response.Error(w, r, http.StatusBadRequest, "invalid service registration", map[string]interface{}{
+				"error": err.Error(),
+			})
+		case errors.Is(err, processors.ErrServiceExists):
+			response.Error(w, r, http.StatusConflict, "service already registered", map[string]interface{}{
+				"service": reg.Name,
+			})
+		default:
+			response.Error(w, r, http.StatusInternalServerError, "service registration failed", map[string]interface{}{
+				"service": reg.Name,
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	response.Success(w, r, "service registered", map[string]interface{}{
+		"service":      reg.Name,
+		"url":          info.URL,
+		"health_check": info.HealthCheck,
+		"timeout":      info.Timeout,
+	})
+}
+
+// DeregisterService removes a backend added with RegisterService
+func (h *GatewayHandler) DeregisterService(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)["service"]
+
+	if err := h.processor.DeregisterService(service); err != nil {
+		switch {
+		case errors.Is(err, processors.ErrServiceNotFound):
+			response.Error(w, r, http.StatusNotFound, "service not found", map[string]interface{}{
+				"service": service,
+			})
+		case errors.Is(err, processors.ErrServiceNotRegistered):
+			response.Error(w, r, http.StatusConflict, "service is configured, not registered", map[string]interface{}{
+				"service": service,
+			})
+		case errors.Is(err, processors.ErrServiceInUse):
+			response.Error(w, r, http.StatusConflict, "service is a dependency of other services", map[string]interface{}{
+				"service": service,
+				"error":   err.Error(),
+			})
+		default:
+			response.Error(w, r, http.StatusInternalServerError, "service deregistration failed", map[string]interface{}{
+				"service": service,
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	response.Success(w, r, "service deregistered", map[string]interface{}{
+		"service": service,
+	})
+}
+
+// RestartService restarts a service and reports whether it came back healthy
 func (h *GatewayHandler) RestartService(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	service := vars["service"]
+	service := mux.Vars(r)["service"]
+
+	// The restart and health wait can outlast the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(h.processor.RestartDeadline() + 5*time.Second))
+
+	health, err := h.processor.RestartService(r.Context(), service)
+	if err != nil {
+		switch {
+		case errors.Is(err, processors.ErrServiceNotFound):
+			response.Error(w, r, http.StatusNotFound, "service not found", map[string]interface{}{
+				"service": service,
+			})
+		case errors.Is(err, processors.ErrRestartUnsupported):
+			response.Error(w, r, http.StatusNotImplemented, "service restarts are not configured", map[string]interface{}{
+				"service": service,
+			})
+		case errors.Is(err, processors.ErrRestartUnhealthy):
+			response.Error(w, r, http.StatusServiceUnavailable, "service unhealthy after restart", map[string]interface{}{
+				"service": service,
+				"error":   err.Error(),
+				"health":  health,
+			})
+		default:
+			response.Error(w, r, http.StatusBadGateway, "service restart failed", map[string]interface{}{
+				"service": service,
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
 
-	// This would integrate with Docker or systemd to restart services
-	// For now, just return a placeholder
-	response.Success(w, "restart initiated", map[string]interface{}{
+	response.Success(w, r, "service restarted", map[string]interface{}{
 		"service": service,
-		"status":  "initiated",
+		"status":  "restarted",
+		"health":  health,
 	})
 }
 
 // Helper functions
-func getUserID(r *http.Request) string {
-	if userID := r.Header.Get("X-User-ID"); userID != "" {
-		return userID
+
+// proxyRequest forwards r to service. On routes with DELETE tombstones, a retried
+// DELETE of an already deleted resource gets the original success response, and
+// a user's POST repeating an Idempotency-Key gets the first request's response.
+func (h *GatewayHandler) proxyRequest(r *http.Request, service, path string, headers map[string]string, userID string) (*models.ProxyResponse, error) {
+	// Tombstones and idempotency keys are scoped per authenticated user, never
+	// the client's X-User-ID, so no one can be answered with another's response
+	authUserID, _ := reqctx.UserIDFromContext(r.Context())
+
+	tombstoneTTL := 0
+	if r.Method == http.MethodDelete {
+		tombstoneTTL = h.config.Routes.TombstoneTTLFor(r.URL.Path)
 	}
 
-	// Extract from JWT context if available
-	if ctx := r.Context(); ctx != nil {
-		if userID, ok := ctx.Value("user_id").(string); ok {
-			return userID
+	if tombstoneTTL > 0 {
+		if proxyResp, found := h.processor.LookupTombstone(service, path, authUserID); found {
+			return proxyResp, nil
 		}
 	}
 
-	return ""
+	// Anonymous requests can't share idempotency keys
+	var claim *processors.IdempotencyClaim
+	if key := r.Header.Get("Idempotency-Key"); key != "" && r.Method == http.MethodPost && authUserID != "" && h.config.Idempotency.TTLSeconds > 0 {
+		replay, c, err := h.processor.ClaimIdempotencyKey(r.Context(), service, authUserID, key, r.Method, path)
+		if err != nil {
+			return nil, err
+		}
+		if replay != nil {
+			return replay, nil
+		}
+		claim = c
+	}
+
+	proxyResp, err := h.processor.ProxyRequest(h.cacheContext(r), service, routeTemplate(r), path, r.Method, r.Body, headers, userID, phaseTimings(r))
+	if claim != nil {
+		claim.Complete(proxyResp, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Fallbacks aren't real deletes
+	deleted := proxyResp.StatusCode >= 200 && proxyResp.StatusCode < 300 && proxyResp.Headers.Get("X-Gateway-Fallback") == ""
+	if tombstoneTTL > 0 && deleted && proxyResp.Stream == nil {
+		h.processor.RecordTombstone(service, path, authUserID, proxyResp, time.Duration(tombstoneTTL)*time.Second)
+	}
+
+	return proxyResp, nil
 }
 
-func isSystemHeader(header string) bool {
-	systemHeaders := []string{
-		"Authorization", "Content-Length", "Content-Type", "Host",
-		"User-Agent", "Accept-Encoding", "Connection",
+// writeProxyError maps a failed proxy request to its response status.
+// Upstream failures without a more specific status get 502 with fallbackMsg.
+func writeProxyError(w http.ResponseWriter, r *http.Request, service string, err error, fallbackMsg string) {
+	if isBodyTooLarge(err) {
+		response.Error(w, r, http.StatusRequestEntityTooLarge, "request body too large", nil)
+		return
+	}
+	if writeBudgetExhausted(w, r, service, err) {
+		return
+	}
+	if errors.Is(err, processors.ErrClientDisconnected) {
+		response.Error(w, r, statusClientClosedRequest, "client closed request", nil)
+		return
+	}
+	if errors.Is(err, processors.ErrCircuitOpen) {
+		response.Error(w, r, http.StatusServiceUnavailable, "service temporarily unavailable", map[string]interface{}{
+			"service": service,
+			"circuit": processors.CircuitOpen,
+		})
+		return
+	}
+	if errors.Is(err, processors.ErrBulkheadFull) {
+		response.Error(w, r, http.StatusServiceUnavailable, "service at capacity", map[string]interface{}{
+			"service": service,
+		})
+		return
+	}
+	if errors.Is(err, processors.ErrResponseBodyTooLarge) {
+		response.Error(w, r, http.StatusBadGateway, "upstream response too large", map[string]interface{}{
+			"service": service,
+		})
+		return
+	}
+	if errors.Is(err, processors.ErrShuttingDown) {
+		response.Error(w, r, http.StatusServiceUnavailable, "gateway shutting down", nil)
+		return
+	}
+	if errors.Is(err, processors.ErrNoServicesConfigured) {
+		response.Error(w, r, http.StatusServiceUnavailable, "gateway has no services configured", nil)
+		return
+	}
+	if errors.Is(err, processors.ErrIdempotencyInProgress) {
+		response.Error(w, r, http.StatusConflict, "request with this idempotency key in progress", nil)
+		return
+	}
+	if errors.Is(err, processors.ErrIdempotencyKeyReused) {
+		response.Error(w, r, http.StatusUnprocessableEntity, "idempotency key reused for a different request", nil)
+		return
 	}
+	response.Error(w, r, http.StatusBadGateway, fallbackMsg, map[string]interface{}{
+		"service": service,
+		"error":   err.Error(),
+	})
+}
 
-	header = strings.ToLower(header)
-	for _, sys := range systemHeaders {
-		if strings.ToLower(sys) == header {
-			return true
+// cacheContext marks requests carrying any of the cache bypass headers, which
+// may get user-specific responses that must not come from a shared cache
+func (h *GatewayHandler) cacheContext(r *http.Request) context.Context {
+	for _, name := range h.config.Cache.BypassHeaders {
+		if r.Header.Get(name) != "" {
+			return reqctx.WithCachePrivate(r.Context())
 		}
 	}
+	return r.Context()
+}
+
+// writeResponse relays a buffered upstream response with its own Content-Type.
+// Bodies are written as received, except JSON on routes with link injection.
+func (h *GatewayHandler) writeResponse(w http.ResponseWriter, r *http.Request, proxyResp *models.ProxyResponse) {
+	copyHeaders(w.Header(), proxyResp.Headers)
+
+	body := proxyResp.Body
+	contentType := w.Header().Get("Content-Type")
+	if contentType == "" && len(body) > 0 && json.Valid(body) {
+		contentType = "application/json"
+		w.Header().Set("Content-Type", contentType)
+	}
+	if isJSONContentType(contentType) {
+		body = h.injectLinks(r, proxyResp.StatusCode, body)
+	}
+
+	// Bodiless responses keep the upstream's headers, e.g. Content-Length for HEAD
+	if r.Method == http.MethodHead || proxyResp.StatusCode == http.StatusNoContent || proxyResp.StatusCode == http.StatusNotModified {
+		w.WriteHeader(proxyResp.StatusCode)
+		return
+	}
+
+	if h.wantsEnvelope(r, w.Header()) {
+		body = envelopeBody(r, w.Header(), proxyResp.StatusCode, contentType, body)
+	}
+
+	body = h.compressBody(w, r, body)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(proxyResp.StatusCode)
+	w.Write(body)
+}
+
+// flushResponse pushes the response to the client right away on routes with
+// the immediate flush policy, e.g. interactive device control
+func (h *GatewayHandler) flushResponse(w http.ResponseWriter, r *http.Request) {
+	if h.config.Routes.FlushPolicyFor(r.URL.Path) == config.FlushImmediate {
+		http.NewResponseController(w).Flush()
+	}
+}
 
-	return false
+// limitRequestBody applies the route-level body limit, rejecting requests whose
+// declared length already exceeds it. Returns false if a response was written.
+func (h *GatewayHandler) limitRequestBody(w http.ResponseWriter, r *http.Request) bool {
+	limit := h.config.Routes.BodyLimitFor(r.URL.Path)
+	if limit <= 0 {
+		return true
+	}
+
+	if r.ContentLength > limit {
+		response.Error(w, r, http.StatusRequestEntityTooLarge, "request body too large", map[string]interface{}{
+			"max_bytes": limit,
+		})
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// writeStream relays a streamed upstream body line by line, flushing after each
+// line so clients receive NDJSON objects and Server-Sent Events as soon as the
+// upstream emits them. At most MaxBufferBytes are read ahead of the client;
+// longer lines are relayed in chunks. Upstream reads wait on client writes, and
+// a client that doesn't accept a write within the slow client timeout is
+// disconnected. A client going away cancels the upstream request through the
+// request context.
+func (h *GatewayHandler) writeStream(w http.ResponseWriter, service string, proxyResp *models.ProxyResponse) {
+	defer proxyResp.Stream.Close()
+
+	copyHeaders(w.Header(), proxyResp.Headers)
+	w.Header().Del("Content-Length")
+	if isEventStream(w.Header().Get("Content-Type")) {
+		// Keep caches and buffering proxies in front of the gateway from holding events back
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+	w.WriteHeader(proxyResp.StatusCode)
+
+	// Long-lived streams must not be cut off by the server write timeout, only
+	// by individual writes stalling
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	slowClientTimeout := time.Duration(h.config.Streaming.SlowClientTimeoutSeconds) * time.Second
+
+	var written int64
+	reader := bufio.NewReaderSize(proxyResp.Stream, h.config.Streaming.MaxBufferBytes)
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			rc.SetWriteDeadline(time.Now().Add(slowClientTimeout))
+			n, writeErr := w.Write(chunk)
+			written += int64(n)
+			if writeErr == nil && err != bufio.ErrBufferFull {
+				writeErr = rc.Flush()
+			}
+			if writeErr != nil {
+				if errors.Is(writeErr, os.ErrDeadlineExceeded) {
+					h.processor.StreamAborted(service, "client too slow", written)
+				}
+				// Otherwise the client went away
+				return
+			}
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			if errors.Is(err, processors.ErrResponseBodyTooLarge) {
+				h.processor.StreamAborted(service, "response too large", written)
+			}
+			return
+		}
+	}
+}
+
+// copyHeaders replaces dst's values with every value of src, so repeated
+// headers such as Set-Cookie all reach the client
+func copyHeaders(dst, src http.Header) {
+	for key, values := range src {
+		dst.Del(key)
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr) || errors.Is(err, processors.ErrRequestBodyTooLarge)
+}
+
+// writeBudgetExhausted responds 504 naming the phase that used up the request
+// budget. Returns false if err isn't a budget error.
+func writeBudgetExhausted(w http.ResponseWriter, r *http.Request, service string, err error) bool {
+	var budgetErr *processors.BudgetExhaustedError
+	if !errors.As(err, &budgetErr) {
+		return false
+	}
+
+	response.Error(w, r, http.StatusGatewayTimeout, "request budget exhausted", map[string]interface{}{
+		"service":   service,
+		"code":      budgetErr.Code(),
+		"phase":     budgetErr.Phase,
+		"phases_ms": budgetErr.PhasesMillis(),
+	})
+	return true
+}
+
+func phaseTimings(r *http.Request) *models.PhaseTimings {
+	return reqctx.PhaseTimingsFromContext(r.Context())
+}
+
+// resolveUser applies the missing-user policy to authenticated routes, where
+// only the user Auth resolved counts and a client's X-User-ID is ignored.
+// Public routes are forwarded with the X-User-ID the client sent, if any.
+// Returns false if a response was written.
+func (h *GatewayHandler) resolveUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !reqctx.Authenticated(r.Context()) {
+		return r.Header.Get("X-User-ID"), true
+	}
+
+	if userID, _ := reqctx.UserIDFromContext(r.Context()); userID != "" {
+		return userID, true
+	}
+
+	switch h.config.Auth.MissingUserPolicy {
+	case config.MissingUserReject:
+		response.Error(w, r, http.StatusUnauthorized, "user context missing", nil)
+		return "", false
+	case config.MissingUserAnonymous:
+		return "anonymous", true
+	default:
+		return "", true
+	}
+}
+
+// setFeatureFlags forwards the authenticated user's resolved feature flags to
+// the upstream, replacing any X-Feature-Flags header sent by the client. Flags
+// are never resolved for the client's X-User-ID.
+func (h *GatewayHandler) setFeatureFlags(r *http.Request, headers map[string]string) {
+	delete(headers, "X-Feature-Flags")
+
+	userID, _ := reqctx.UserIDFromContext(r.Context())
+	claimed := reqctx.FeatureFlagsFromContext(r.Context())
+	if flags := h.processor.ResolveFeatureFlags(userID, claimed); len(flags) > 0 {
+		headers["X-Feature-Flags"] = strings.Join(flags, ",")
+	}
+}
+
+// upstreamPath returns the request path after prefix with the query string,
+// both escaped exactly as the client sent them
+func upstreamPath(r *http.Request, prefix string) string {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	if path == "" {
+		path = "/"
+	}
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+	return path
+}
+
+// routeTemplate returns the path template of the matched mux route, e.g. "/api/devices/{id}"
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
 }
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// newTestHandler serves the "devices" service from upstream, backed by miniredis
+func newTestHandler(t *testing.T, upstream string) *GatewayHandler {
+	return newTestHandlerWith(t, upstream, nil)
+}
+
+// newTestHandlerWith is newTestHandler with setup, if set, adjusting the
+// default config first
+func newTestHandlerWith(t *testing.T, upstream string, setup func(*config.Config)) *GatewayHandler {
+	processor, cfg, _ := newTestProcessor(t, upstream, setup)
+	return NewGatewayHandler(cfg, processor)
+}
+
+// newTestProcessor starts the processor behind newTestHandlerWith
+func newTestProcessor(t *testing.T, upstream string, setup func(*config.Config)) (*processors.GatewayProcessor, *config.Config, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.Redis.URL = "redis://" + mr.Addr()
+	cfg.Services.Discovery = config.DiscoveryStatic
+	cfg.Services.Registry = map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream, "", 5),
+	}
+	if setup != nil {
+		setup(cfg)
+	}
+
+	redisClient, err := redis.NewClient(cfg.Redis)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { redisClient.Close() })
+
+	processor := processors.NewGatewayProcessor(cfg, redisClient)
+	processor.Start()
+	return processor, cfg, mr
+}
+
+// withService adjusts the "devices" service of a test config
+func withService(adjust func(*config.ServiceInfo)) func(*config.Config) {
+	return func(cfg *config.Config) {
+		info := cfg.Services.Registry["devices"]
+		adjust(&info)
+		cfg.Services.Registry["devices"] = info
+	}
+}
+
+// proxyAs sends a request through Proxy for the "devices" service,
+// authenticated as userID if set
+func proxyAs(h *GatewayHandler, userID, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(`{}`))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if userID != "" {
+		req = req.WithContext(reqctx.WithUser(req.Context(), &models.User{ID: userID, Role: "user"}))
+	}
+	req = mux.SetURLVars(req, map[string]string{"service": "devices"})
+
+	rec := httptest.NewRecorder()
+	h.Proxy(rec, req)
+	return rec
+}
+
+func TestIdempotencyKeyScopedByAuthenticatedUser(t *testing.T) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"owner":"` + r.Header.Get("X-User-ID") + `"}`))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandler(t, upstream.URL)
+	// Both clients claim to be the same user in X-User-ID
+	header := http.Header{
+		"Idempotency-Key": []string{"key-1"},
+		"X-User-Id":       []string{"victim"},
+	}
+
+	first := proxyAs(h, "user-a", http.MethodPost, "/api/proxy/devices/devices", header)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request status = %d, want 201", first.Code)
+	}
+
+	other := proxyAs(h, "user-b", http.MethodPost, "/api/proxy/devices/devices", header)
+	if other.Header().Get("X-Gateway-Idempotent-Replay") != "" {
+		t.Fatal("another authenticated user got the first user's response replayed")
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("upstream calls = %d, want 2", calls.Load())
+	}
+
+	repeat := proxyAs(h, "user-a", http.MethodPost, "/api/proxy/devices/devices", header)
+	if repeat.Header().Get("X-Gateway-Idempotent-Replay") != "true" {
+		t.Fatal("the same user's repeat wasn't replayed")
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("upstream calls = %d after a replay, want 2", calls.Load())
+	}
+}
+
+func TestProxyForwardsExactQueryString(t *testing.T) {
+	var gotPath, gotQuery atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath.Store(r.URL.EscapedPath())
+		gotQuery.Store(r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandler(t, upstream.URL)
+	// Repeated keys, an empty value and encodings a re-encode would change
+	query := "tag=a%20b&tag=c&empty=&sum=1%2B2&plus=a+b&z=1&a=2"
+	rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices/lamp%2F1?"+query, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	if got := gotQuery.Load(); got != query {
+		t.Fatalf("upstream query = %q, want %q", got, query)
+	}
+	if got := gotPath.Load(); got != "/devices/lamp%2F1" {
+		t.Fatalf("upstream path = %q, want /devices/lamp%%2F1", got)
+	}
+}
+
+func TestRetriedDeleteReturnsTombstoneToSameUserOnly(t *testing.T) {
+	var deleted atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if deleted.Swap(true) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+			return
+		}
+		w.Write([]byte(`{"deleted":"lamp-1"}`))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Routes.Tombstones = []config.RouteTombstone{{PathPrefix: "/api/proxy/devices/", TTLSeconds: 60}}
+	})
+	target := "/api/proxy/devices/devices/lamp-1"
+
+	first := proxyAs(h, "user-a", http.MethodDelete, target, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("first DELETE status = %d, want 200", first.Code)
+	}
+
+	retry := proxyAs(h, "user-a", http.MethodDelete, target, nil)
+	if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retried DELETE = %d %s, want the original success", retry.Code, retry.Body)
+	}
+	if retry.Header().Get("X-Gateway-Tombstone") != "true" {
+		t.Fatal("retried DELETE not answered from the tombstone")
+	}
+
+	if other := proxyAs(h, "user-b", http.MethodDelete, target, nil); other.Code != http.StatusNotFound {
+		t.Fatalf("another user's DELETE status = %d, want the upstream's 404", other.Code)
+	}
+	spoofed := http.Header{"X-User-Id": []string{"user-a"}}
+	if rec := proxyAs(h, "user-b", http.MethodDelete, target, spoofed); rec.Code != http.StatusNotFound {
+		t.Fatalf("DELETE claiming user-a's X-User-ID status = %d, want the upstream's 404", rec.Code)
+	}
+}
+
+// flagsUpstream answers with the X-Feature-Flags header it received
+func flagsUpstream(t *testing.T) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"flags":"` + r.Header.Get("X-Feature-Flags") + `"}`))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestResolvedFeatureFlagsForwarded(t *testing.T) {
+	h := newTestHandlerWith(t, flagsUpstream(t).URL, func(cfg *config.Config) {
+		cfg.Features.Flags = []config.FeatureFlag{
+			{Name: "new-dashboard", Users: []string{"user-a"}},
+			{Name: "dark-mode", Users: []string{"*"}},
+		}
+	})
+	// Clients can't set flags themselves
+	header := http.Header{"X-Feature-Flags": []string{"admin-tools"}}
+
+	if rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", header); rec.Body.String() != `{"flags":"dark-mode,new-dashboard"}` {
+		t.Fatalf("user-a's upstream got %s, want its resolved flags", rec.Body)
+	}
+	if rec := proxyAs(h, "user-b", http.MethodGet, "/api/proxy/devices/devices", header); rec.Body.String() != `{"flags":"dark-mode"}` {
+		t.Fatalf("user-b's upstream got %s, want only the flags for everyone", rec.Body)
+	}
+
+	spoofed := http.Header{"X-User-Id": []string{"user-a"}}
+	if rec := proxyAs(h, "user-b", http.MethodGet, "/api/proxy/devices/devices", spoofed); rec.Body.String() != `{"flags":"dark-mode"}` {
+		t.Fatalf("user-b claiming user-a's X-User-ID got %s", rec.Body)
+	}
+}
+
+func TestMissingFlagSourceForwardsNoFlags(t *testing.T) {
+	h := newTestHandler(t, flagsUpstream(t).URL)
+	h.processor.SetFeatureFlagSource(nil)
+
+	header := http.Header{"X-Feature-Flags": []string{"admin-tools"}}
+	if rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", header); rec.Code != http.StatusOK || rec.Body.String() != `{"flags":""}` {
+		t.Fatalf("without a source the upstream got %d %s, want no flags", rec.Code, rec.Body)
+	}
+}
+
+func TestMissingUserPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		authenticated bool
+		claimed       string
+		wantStatus    int
+		wantUser      string
+	}{
+		{"public route forwards without a user", config.MissingUserReject, false, "", http.StatusOK, ""},
+		{"public route passes the client's user", config.MissingUserReject, false, "user-x", http.StatusOK, "user-x"},
+		{"protected route rejects", config.MissingUserReject, true, "", http.StatusUnauthorized, ""},
+		{"protected route ignores a claimed user", config.MissingUserReject, true, "user-x", http.StatusUnauthorized, ""},
+		{"protected route marks anonymous", config.MissingUserAnonymous, true, "user-x", http.StatusOK, "anonymous"},
+		{"protected route forwards empty", config.MissingUserForward, true, "user-x", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, _ := userEchoUpstream(t)
+			h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+				cfg.Auth.MissingUserPolicy = tt.policy
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/proxy/devices/devices", nil)
+			if tt.claimed != "" {
+				req.Header.Set("X-User-ID", tt.claimed)
+			}
+			if tt.authenticated {
+				// A validated token that resolved to no user ID
+				req = req.WithContext(reqctx.WithUser(req.Context(), &models.User{}))
+			}
+			req = mux.SetURLVars(req, map[string]string{"service": "devices"})
+			rec := httptest.NewRecorder()
+			h.Proxy(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != `{"user":"`+tt.wantUser+`"}` {
+				t.Fatalf("upstream got %s, want user %q", rec.Body, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestAuthenticatedUserOverridesClaimedUser(t *testing.T) {
+	upstream, _ := userEchoUpstream(t)
+	h := newTestHandler(t, upstream.URL)
+
+	spoofed := http.Header{"X-User-Id": []string{"victim"}}
+	if rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", spoofed); rec.Body.String() != `{"user":"user-a"}` {
+		t.Fatalf("upstream got %s, want the authenticated user", rec.Body)
+	}
+}
+
+func TestOversizedRequestBodyIsRejected(t *testing.T) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Server.MaxRequestBodyBytes = 1024
+	})
+
+	body := strings.Repeat("x", 1<<20)
+	for name, reader := range map[string]io.Reader{
+		"declared length": strings.NewReader(body),
+		"unknown length":  io.MultiReader(strings.NewReader(body)),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy/devices/devices", reader)
+		req = req.WithContext(reqctx.WithUser(req.Context(), &models.User{ID: "user-a", Role: "user"}))
+		req = mux.SetURLVars(req, map[string]string{"service": "devices"})
+		rec := httptest.NewRecorder()
+		h.Proxy(rec, req)
+
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: status = %d, want 413", name, rec.Code)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("upstream received %d oversized requests", calls.Load())
+	}
+}
+
+func TestOversizedResponseIsNotBuffered(t *testing.T) {
+	var written atomic.Int64
+	done := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		w.Header().Set("Content-Type", "application/json")
+		chunk := []byte(strings.Repeat(" ", 32*1024))
+		for written.Load() < 256<<20 {
+			n, err := w.Write(chunk)
+			written.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Server.MaxResponseBodyBytes = 1024
+	})
+
+	rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", nil)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+
+	// The gateway stops reading past the limit, so the upstream's writes fail
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("upstream still writing after %d bytes", written.Load())
+	}
+	if got := written.Load(); got >= 64<<20 {
+		t.Fatalf("upstream wrote %d bytes, want the gateway to stop reading at the limit", got)
+	}
+}
+
+func TestRepeatedAndHopByHopHeaders(t *testing.T) {
+	var received atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Clone())
+		w.Header().Add("Set-Cookie", "session=abc; Path=/")
+		w.Header().Add("Set-Cookie", "theme=dark; Path=/")
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		w.Header().Set("X-Kept", "yes")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandler(t, upstream.URL)
+	rec := proxyAs(h, "user-a", http.MethodGet, "/api/proxy/devices/devices", http.Header{
+		"Connection":          []string{"X-Client-Hop"},
+		"X-Client-Hop":        []string{"1"},
+		"Proxy-Authorization": []string{"Basic Zm9vOmJhcg=="},
+		"X-Client-Kept":       []string{"yes"},
+	})
+
+	if cookies := rec.Header().Values("Set-Cookie"); len(cookies) != 2 || cookies[0] != "session=abc; Path=/" || cookies[1] != "theme=dark; Path=/" {
+		t.Fatalf("Set-Cookie = %q, want both cookies", cookies)
+	}
+	for _, name := range []string{"Connection", "X-Upstream-Hop", "Keep-Alive", "Proxy-Authenticate"} {
+		if value := rec.Header().Get(name); value != "" {
+			t.Errorf("response hop-by-hop header %s = %q reached the client", name, value)
+		}
+	}
+	if rec.Header().Get("X-Kept") != "yes" {
+		t.Error("end-to-end response header was dropped")
+	}
+
+	sent := received.Load().(http.Header)
+	for _, name := range []string{"X-Client-Hop", "Proxy-Authorization"} {
+		if value := sent.Get(name); value != "" {
+			t.Errorf("request hop-by-hop header %s = %q reached the upstream", name, value)
+		}
+	}
+	if sent.Get("X-Client-Kept") != "yes" {
+		t.Error("end-to-end request header was dropped")
+	}
+}
+
+func TestImmediateFlushPolicy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"on":true}`))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Routes.Flush = []config.RouteFlushPolicy{
+			{PathPrefix: "/api/proxy/devices/control", Policy: config.FlushImmediate},
+			{PathPrefix: "/api/proxy/devices/control/batch", Policy: config.FlushBuffered},
+		}
+	})
+
+	tests := []struct {
+		path    string
+		flushed bool
+	}{
+		{"/api/proxy/devices/control/lamp-1", true},
+		{"/api/proxy/devices/control/batch", false},
+		{"/api/proxy/devices/history", false},
+	}
+	for _, tt := range tests {
+		rec := proxyAs(h, "user-a", http.MethodPost, tt.path, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"on":true}` {
+			t.Fatalf("%s: status %d, body %s", tt.path, rec.Code, rec.Body)
+		}
+		if rec.Flushed != tt.flushed {
+			t.Errorf("%s: flushed = %t, want %t", tt.path, rec.Flushed, tt.flushed)
+		}
+	}
+}
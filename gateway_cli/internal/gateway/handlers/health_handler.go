@@ -1,26 +1,128 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/gorilla/mux"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/version"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
 )
 
+// HealthSource is what the health endpoints need from the gateway processor
+type HealthSource interface {
+	GetServicesStatus() map[string]*models.HealthCheckResult
+	CheckServiceHealth(service string) (*models.HealthCheckResult, error)
+	HealthHistory(service string) (*models.HealthHistory, error)
+	Ready(ctx context.Context) error
+	Uptime() time.Duration
+}
+
 type HealthHandler struct {
-	// fields
+	processor HealthSource
+	authStats func() models.AuthResponseStats
 }
 
-func NewHealthHandler(processor *processors.GatewayProcessor) *HealthHandler {
-	return &HealthHandler{}
+func NewHealthHandler(processor HealthSource, authStats func() models.AuthResponseStats) *HealthHandler {
+	return &HealthHandler{
+		processor: processor,
+		authStats: authStats,
+	}
 }
 
+// Health reports the gateway as degraded while any service is unhealthy or
+// degraded, along with the gateway's build, uptime and auth response consumers
 func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
-	response.Success(w, "gateway healthy", map[string]interface{}{
-		"status": "healthy",
+	services := h.processor.GetServicesStatus()
+
+	status := "healthy"
+	var unhealthy, degraded []string
+	for name, health := range services {
+		switch health.Status {
+		case "unhealthy":
+			status = "degraded"
+			unhealthy = append(unhealthy, name)
+		case "degraded":
+			status = "degraded"
+			degraded = append(degraded, name)
+		}
+	}
+
+	response.Success(w, r, "gateway "+status, map[string]interface{}{
+		"status":         status,
+		"services":       services,
+		"unhealthy":      unhealthy,
+		"degraded":       degraded,
+		"build":          version.Info(),
+		"uptime_seconds": int64(h.processor.Uptime().Seconds()),
+		"auth_responses": h.authStats(),
+	})
+}
+
+// Livez answers as long as the process can serve HTTP
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	response.Success(w, r, "gateway alive", map[string]interface{}{
+		"status": "alive",
+	})
+}
+
+// Readyz answers 503 while Redis is unreachable or no backend is healthy
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if err := h.processor.Ready(r.Context()); err != nil {
+		response.Error(w, r, http.StatusServiceUnavailable, "gateway not ready", map[string]interface{}{
+			"status": "not_ready",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	response.Success(w, r, "gateway ready", map[string]interface{}{
+		"status": "ready",
 	})
 }
 
 func (h *HealthHandler) ServiceHealth(w http.ResponseWriter, r *http.Request) {
-	// implementation
+	service := mux.Vars(r)["service"]
+
+	health, err := h.processor.CheckServiceHealth(service)
+	if err != nil {
+		if errors.Is(err, processors.ErrServiceNotFound) {
+			response.Error(w, r, http.StatusNotFound, "service not found", map[string]interface{}{
+				"service": service,
+			})
+			return
+		}
+		response.Error(w, r, http.StatusInternalServerError, "health check failed", map[string]interface{}{
+			"service": service,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if health.Status == "unhealthy" {
+		response.Error(w, r, http.StatusServiceUnavailable, "service unhealthy", health)
+		return
+	}
+
+	response.Success(w, r, "service health retrieved", health)
+}
+
+// ServiceHealthHistory returns a service's recent health checks and whether it is flapping
+func (h *HealthHandler) ServiceHealthHistory(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)["service"]
+
+	history, err := h.processor.HealthHistory(service)
+	if err != nil {
+		response.Error(w, r, http.StatusNotFound, "service not found", map[string]interface{}{
+			"service": service,
+		})
+		return
+	}
+
+	response.Success(w, r, "service health history retrieved", history)
 }
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/version"
+)
+
+// fakeHealth serves fixed health results
+type fakeHealth struct {
+	services map[string]*models.HealthCheckResult
+	ready    error
+	uptime   time.Duration
+}
+
+func (f *fakeHealth) GetServicesStatus() map[string]*models.HealthCheckResult {
+	return f.services
+}
+
+func (f *fakeHealth) CheckServiceHealth(service string) (*models.HealthCheckResult, error) {
+	health, ok := f.services[service]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", processors.ErrServiceNotFound, service)
+	}
+	return health, nil
+}
+
+func (f *fakeHealth) HealthHistory(service string) (*models.HealthHistory, error) {
+	if _, ok := f.services[service]; !ok {
+		return nil, fmt.Errorf("%w: %s", processors.ErrServiceNotFound, service)
+	}
+	return &models.HealthHistory{}, nil
+}
+
+func (f *fakeHealth) Ready(ctx context.Context) error {
+	return f.ready
+}
+
+func (f *fakeHealth) Uptime() time.Duration {
+	return f.uptime
+}
+
+func newFakeHealth() *fakeHealth {
+	return &fakeHealth{services: map[string]*models.HealthCheckResult{
+		"devices":    {Service: "devices", Status: "healthy"},
+		"automation": {Service: "automation", Status: "unhealthy", Error: "status code: 500"},
+	}}
+}
+
+func noAuthStats() models.AuthResponseStats {
+	return models.AuthResponseStats{}
+}
+
+// healthResponse decodes a response envelope with its data as a generic map
+func healthResponse(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body struct {
+		Data  map[string]interface{} `json:"data"`
+		Error *struct {
+			Details map[string]interface{} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if body.Error != nil {
+		return body.Error.Details
+	}
+	return body.Data
+}
+
+func TestServiceHealth(t *testing.T) {
+	h := NewHealthHandler(newFakeHealth(), noAuthStats)
+
+	tests := []struct {
+		service    string
+		wantStatus int
+	}{
+		{"devices", http.StatusOK},
+		{"missing", http.StatusNotFound},
+		{"automation", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/health/"+tt.service, nil), map[string]string{"service": tt.service})
+			rec := httptest.NewRecorder()
+			h.ServiceHealth(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHealthReportsDegraded(t *testing.T) {
+	source := newFakeHealth()
+	h := NewHealthHandler(source, noAuthStats)
+
+	rec := httptest.NewRecorder()
+	h.Health(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	data := healthResponse(t, rec)
+	if data["status"] != "degraded" {
+		t.Fatalf("status = %v with an unhealthy service, want degraded", data["status"])
+	}
+	if unhealthy, _ := data["unhealthy"].([]interface{}); len(unhealthy) != 1 || unhealthy[0] != "automation" {
+		t.Fatalf("unhealthy = %v, want [automation]", data["unhealthy"])
+	}
+
+	source.services["automation"].Status = "healthy"
+	rec = httptest.NewRecorder()
+	h.Health(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if data := healthResponse(t, rec); data["status"] != "healthy" {
+		t.Fatalf("status = %v with every service healthy, want healthy", data["status"])
+	}
+}
+
+func probeStatus(t *testing.T, handler http.HandlerFunc, path string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestReadyzWithRedisDown(t *testing.T) {
+	upstream, _ := userEchoUpstream(t)
+	processor, _, mr := newTestProcessor(t, upstream.URL, nil)
+	if _, err := processor.CheckServiceHealth("devices"); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	h := NewHealthHandler(processor, noAuthStats)
+
+	if code := probeStatus(t, h.Readyz, "/readyz"); code != http.StatusOK {
+		t.Fatalf("readyz = %d with Redis and a backend up, want 200", code)
+	}
+
+	mr.Close()
+	if code := probeStatus(t, h.Readyz, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz = %d with Redis down, want 503", code)
+	}
+	if code := probeStatus(t, h.Livez, "/livez"); code != http.StatusOK {
+		t.Fatalf("livez = %d with Redis down, want 200", code)
+	}
+}
+
+func TestReadyzWithAllBackendsDown(t *testing.T) {
+	upstream, _ := userEchoUpstream(t)
+	processor, _, _ := newTestProcessor(t, upstream.URL, nil)
+	h := NewHealthHandler(processor, noAuthStats)
+
+	upstream.Close()
+	if _, err := processor.CheckServiceHealth("devices"); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz = %d with every backend down, want 503", rec.Code)
+	}
+	if data := healthResponse(t, rec); data["status"] != "not_ready" {
+		t.Fatalf("readyz details = %v", data)
+	}
+	if code := probeStatus(t, h.Livez, "/livez"); code != http.StatusOK {
+		t.Fatalf("livez = %d with every backend down, want 200", code)
+	}
+}
+
+func TestHealthReportsBuildAndUptime(t *testing.T) {
+	defer func(v, c string) { version.Version, version.Commit = v, c }(version.Version, version.Commit)
+	version.Version, version.Commit = "v1.4.2", "abc1234"
+
+	source := newFakeHealth()
+	source.uptime = 90*time.Second + 400*time.Millisecond
+	h := NewHealthHandler(source, func() models.AuthResponseStats {
+		return models.AuthResponseStats{Group: "gateway-auth:test", Consumers: 4}
+	})
+
+	rec := httptest.NewRecorder()
+	h.Health(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	data := healthResponse(t, rec)
+
+	build, _ := data["build"].(map[string]interface{})
+	if build["version"] != "v1.4.2" || build["commit"] != "abc1234" || build["build_time"] != "unknown" {
+		t.Fatalf("build = %v", data["build"])
+	}
+	if data["uptime_seconds"] != float64(90) {
+		t.Fatalf("uptime_seconds = %v, want 90", data["uptime_seconds"])
+	}
+	if auth, _ := data["auth_responses"].(map[string]interface{}); auth["group"] != "gateway-auth:test" {
+		t.Fatalf("auth_responses = %v", data["auth_responses"])
+	}
+}
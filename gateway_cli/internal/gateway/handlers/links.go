@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+)
+
+// injectLinks adds a HATEOAS _links object to JSON responses of configured routes.
+// Objects get self, next and related links; arrays keep their shape and each
+// element with an "id" gets its own self link. Other bodies are returned unchanged.
+func (h *GatewayHandler) injectLinks(r *http.Request, statusCode int, body []byte) []byte {
+	if statusCode < 200 || statusCode >= 300 {
+		return body
+	}
+
+	route, ok := h.config.Routes.LinksFor(r.URL.Path)
+	if !ok {
+		return body
+	}
+
+	decoded, err := processors.DecodeJSON(body)
+	if err != nil {
+		return body
+	}
+
+	base := h.publicBase(r)
+
+	switch v := decoded.(type) {
+	case map[string]interface{}:
+		links := map[string]interface{}{
+			"self": map[string]string{"href": base + r.URL.RequestURI()},
+		}
+		if next := nextPageURI(r.URL); next != "" {
+			links["next"] = map[string]string{"href": base + next}
+		}
+		for rel, href := range route.Related {
+			links[rel] = map[string]string{"href": base + href}
+		}
+		v["_links"] = links
+	case []interface{}:
+		for _, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if id, exists := obj["id"]; exists {
+				obj["_links"] = map[string]interface{}{
+					"self": map[string]string{"href": fmt.Sprintf("%s%s/%v", base, strings.TrimRight(r.URL.Path, "/"), id)},
+				}
+			}
+		}
+	default:
+		return body
+	}
+
+	linked, err := json.Marshal(decoded)
+	if err != nil {
+		return body
+	}
+	return linked
+}
+
+// isEventStream reports whether a Content-Type is a Server-Sent Events stream
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// isJSONContentType reports whether a Content-Type is JSON, including +json types
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// publicBase returns the gateway's public scheme://host, preferring the configured URL
+func (h *GatewayHandler) publicBase(r *http.Request) string {
+	if h.config.Server.PublicBaseURL != "" {
+		return strings.TrimRight(h.config.Server.PublicBaseURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// nextPageURI derives the next page from limit/offset query params, if present
+func nextPageURI(u *url.URL) string {
+	query := u.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		return ""
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	query.Set("offset", strconv.Itoa(offset+limit))
+	return u.Path + "?" + query.Encode()
+}
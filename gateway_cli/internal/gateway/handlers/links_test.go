@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestLargeIntegerIDsSurviveProxy(t *testing.T) {
+	// Both values are beyond float64's exact integer range
+	const object = `{"id":123456789012345678901,"ts":9007199254740993}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/list") {
+			w.Write([]byte("[" + object + "]"))
+			return
+		}
+		w.Write([]byte(object))
+	}))
+	defer upstream.Close()
+
+	h := newTestHandlerWith(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Routes.Links = []config.RouteLinks{{PathPrefix: "/api/proxy/devices/linked"}}
+		withService(func(info *config.ServiceInfo) {
+			info.StatusRemap = &config.StatusRemap{Field: "error", Codes: map[string]int{"*": http.StatusBadGateway}}
+		})(cfg)
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{"passthrough", "/api/proxy/devices/plain", []string{object}},
+		{"links object", "/api/proxy/devices/linked/item", []string{`"id":123456789012345678901`, `"ts":9007199254740993`}},
+		{"links array", "/api/proxy/devices/linked/list", []string{`"id":123456789012345678901`, `/linked/list/123456789012345678901"`}},
+	}
+	for _, tt := range tests {
+		rec := proxyAs(h, "user-a", http.MethodGet, tt.path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", tt.name, rec.Code)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: body = %s, want it to contain %s", tt.name, rec.Body, want)
+			}
+		}
+	}
+}
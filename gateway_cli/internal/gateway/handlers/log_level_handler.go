@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
+)
+
+type LogLevelHandler struct {
+	processor *processors.GatewayProcessor
+}
+
+func NewLogLevelHandler(processor *processors.GatewayProcessor) *LogLevelHandler {
+	return &LogLevelHandler{
+		processor: processor,
+	}
+}
+
+type setLogLevelRequest struct {
+	Level      string `json:"level"`
+	Service    string `json:"service,omitempty"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+}
+
+func (h *LogLevelHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	level, overrides := h.processor.LogLevels()
+	response.Success(w, r, "log level retrieved", map[string]interface{}{
+		"level":     level,
+		"overrides": overrides,
+	})
+}
+
+// SetLogLevel changes the log level, optionally for a single service and for
+// ttl_seconds after which the previous level is restored
+func (h *LogLevelHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req setLogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, "invalid request body", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if req.TTLSeconds < 0 {
+		response.Error(w, r, http.StatusBadRequest, "ttl_seconds must not be negative", nil)
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if err := h.processor.SetLogLevel(req.Level, req.Service, ttl); err != nil {
+		response.Error(w, r, http.StatusBadRequest, "invalid log level", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	level, overrides := h.processor.LogLevels()
+	response.Success(w, r, "log level updated", map[string]interface{}{
+		"level":       level,
+		"overrides":   overrides,
+		"ttl_seconds": req.TTLSeconds,
+	})
+}
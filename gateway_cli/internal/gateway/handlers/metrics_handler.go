@@ -3,24 +3,45 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/gorilla/mux"
+
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/processors"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
 )
 
-type MetricshHandler struct {
-	// fields
+type MetricsHandler struct {
+	processor *processors.GatewayProcessor
+}
+
+func NewMetricsHandler(processor *processors.GatewayProcessor) *MetricsHandler {
+	return &MetricsHandler{
+		processor: processor,
+	}
 }
 
-func NewMetricsHandler(processor *processors.GatewayProcessor) *MetricshHandler {
-	return &MetricshHandler{}
+func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	response.Success(w, r, "metrics retrieved", h.processor.GetMetrics())
 }
 
-func (h *MetricshHandler) Metric(w http.ResponseWriter, r *http.Request) {
-	response.Success(w, "gateway healthy", map[string]interface{}{
-		"status": "healthy",
-	})
+// ResetMetrics zeroes the accumulated metrics and returns their values from
+// before the reset. ?reset_start_time=true also restarts the uptime clock.
+func (h *MetricsHandler) ResetMetrics(w http.ResponseWriter, r *http.Request) {
+	resetStartTime := r.URL.Query().Get("reset_start_time") == "true"
+
+	response.Success(w, r, "metrics reset", h.processor.ResetMetrics(resetStartTime))
 }
 
-func (h *HealthHandler) ServiceMetric(w http.ResponseWriter, r *http.Request) {
-	// implementation
+// ServiceMetric returns the metrics of a single service
+func (h *MetricsHandler) ServiceMetric(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)["service"]
+
+	metrics, exists := h.processor.GetMetrics().ServiceMetrics[service]
+	if !exists {
+		response.Error(w, r, http.StatusNotFound, "no metrics for service", map[string]interface{}{
+			"service": service,
+		})
+		return
+	}
+
+	response.Success(w, r, "service metrics retrieved", metrics)
 }
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// gatewayServer serves h.Proxy for the "devices" service over a real
+// connection, so tests see when the gateway flushes
+func gatewayServer(t *testing.T, h *GatewayHandler) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.Proxy(w, mux.SetURLVars(r, map[string]string{"service": "devices"}))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readLine reads the next line of a streamed body, failing if it takes longer
+// than a second
+func readLine(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+
+	line := make(chan string, 1)
+	go func() {
+		text, _ := reader.ReadString('\n')
+		line <- text
+	}()
+	select {
+	case text := <-line:
+		return text
+	case <-time.After(time.Second):
+		t.Fatal("no line received within a second")
+		return ""
+	}
+}
+
+func TestServerSentEventsArriveIncrementally(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 3; i++ {
+			// Each event waits until the client has seen the one before
+			if i > 1 {
+				select {
+				case <-next:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			w.Write([]byte("data: event-" + strconv.Itoa(i) + "\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	gateway := gatewayServer(t, newTestHandler(t, upstream.URL))
+	resp, err := http.Get(gateway.URL + "/api/proxy/devices/events")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Cache-Control") != "no-cache" || resp.Header.Get("X-Accel-Buffering") != "no" {
+		t.Fatalf("Cache-Control = %q, X-Accel-Buffering = %q, want no-cache and no", resp.Header.Get("Cache-Control"), resp.Header.Get("X-Accel-Buffering"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for i := 1; i <= 3; i++ {
+		want := "data: event-" + strconv.Itoa(i) + "\n"
+		if got := readLine(t, reader); got != want {
+			t.Fatalf("event %d = %q, want %q", i, got, want)
+		}
+		if got := readLine(t, reader); strings.TrimSpace(got) != "" {
+			t.Fatalf("event %d not terminated by a blank line: %q", i, got)
+		}
+		if i < 3 {
+			next <- struct{}{}
+		}
+	}
+}
+
+// loggedMessage reports whether a log containing text was published
+func loggedMessage(mr *miniredis.Miniredis, stream, text string) bool {
+	entries, _ := mr.Stream(stream)
+	for _, entry := range entries {
+		for _, value := range entry.Values {
+			if strings.Contains(value, text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestSlowClientIsBoundedAndDisconnected(t *testing.T) {
+	var written atomic.Int64
+	aborted := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(aborted)
+		w.Header().Set("Content-Type", "text/event-stream")
+		event := []byte("data: " + strings.Repeat("x", 1018) + "\n\n")
+		for written.Load() < 256<<20 {
+			n, err := w.Write(event)
+			written.Add(int64(n))
+			if err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	processor, cfg, mr := newTestProcessor(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Streaming.MaxBufferBytes = 4096
+		cfg.Streaming.SlowClientTimeoutSeconds = 1
+	})
+	gateway := gatewayServer(t, NewGatewayHandler(cfg, processor))
+
+	// The client takes the headers and then never reads the body
+	resp, err := http.Get(gateway.URL + "/api/proxy/devices/events")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	select {
+	case <-aborted:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("upstream still streaming after %d bytes, want the slow client disconnected", written.Load())
+	}
+
+	// Only socket buffers and the gateway's read-ahead sit between the two
+	if got := written.Load(); got >= 64<<20 {
+		t.Fatalf("upstream wrote %d bytes before the disconnect, want reads to wait for the client", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !loggedMessage(mr, cfg.Redis.LogsStream, "client too slow") {
+		if time.Now().After(deadline) {
+			t.Fatal("slow client disconnect was not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
+)
+
+// ServiceAccess restricts a proxy route to users whose role is allowed by the
+// matching AUTH_ROUTE_ROLES rule or, without one, by the target service's
+// required roles. service names the target; empty reads the {service} path
+// variable.
+func ServiceAccess(cfg config.AuthConfig, serviceRoles func(service string) []string, service string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target := service
+			if target == "" {
+				target = mux.Vars(r)["service"]
+			}
+
+			roles := cfg.RolesFor(r.URL.Path)
+			if roles == nil {
+				roles = serviceRoles(target)
+			}
+			if len(roles) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userRole, _ := reqctx.RoleFromContext(r.Context())
+			if !slices.Contains(roles, userRole) {
+				response.Error(w, r, http.StatusForbidden, "insufficient permissions", map[string]interface{}{
+					"service":        target,
+					"required_roles": roles,
+					"user_role":      userRole,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
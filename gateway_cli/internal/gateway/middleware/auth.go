@@ -3,7 +3,10 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -11,57 +14,107 @@ import (
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
 	redisClient "github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
 )
 
-// Auth middleware - validates token via Redis Streams
-func Auth(redisClient *redisClient.Client) func(http.Handler) http.Handler {
+// errAuthUnavailable marks validation failures caused by the auth service or
+// Redis not answering, as opposed to a rejected token
+var errAuthUnavailable = errors.New("auth service unavailable")
+
+// Auth middleware - validates token via Redis Streams, optionally falling back
+// to local JWT verification while the auth service is unavailable. Browsers
+// send CORS preflights without credentials, so OPTIONS requests pass through
+// for the CORS middleware to answer, as do the configured bypass paths.
+// Answers are read through responses, created once at startup.
+func Auth(redisClient *redisClient.Client, responses *AuthResponses, cfg config.AuthConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IsPreflight(r) || authBypassed(cfg.BypassPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				response.Error(w, http.StatusUnauthorized, "authorization header required", nil)
+				response.Error(w, r, http.StatusUnauthorized, "authorization header required", nil)
 				return
 			}
 
 			// Extract token from "Bearer <token>"
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				response.Error(w, http.StatusUnauthorized, "invalid authorization format", nil)
+				response.Error(w, r, http.StatusUnauthorized, "invalid authorization format", nil)
 				return
 			}
 
 			token := parts[1]
 
 			// Validate token via Redis Streams
-			user, err := validateTokenViaRedis(redisClient, token)
+			authStart := time.Now()
+			user, err := validateTokenViaRedis(redisClient, responses, cfg, token)
+			if err != nil && cfg.LocalFallback && errors.Is(err, errAuthUnavailable) {
+				var localErr error
+				user, localErr = validateTokenLocally(token, cfg.JWTSecret)
+				redisClient.PublishLog("error", "gateway", "Auth service unavailable, token verified locally", map[string]interface{}{
+					"cause":  err.Error(),
+					"valid":  localErr == nil,
+					"path":   r.URL.Path,
+					"method": r.Method,
+				})
+				err = localErr
+			}
+			if timings := reqctx.PhaseTimingsFromContext(r.Context()); timings != nil {
+				timings.Auth = time.Since(authStart)
+			}
+			if errors.Is(err, errAuthUnavailable) {
+				response.Error(w, r, http.StatusServiceUnavailable, "authentication unavailable", map[string]interface{}{
+					"error": err.Error(),
+				})
+				return
+			}
 			if err != nil {
-				response.Error(w, http.StatusUnauthorized, "invalid token", map[string]interface{}{
+				response.Error(w, r, http.StatusUnauthorized, "invalid token", map[string]interface{}{
 					"error": err.Error(),
 				})
 				return
 			}
 
 			// Add user context
-			ctx := context.WithValue(r.Context(), "user_id", user.ID)
-			ctx = context.WithValue(ctx, "role", user.Role)
-			ctx = context.WithValue(ctx, "email", user.Email)
-			r = r.WithContext(ctx)
+			r = r.WithContext(reqctx.WithUser(r.Context(), user))
+			if logged, ok := w.(*responseWriter); ok {
+				logged.userID = user.ID
+			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// authBypassed reports whether path is served without authentication
+func authBypassed(bypassPaths []string, path string) bool {
+	for _, bypass := range bypassPaths {
+		if prefix, ok := strings.CutSuffix(bypass, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == bypass {
+			return true
+		}
+	}
+	return false
+}
+
 // RequireRole middleware
 func RequireRole(requiredRole string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userRole, ok := r.Context().Value("role").(string)
+			userRole, ok := reqctx.RoleFromContext(r.Context())
 			if !ok || userRole != requiredRole {
-				response.Error(w, http.StatusForbidden, "insufficient permissions", map[string]interface{}{
+				response.Error(w, r, http.StatusForbidden, "insufficient permissions", map[string]interface{}{
 					"required_role": requiredRole,
 					"user_role":     userRole,
 				})
@@ -74,7 +127,7 @@ func RequireRole(requiredRole string) func(http.Handler) http.Handler {
 }
 
 // validateTokenViaRedis sends token validation request via Redis Streams
-func validateTokenViaRedis(redisClient *redisClient.Client, token string) (*models.User, error) {
+func validateTokenViaRedis(redisClient *redisClient.Client, responses *AuthResponses, cfg config.AuthConfig, token string) (*models.User, error) {
 	ctx := context.Background()
 	requestID := uuid.New().String()
 
@@ -90,68 +143,50 @@ func validateTokenViaRedis(redisClient *redisClient.Client, token string) (*mode
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Send to auth-requests stream
-	_, err = redisClient.XAdd(ctx, &redis.XAddArgs{
-		Stream: "auth-requests",
-		Values: map[string]interface{}{
-			"data": string(requestData),
-		},
-	}).Result()
+	// Register before sending so a fast response can't arrive unclaimed
+	responseCh, cancel := responses.wait(requestID)
+	defer cancel()
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to send auth request: %w", err)
+	// Send to auth-requests stream, retrying briefly if Redis is momentarily unreachable
+	for attempt := 0; ; attempt++ {
+		_, err = redisClient.XAdd(ctx, redisClient.StreamEntry(redisClient.AuthRequestsStream(), map[string]interface{}{
+			"data": string(requestData),
+		})).Result()
+		if err == nil || attempt >= cfg.Retries || !isTransientRedisError(err) {
+			break
+		}
+		time.Sleep(time.Duration(cfg.RetryDelayMs) * time.Millisecond)
 	}
 
-	// Listen for response on auth-responses stream with specific consumer group
-	timeout := 5 * time.Second
-	consumerGroup := "gateway-auth"
-	consumerName := "gateway-" + requestID[:8]
-
-	// Create consumer group if it doesn't exist
-	redisClient.XGroupCreateMkStream(ctx, "auth-responses", consumerGroup, "0")
-
-	// Read response
-	streams, err := redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
-		Group:    consumerGroup,
-		Consumer: consumerName,
-		Streams:  []string{"auth-responses", ">"},
-		Count:    1,
-		Block:    timeout,
-	}).Result()
-
 	if err != nil {
-		// Check if it's a timeout or actual error
-		if err == redis.Nil {
-			return nil, fmt.Errorf("timeout waiting for auth response")
-		}
-		return nil, fmt.Errorf("failed to read auth response: %w", err)
+		return nil, fmt.Errorf("%w: failed to send auth request: %v", errAuthUnavailable, err)
 	}
 
-	// Parse response messages
-	for _, stream := range streams {
-		for _, message := range stream.Messages {
-			data, ok := message.Values["data"].(string)
-			if !ok {
-				continue
-			}
-
-			var response models.AuthValidationResponse
-			if err := json.Unmarshal([]byte(data), &response); err != nil {
-				continue
-			}
-
-			// Check if this is our response
-			if response.RequestID == requestID {
-				// Acknowledge the message
-				redisClient.XAck(ctx, "auth-responses", consumerGroup, message.ID)
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-				if !response.Valid {
-					return nil, fmt.Errorf("invalid token: %s", response.Error)
-				}
-				return response.User, nil
-			}
+	select {
+	case response := <-responseCh:
+		if !response.Valid {
+			return nil, fmt.Errorf("invalid token: %s", response.Error)
+		}
+		if response.User == nil {
+			return nil, fmt.Errorf("%w: auth response missing user", errAuthUnavailable)
 		}
+		return response.User, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: timeout waiting for auth response", errAuthUnavailable)
 	}
+}
 
-	return nil, fmt.Errorf("no response received for token validation")
+// isTransientRedisError reports whether a Redis error is a connection problem
+// worth retrying rather than a rejected command
+func isTransientRedisError(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, redis.ErrPoolTimeout):
+		return true
+	}
+	return redis.HasErrorPrefix(err, "LOADING") || redis.HasErrorPrefix(err, "TRYAGAIN")
 }
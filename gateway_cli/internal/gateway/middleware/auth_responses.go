@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	redisClient "github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// legacyAuthGroup is the consumer group earlier gateway versions shared,
+// creating a consumer per request. Current instances use their own group
+// named with it as prefix, e.g. "gateway-auth:<hostname>".
+const legacyAuthGroup = "gateway-auth"
+
+// AuthResponses reads the auth-responses stream through this instance's own
+// consumer group and hands each response to the request waiting for its ID.
+// Every instance has its own group, so each sees every response; within it a
+// fixed pool of named consumers shares the reading, and concurrent requests
+// never consume each other's responses.
+type AuthResponses struct {
+	redis     *redisClient.Client
+	stream    string
+	group     string
+	consumers []string
+	retention time.Duration
+	mu        sync.Mutex
+	waiters   map[string]chan models.AuthValidationResponse
+	stats     models.AuthResponseStats
+}
+
+// NewAuthResponses creates the instance's consumer group and starts its
+// consumers and the reaper
+func NewAuthResponses(redisClient *redisClient.Client, cfg config.AuthConfig) *AuthResponses {
+	ar := &AuthResponses{
+		redis:     redisClient,
+		stream:    redisClient.AuthResponsesStream(),
+		group:     cfg.ConsumerGroup,
+		retention: time.Duration(cfg.ResponseRetentionSeconds) * time.Second,
+		waiters:   make(map[string]chan models.AuthValidationResponse),
+		stats:     models.AuthResponseStats{Group: cfg.ConsumerGroup},
+	}
+	for i := 0; i < max(cfg.Consumers, 1); i++ {
+		ar.consumers = append(ar.consumers, fmt.Sprintf("%s-%d", cfg.ConsumerGroup, i))
+	}
+
+	if err := ar.createGroup(context.Background()); err != nil {
+		redisClient.PublishLog("error", "gateway", "Failed to create auth responses consumer group", map[string]interface{}{
+			"group": ar.group,
+			"error": err.Error(),
+		})
+	}
+
+	for _, consumer := range ar.consumers {
+		go ar.consume(consumer)
+	}
+	go ar.cleanup()
+
+	return ar
+}
+
+// createGroup creates the group at the end of the stream, or keeps the
+// existing one so a restarted instance resumes where it stopped
+func (ar *AuthResponses) createGroup(ctx context.Context) error {
+	err := ar.redis.XGroupCreateMkStream(ctx, ar.stream, ar.group, "$").Err()
+	if err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Stats returns the consumer group's state as of the last reap
+func (ar *AuthResponses) Stats() models.AuthResponseStats {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	stats := ar.stats
+	stats.Waiting = len(ar.waiters)
+	return stats
+}
+
+// wait registers interest in a response before its request is sent; cancel
+// must be called once the caller stops waiting
+func (ar *AuthResponses) wait(requestID string) (<-chan models.AuthValidationResponse, func()) {
+	ch := make(chan models.AuthValidationResponse, 1)
+
+	ar.mu.Lock()
+	ar.waiters[requestID] = ch
+	ar.mu.Unlock()
+
+	return ch, func() {
+		ar.mu.Lock()
+		delete(ar.waiters, requestID)
+		ar.mu.Unlock()
+	}
+}
+
+func (ar *AuthResponses) deliver(resp models.AuthValidationResponse) {
+	ar.mu.Lock()
+	ch, ok := ar.waiters[resp.RequestID]
+	delete(ar.waiters, resp.RequestID)
+	ar.mu.Unlock()
+
+	if ok {
+		ch <- resp
+	}
+}
+
+// consume reads new responses as one of the pool's consumers. Every response
+// is acked once handed over: one nobody here waits for belongs to another
+// instance, which reads it through its own group.
+func (ar *AuthResponses) consume(consumer string) {
+	ctx := context.Background()
+
+	for {
+		streams, err := ar.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    ar.group,
+			Consumer: consumer,
+			Streams:  []string{ar.stream, ">"},
+			Count:    100,
+			Block:    time.Second,
+		}).Result()
+		if err != nil {
+			if redis.HasErrorPrefix(err, "NOGROUP") {
+				// The stream or the group was deleted under us
+				ar.createGroup(ctx)
+				continue
+			}
+			if err != redis.Nil {
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			ids := make([]string, 0, len(stream.Messages))
+			for _, message := range stream.Messages {
+				ids = append(ids, message.ID)
+
+				data, ok := message.Values["data"].(string)
+				if !ok {
+					continue
+				}
+
+				var resp models.AuthValidationResponse
+				if err := json.Unmarshal([]byte(data), &resp); err != nil {
+					continue
+				}
+				ar.deliver(resp)
+			}
+			if len(ids) > 0 {
+				ar.redis.XAck(ctx, ar.stream, ar.group, ids...)
+			}
+		}
+	}
+}
+
+func (ar *AuthResponses) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ar.reap()
+	}
+}
+
+// reap trims answers nobody can still be waiting for, acks the ones a consumer
+// read but never acked, removes consumers idle beyond the retention and the
+// groups of instances that are gone, then records and publishes the group's state
+func (ar *AuthResponses) reap() {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-ar.retention)
+
+	trimmed, err := ar.redis.XTrimMinID(ctx, ar.stream, fmt.Sprintf("%d-0", cutoff.UnixMilli())).Result()
+	if err != nil {
+		return
+	}
+
+	reclaimed := ar.reclaimStale(ctx)
+
+	groups, err := ar.redis.XInfoGroups(ctx, ar.stream).Result()
+	if err != nil {
+		return
+	}
+
+	var removedConsumers, removedGroups int64
+	stats := models.AuthResponseStats{Group: ar.group, CheckedAt: time.Now()}
+	for _, group := range groups {
+		if group.Name != legacyAuthGroup && !strings.HasPrefix(group.Name, legacyAuthGroup+":") {
+			continue
+		}
+		own := group.Name == ar.group
+
+		infos, err := ar.redis.XInfoConsumers(ctx, ar.stream, group.Name).Result()
+		if err != nil {
+			continue
+		}
+
+		remaining := 0
+		for _, info := range infos {
+			idle := info.Idle > ar.retention
+			if idle && !(own && ar.inPool(info.Name)) {
+				if ar.redis.XGroupDelConsumer(ctx, ar.stream, group.Name, info.Name).Err() == nil {
+					removedConsumers++
+					continue
+				}
+			}
+			remaining++
+			if own {
+				stats.Consumers++
+				stats.Pending += info.Pending
+				if idle {
+					stats.IdleConsumers++
+				}
+			}
+		}
+
+		// Every consumer of another instance's group went idle: the instance is gone
+		if !own && len(infos) > 0 && remaining == 0 {
+			if ar.redis.XGroupDestroy(ctx, ar.stream, group.Name).Err() == nil {
+				removedGroups++
+			}
+		}
+	}
+
+	ar.mu.Lock()
+	ar.stats = stats
+	waiting := len(ar.waiters)
+	ar.mu.Unlock()
+
+	ar.redis.PublishMetrics("auth_responses", "gateway", map[string]interface{}{
+		"group":                   ar.group,
+		"waiting":                 waiting,
+		"trimmed":                 trimmed,
+		"reclaimed":               reclaimed,
+		"consumers":               stats.Consumers,
+		"pending":                 stats.Pending,
+		"idle_consumers":          stats.IdleConsumers,
+		"stale_consumers_removed": removedConsumers,
+		"stale_groups_removed":    removedGroups,
+	})
+}
+
+// reclaimStale claims the group's entries left unacked beyond the retention,
+// e.g. by an instance that stopped mid-read, and acks them, as nobody can
+// still be waiting for them. It returns how many were acked.
+func (ar *AuthResponses) reclaimStale(ctx context.Context) int64 {
+	var reclaimed int64
+	start := "0-0"
+
+	for {
+		ids, next, err := ar.redis.XAutoClaimJustID(ctx, &redis.XAutoClaimArgs{
+			Stream:   ar.stream,
+			Group:    ar.group,
+			Consumer: ar.consumers[0],
+			MinIdle:  ar.retention,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return reclaimed
+		}
+		if len(ids) > 0 {
+			acked, err := ar.redis.XAck(ctx, ar.stream, ar.group, ids...).Result()
+			if err != nil {
+				return reclaimed
+			}
+			reclaimed += acked
+		}
+		if next == "0-0" || next == "" {
+			return reclaimed
+		}
+		start = next
+	}
+}
+
+func (ar *AuthResponses) inPool(consumer string) bool {
+	for _, name := range ar.consumers {
+		if name == consumer {
+			return true
+		}
+	}
+	return false
+}
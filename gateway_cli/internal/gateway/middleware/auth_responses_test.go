@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	redisClient "github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// newTestRedis returns a client on miniredis and the default config
+func newTestRedis(t *testing.T) (*redisClient.Client, *miniredis.Miniredis, *config.Config) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.Redis.URL = "redis://" + mr.Addr()
+	cfg.Auth.ConsumerGroup = "gateway-auth:test"
+	cfg.Auth.Consumers = 2
+	cfg.Auth.ResponseRetentionSeconds = 60
+
+	client, err := redisClient.NewClient(cfg.Redis)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, mr, cfg
+}
+
+func sendAuthResponse(t *testing.T, client *redisClient.Client, resp models.AuthValidationResponse) {
+	t.Helper()
+	data, _ := json.Marshal(resp)
+	if err := client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: client.AuthResponsesStream(),
+		Values: map[string]interface{}{"data": string(data)},
+	}).Err(); err != nil {
+		t.Fatalf("send auth response: %v", err)
+	}
+}
+
+// readAs reads one new entry through group as consumer and leaves it unacked.
+// miniredis only tracks consumer idle time through claims, so it claims too.
+func readAs(t *testing.T, client *redisClient.Client, group, consumer string) {
+	t.Helper()
+	ctx := context.Background()
+	stream := client.AuthResponsesStream()
+	client.XGroupCreateMkStream(ctx, stream, group, "0")
+	if err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    1,
+		Block:    -1,
+	}).Err(); err != nil && err != redis.Nil {
+		t.Fatalf("read as %s/%s: %v", group, consumer, err)
+	}
+	// Claiming an entry that isn't pending only marks the consumer as seen
+	if err := client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		Messages: []string{"0-1"},
+	}).Err(); err != nil {
+		t.Fatalf("touch %s/%s: %v", group, consumer, err)
+	}
+}
+
+func groupNames(t *testing.T, client *redisClient.Client) map[string]redis.XInfoGroup {
+	t.Helper()
+	groups, err := client.XInfoGroups(context.Background(), client.AuthResponsesStream()).Result()
+	if err != nil {
+		t.Fatalf("list groups: %v", err)
+	}
+	names := make(map[string]redis.XInfoGroup)
+	for _, group := range groups {
+		names[group.Name] = group
+	}
+	return names
+}
+
+func TestAuthResponsesDeliverThroughOwnGroup(t *testing.T) {
+	client, _, cfg := newTestRedis(t)
+	ar := NewAuthResponses(client, cfg.Auth)
+
+	if _, ok := groupNames(t, client)["gateway-auth:test"]; !ok {
+		t.Fatal("consumer group not created at startup")
+	}
+
+	ch, cancel := ar.wait("req-1")
+	defer cancel()
+	sendAuthResponse(t, client, models.AuthValidationResponse{RequestID: "req-1", Valid: true, User: &models.User{ID: "user-1"}})
+
+	select {
+	case resp := <-ch:
+		if resp.User == nil || resp.User.ID != "user-1" {
+			t.Fatalf("delivered %+v, want user-1", resp)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("response not delivered")
+	}
+
+	// Acked once handed over, and read only by the pool's consumers
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		group := groupNames(t, client)["gateway-auth:test"]
+		if group.Pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending = %d, want 0", group.Pending)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	consumers, err := client.XInfoConsumers(context.Background(), client.AuthResponsesStream(), "gateway-auth:test").Result()
+	if err != nil {
+		t.Fatalf("list consumers: %v", err)
+	}
+	for _, consumer := range consumers {
+		if !ar.inPool(consumer.Name) {
+			t.Errorf("consumer %s isn't one of the pool's", consumer.Name)
+		}
+	}
+}
+
+func TestAuthResponsesReapStaleConsumersAndGroups(t *testing.T) {
+	client, mr, cfg := newTestRedis(t)
+	mr.SetTime(time.Now())
+	// Without its consumers running, so nothing else reads the stream
+	ar := &AuthResponses{
+		redis:     client,
+		stream:    client.AuthResponsesStream(),
+		group:     cfg.Auth.ConsumerGroup,
+		consumers: []string{"gateway-auth:test-0"},
+		retention: time.Duration(cfg.Auth.ResponseRetentionSeconds) * time.Second,
+		waiters:   make(map[string]chan models.AuthValidationResponse),
+	}
+	if err := ar.createGroup(context.Background()); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	// Left behind: a per-request consumer in the legacy group, another
+	// instance that stopped, and a consumer of our group that read without acking
+	sendAuthResponse(t, client, models.AuthValidationResponse{RequestID: "old"})
+	readAs(t, client, legacyAuthGroup, "request-1")
+	readAs(t, client, "gateway-auth:gone", "gateway-auth:gone-0")
+	sendAuthResponse(t, client, models.AuthValidationResponse{RequestID: "older"})
+	readAs(t, client, "gateway-auth:test", "crashed")
+	// Not a gateway group, never touched
+	readAs(t, client, "analytics", "reader")
+	if pending := groupNames(t, client)["gateway-auth:test"].Pending; pending != 1 {
+		t.Fatalf("own group pending before reap = %d, want 1", pending)
+	}
+
+	mr.SetTime(time.Now().Add(ar.retention + time.Minute))
+	ar.reap()
+
+	groups := groupNames(t, client)
+	if _, ok := groups[legacyAuthGroup]; ok {
+		t.Error("legacy group with only stale consumers not removed")
+	}
+	if _, ok := groups["gateway-auth:gone"]; ok {
+		t.Error("group of a stopped instance not removed")
+	}
+	if _, ok := groups["analytics"]; !ok {
+		t.Error("group of another application removed")
+	}
+	own, ok := groups["gateway-auth:test"]
+	if !ok {
+		t.Fatal("own group removed")
+	}
+	if own.Pending != 0 {
+		t.Errorf("own group pending = %d, want stale entries acked", own.Pending)
+	}
+
+	consumers, err := client.XInfoConsumers(context.Background(), client.AuthResponsesStream(), "gateway-auth:test").Result()
+	if err != nil {
+		t.Fatalf("list consumers: %v", err)
+	}
+	for _, consumer := range consumers {
+		if consumer.Name == "crashed" {
+			t.Error("idle consumer outside the pool not removed")
+		}
+	}
+
+	stats := ar.Stats()
+	if stats.Group != "gateway-auth:test" || stats.Pending != 0 || stats.CheckedAt.IsZero() {
+		t.Errorf("stats = %+v, want own group with nothing pending", stats)
+	}
+	// The pool's consumer holds the reclaimed entries' claims and stays
+	if stats.Consumers != 1 || stats.IdleConsumers != 0 {
+		t.Errorf("stats report %d consumers, %d idle, want the pool's one, not idle", stats.Consumers, stats.IdleConsumers)
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	redisClient "github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// runAuthService answers each validation request with the user named after
+// its token, newest first within a batch, until ctx ends
+func runAuthService(ctx context.Context, client *redisClient.Client) {
+	lastID := "0"
+	for ctx.Err() == nil {
+		streams, err := client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{client.AuthRequestsStream(), lastID},
+			Count:   100,
+			Block:   100 * time.Millisecond,
+		}).Result()
+		if err != nil {
+			continue
+		}
+
+		for _, stream := range streams {
+			for i := len(stream.Messages) - 1; i >= 0; i-- {
+				message := stream.Messages[i]
+				var req models.AuthValidationRequest
+				if err := json.Unmarshal([]byte(message.Values["data"].(string)), &req); err != nil {
+					continue
+				}
+				data, _ := json.Marshal(models.AuthValidationResponse{
+					RequestID: req.RequestID,
+					Valid:     true,
+					User:      &models.User{ID: "user-" + req.Token},
+				})
+				client.XAdd(ctx, &redis.XAddArgs{
+					Stream: client.AuthResponsesStream(),
+					Values: map[string]interface{}{"data": string(data)},
+				})
+			}
+			lastID = stream.Messages[len(stream.Messages)-1].ID
+		}
+	}
+}
+
+func TestConcurrentValidationsGetTheirOwnUser(t *testing.T) {
+	client, _, cfg := newTestRedis(t)
+
+	// Two gateway instances share the streams, each with its own group
+	first := NewAuthResponses(client, cfg.Auth)
+	otherCfg := cfg.Auth
+	otherCfg.ConsumerGroup = "gateway-auth:other"
+	second := NewAuthResponses(client, otherCfg)
+	instances := []*AuthResponses{first, second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runAuthService(ctx, client)
+
+	const validations = 50
+	var wg sync.WaitGroup
+	for i := 0; i < validations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token := fmt.Sprintf("token-%d", i)
+			user, err := validateTokenViaRedis(client, instances[i%len(instances)], cfg.Auth, token)
+			if err != nil {
+				t.Errorf("validation %d: %v", i, err)
+				return
+			}
+			if user.ID != "user-"+token {
+				t.Errorf("validation %d got %s, want user-%s", i, user.ID, token)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -2,18 +2,65 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
 )
 
-// CORS middleware
-func CORS() func(http.Handler) http.Handler {
+// CORS middleware - answers preflight requests and adds CORS headers for
+// origins on the allowlist. The request Origin is echoed back rather than "*"
+// whenever credentials are allowed, as browsers reject "*" with credentials.
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	anyOrigin := false
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" {
+			anyOrigin = true
+		}
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Max-Age", "86400")
+			origin := r.Header.Get("Origin")
+			preflight := IsPreflight(r)
+
+			// Responses differ by Origin unless every origin gets "*"
+			if !anyOrigin || cfg.AllowCredentials {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if origin != "" && !originAllowed(cfg.AllowedOrigins, origin) {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			if r.Method == http.MethodOptions {
+			if origin != "" {
+				if anyOrigin && !cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+				if cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				if exposeHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if cfg.MaxAgeSeconds > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSeconds))
+				}
 				w.WriteHeader(http.StatusOK)
 				return
 			}
@@ -22,3 +69,32 @@ func CORS() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// IsPreflight reports whether r is a CORS preflight rather than an OPTIONS
+// request meant for the upstream
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// originAllowed matches an Origin against the allowlist: "*", an exact origin,
+// or a wildcard subdomain such as https://*.example.com (which doesn't match
+// https://example.com itself)
+func originAllowed(allowedOrigins []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range allowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		prefix := scheme + "://"
+		if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+host) && len(origin) > len(prefix)+len(host)+1 {
+			return true
+		}
+	}
+	return false
+}
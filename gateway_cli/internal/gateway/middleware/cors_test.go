@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func testCORS(cfg config.CORSConfig) (http.Handler, *bool) {
+	reached := new(bool)
+	return CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*reached = true
+	})), reached
+}
+
+func corsRequest(handler http.Handler, method, origin string, preflight bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/devices", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	handler, reached := testCORS(config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+	})
+
+	for _, origin := range []string{"https://app.example.com", "https://HOME.example.org"} {
+		*reached = false
+		rec := corsRequest(handler, http.MethodGet, origin, false)
+		if !*reached {
+			t.Fatalf("%s: request not forwarded", origin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Fatalf("%s: Allow-Origin = %q, want the request origin", origin, got)
+		}
+		if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Fatalf("%s: credentials not allowed", origin)
+		}
+		if rec.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+			t.Fatalf("%s: exposed headers = %q", origin, rec.Header().Get("Access-Control-Expose-Headers"))
+		}
+		if rec.Header().Get("Vary") != "Origin" {
+			t.Fatalf("%s: Vary = %q, want Origin", origin, rec.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCORSDisallowedOrigins(t *testing.T) {
+	handler, reached := testCORS(config.CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+	})
+
+	// The bare domain of a wildcard and lookalike hosts are not allowed
+	for _, origin := range []string{"https://evil.com", "https://example.org", "https://app.example.com.evil.com", "http://app.example.com"} {
+		*reached = false
+		rec := corsRequest(handler, http.MethodGet, origin, false)
+		if !*reached {
+			t.Fatalf("%s: simple request not forwarded", origin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Fatalf("%s: Allow-Origin = %q for a disallowed origin", origin, got)
+		}
+
+		*reached = false
+		rec = corsRequest(handler, http.MethodOptions, origin, true)
+		if rec.Code != http.StatusForbidden || *reached {
+			t.Fatalf("%s: preflight status = %d, reached = %v, want 403 and not forwarded", origin, rec.Code, *reached)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler, reached := testCORS(config.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAgeSeconds:  600,
+	})
+
+	rec := corsRequest(handler, http.MethodOptions, "https://any.example.com", true)
+	if rec.Code != http.StatusOK || *reached {
+		t.Fatalf("preflight status = %d, reached = %v, want 200 answered by the gateway", rec.Code, *reached)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+	for header, value := range want {
+		if got := rec.Header().Get(header); got != value {
+			t.Fatalf("%s = %q, want %q", header, got, value)
+		}
+	}
+	if rec.Header().Get("Vary") != "" {
+		t.Fatalf("Vary = %q for a wildcard origin without credentials", rec.Header().Get("Vary"))
+	}
+
+	// OPTIONS without Access-Control-Request-Method goes to the upstream
+	rec = corsRequest(handler, http.MethodOptions, "https://any.example.com", false)
+	if !*reached {
+		t.Fatal("plain OPTIONS request not forwarded")
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestValidateTokenLocally(t *testing.T) {
+	valid := jwt.MapClaims{
+		"user_id": "user-1",
+		"role":    "admin",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}
+
+	user, err := validateTokenLocally(signToken(t, "secret", valid), "secret")
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if user.ID != "user-1" || user.Role != "admin" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	if _, err := validateTokenLocally(signToken(t, "other", valid), "secret"); err == nil {
+		t.Fatal("token signed with another secret accepted")
+	}
+
+	expired := jwt.MapClaims{"user_id": "user-1", "exp": time.Now().Add(-time.Minute).Unix()}
+	if _, err := validateTokenLocally(signToken(t, "secret", expired), "secret"); err == nil {
+		t.Fatal("expired token accepted")
+	}
+}
+
+func TestValidateTokenLocallyRejectsEmptySecret(t *testing.T) {
+	forged := signToken(t, "", jwt.MapClaims{
+		"user_id": "attacker",
+		"role":    "admin",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+
+	if _, err := validateTokenLocally(forged, ""); err == nil {
+		t.Fatal("token signed with an empty secret accepted")
+	}
+}
@@ -1,45 +1,57 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
 )
 
-// Logger middleware
-func Logger(redisClient *redis.Client) func(http.Handler) http.Handler {
+// Logger middleware - writes one structured access log line per request to the
+// console and publishes the same fields to the Redis access-log stream
+func Logger(redisClient *redis.Client, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
-			// Wrap ResponseWriter to capture status code
+			// Wrap ResponseWriter to capture status code and response size
 			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 			next.ServeHTTP(wrapped, r)
 
 			duration := time.Since(start)
 
-			// Log to console
-			fmt.Printf("[%s] %s %s %d - %v\n",
-				start.Format("2006-01-02 15:04:05"),
-				r.Method,
-				r.URL.Path,
-				wrapped.statusCode,
-				duration,
-			)
-
-			// Log to Redis
-			redisClient.PublishLog("info", "gateway", fmt.Sprintf("%s %s", r.Method, r.URL.Path), map[string]interface{}{
-				"method":      r.Method,
-				"path":        r.URL.Path,
-				"status":      wrapped.statusCode,
-				"duration_ms": duration.Milliseconds(),
-				"remote_addr": getClientIP(r),
-				"user_agent":  r.UserAgent(),
-				"request_id":  r.Header.Get("X-Request-ID"),
-			})
+			// RequestID runs after this middleware, so read the ID it responded with
+			fields := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", wrapped.statusCode),
+				slog.Int64("response_bytes", wrapped.bytes),
+				slog.Int64("duration_ms", duration.Milliseconds()),
+				slog.String("request_id", wrapped.Header().Get("X-Request-ID")),
+				slog.String("user_id", wrapped.userID),
+				slog.String("remote_addr", getClientIP(r)),
+				slog.String("user_agent", r.UserAgent()),
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case wrapped.statusCode >= 500:
+				level = slog.LevelError
+			case wrapped.statusCode >= 400:
+				level = slog.LevelWarn
+			}
+			logger.LogAttrs(context.Background(), level, "request", fields...)
+
+			// Log to Redis access-log stream
+			extra := make(map[string]interface{}, len(fields))
+			for _, field := range fields {
+				extra[field.Key] = field.Value.Any()
+			}
+			redisClient.PublishAccessLog(fmt.Sprintf("%s %s", r.Method, r.URL.Path), extra)
 		})
 	}
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerCountsResponseBytes(t *testing.T) {
+	client, mr, _ := newTestRedis(t)
+	var console bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&console, nil))
+
+	body := strings.Repeat("x", 1234)
+	handler := Logger(client, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1234")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body[:1000]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[1000:]))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/devices", nil))
+	if rec.Body.Len() != 1234 || !rec.Flushed {
+		t.Fatalf("client got %d bytes, flushed = %v", rec.Body.Len(), rec.Flushed)
+	}
+
+	var line struct {
+		Status        int   `json:"status"`
+		ResponseBytes int64 `json:"response_bytes"`
+	}
+	if err := json.Unmarshal(console.Bytes(), &line); err != nil {
+		t.Fatalf("console log line %q: %v", console.String(), err)
+	}
+	if line.Status != http.StatusCreated || line.ResponseBytes != 1234 {
+		t.Fatalf("console log status = %d, response_bytes = %d, want 201 and 1234", line.Status, line.ResponseBytes)
+	}
+
+	entries, err := mr.Stream("access-log-stream")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("access log entries = %d, err = %v, want 1", len(entries), err)
+	}
+	values := entries[0].Values
+	for i := 0; i+1 < len(values); i += 2 {
+		if values[i] == "response_bytes" {
+			if values[i+1] != "1234" {
+				t.Fatalf("access log response_bytes = %s, want 1234", values[i+1])
+			}
+			return
+		}
+	}
+	t.Fatalf("access log entry without response_bytes: %v", values)
+}
@@ -1,211 +0,0 @@
-package middleware
-
-import (
-	"context"
-	"fmt"
-	"net/http"
-	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
-
-	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
-	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
-)
-
-// Logger middleware
-func Logger() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-
-			// Wrap ResponseWriter to capture status code
-			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-
-			next.ServeHTTP(wrapped, r)
-
-			duration := time.Since(start)
-
-			// Log request
-			fmt.Printf("[%s] %s %s %d - %v\n",
-				start.Format("2006-01-02 15:04:05"),
-				r.Method,
-				r.URL.Path,
-				wrapped.statusCode,
-				duration,
-			)
-		})
-	}
-}
-
-// Recovery middleware
-func Recovery() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			defer func() {
-				if err := recover(); err != nil {
-					fmt.Printf("Panic recovered: %v\n", err)
-					response.Error(w, http.StatusInternalServerError, "internal server error", nil)
-				}
-			}()
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// CORS middleware
-func CORS() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// RequestID middleware
-func RequestID() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requestID := r.Header.Get("X-Request-ID")
-			if requestID == "" {
-				requestID = uuid.New().String()
-			}
-
-			// Add to context
-			ctx := context.WithValue(r.Context(), "request_id", requestID)
-			r = r.WithContext(ctx)
-
-			// Add to response header
-			w.Header().Set("X-Request-ID", requestID)
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// RateLimit middleware
-func RateLimit(cfg config.RateLimitConfig) func(http.Handler) http.Handler {
-	limiter := NewRateLimiter(cfg)
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientIP := getClientIP(r)
-
-			if !limiter.Allow(clientIP) {
-				response.Error(w, http.StatusTooManyRequests, "rate limit exceeded", map[string]interface{}{
-					"retry_after": "60s",
-				})
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// Auth middleware
-func Auth(cfg config.AuthConfig) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				response.Error(w, http.StatusUnauthorized, "authorization header required", nil)
-				return
-			}
-
-			// Extract token from "Bearer <token>"
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				response.Error(w, http.StatusUnauthorized, "invalid authorization format", nil)
-				return
-			}
-
-			tokenString := parts[1]
-
-			// Parse and validate JWT
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("invalid signing method")
-				}
-				return []byte(cfg.JWTSecret), nil
-			})
-
-			if err != nil || !token.Valid {
-				response.Error(w, http.StatusUnauthorized, "invalid token", nil)
-				return
-			}
-
-			// Extract claims
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				ctx := context.WithValue(r.Context(), "user_id", claims["user_id"])
-				ctx = context.WithValue(ctx, "role", claims["role"])
-				ctx = context.WithValue(ctx, "email", claims["email"])
-				r = r.WithContext(ctx)
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// RequireRole middleware
-func RequireRole(requiredRole string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userRole, ok := r.Context().Value("role").(string)
-			if !ok || userRole != requiredRole {
-				response.Error(w, http.StatusForbidden, "insufficient permissions", map[string]interface{}{
-					"required_role": requiredRole,
-					"user_role":     userRole,
-				})
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// Helper types and functions
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
-}
-
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	if colon := strings.LastIndex(ip, ":"); colon != -1 {
-		ip = ip[:colon]
-	}
-
-	return ip
-}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	redisClient "github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+const rateLimitSnapshotKey = "gateway:ratelimit:snapshot"
+
+// Buckets idle this long are full again, so they aren't worth persisting
+const rateLimitSnapshotTTL = 10 * time.Minute
+
+type bucketSnapshot struct {
+	Tokens     int   `json:"tokens"`
+	LastRefill int64 `json:"last_refill"`
+	RPM        int   `json:"rpm"`
+	Burst      int   `json:"burst"`
+}
+
+// Snapshot saves the buckets to Redis so a restarted gateway doesn't hand
+// every client a fresh burst
+func (rl *RateLimiter) Snapshot(client *redisClient.Client) error {
+	rl.mu.RLock()
+	buckets := make(map[string]interface{}, len(rl.clients))
+	for key, cl := range rl.clients {
+		cl.mu.Lock()
+		data, err := json.Marshal(bucketSnapshot{
+			Tokens:     cl.tokens,
+			LastRefill: cl.lastRefill.UnixNano(),
+			RPM:        cl.rpm,
+			Burst:      cl.burst,
+		})
+		cl.mu.Unlock()
+		if err == nil {
+			buckets[key] = data
+		}
+	}
+	rl.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, rateLimitSnapshotKey)
+	if len(buckets) > 0 {
+		pipe.HSet(ctx, rateLimitSnapshotKey, buckets)
+		pipe.Expire(ctx, rateLimitSnapshotKey, rateLimitSnapshotTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save rate limit snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore loads buckets saved by Snapshot, skipping entries that are already
+// full or were saved under different limits
+func (rl *RateLimiter) Restore(client *redisClient.Client) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	saved, err := client.HGetAll(ctx, rateLimitSnapshotKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load rate limit snapshot: %w", err)
+	}
+
+	restored := 0
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for key, data := range saved {
+		var snapshot bucketSnapshot
+		if json.Unmarshal([]byte(data), &snapshot) != nil || snapshot.RPM <= 0 {
+			continue
+		}
+		lastRefill := time.Unix(0, snapshot.LastRefill)
+		if time.Since(lastRefill) > rateLimitSnapshotTTL || snapshot.Tokens >= snapshot.Burst {
+			continue
+		}
+		rl.clients[key] = &ClientLimiter{
+			tokens:     snapshot.Tokens,
+			lastRefill: lastRefill,
+			rpm:        snapshot.RPM,
+			burst:      snapshot.Burst,
+		}
+		restored++
+	}
+	return restored, nil
+}
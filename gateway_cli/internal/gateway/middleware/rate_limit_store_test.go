@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimitBucketsSurviveRestart(t *testing.T) {
+	client, mr, _ := newTestRedis(t)
+
+	before := testLimiter()
+	for i := 0; i < 3; i++ {
+		before.Allow("10.0.0.1")
+	}
+	before.Allow("10.0.0.2")
+	if err := before.Snapshot(client); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	// Entries idle past the snapshot TTL are full again and aren't restored
+	stale := time.Now().Add(-2 * rateLimitSnapshotTTL).UnixNano()
+	mr.HSet(rateLimitSnapshotKey, "10.0.0.3", fmt.Sprintf(`{"tokens":0,"last_refill":%d,"rpm":1,"burst":2}`, stale))
+
+	after := testLimiter()
+	restored, err := after.Restore(client)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored != 2 {
+		t.Fatalf("restored %d buckets, want 2", restored)
+	}
+
+	if allowed, _, _ := after.Allow("10.0.0.1"); allowed {
+		t.Error("exhausted client got a fresh burst after the restart")
+	}
+	if allowed, remaining, _ := after.Allow("10.0.0.2"); !allowed || remaining != 0 {
+		t.Errorf("partly used client: allowed = %t with %d left, want its last token", allowed, remaining)
+	}
+	if allowed, remaining, _ := after.Allow("10.0.0.3"); !allowed || remaining != 1 {
+		t.Errorf("stale client: allowed = %t with %d left, want a full burst", allowed, remaining)
+	}
+	if allowed, remaining, _ := after.Allow("10.0.0.4"); !allowed || remaining != 1 {
+		t.Errorf("new client: allowed = %t with %d left, want a full burst", allowed, remaining)
+	}
+}
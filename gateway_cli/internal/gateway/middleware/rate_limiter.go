@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/response"
 )
 
@@ -14,11 +18,14 @@ type RateLimiter struct {
 	mu      sync.RWMutex
 	rpm     int
 	burst   int
+	tiers   []config.RateLimitTier
 }
 
 type ClientLimiter struct {
 	tokens     int
 	lastRefill time.Time
+	rpm        int
+	burst      int
 	mu         sync.Mutex
 }
 
@@ -27,6 +34,7 @@ func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
 		clients: make(map[string]*ClientLimiter),
 		rpm:     cfg.RequestsPerMinute,
 		burst:   cfg.BurstSize,
+		tiers:   cfg.Tiers,
 	}
 
 	// Start cleanup routine
@@ -35,69 +43,171 @@ func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
 	return rl
 }
 
-func RateLimit(cfg config.RateLimitConfig) func(http.Handler) http.Handler {
-	limiter := NewRateLimiter(cfg)
-
+// RateLimit limits requests by tier. It runs globally and again after Auth on
+// protected routes and on public routes. The global pass counts requests
+// presenting credentials per IP against the highest configured limit, so bad
+// tokens are limited before Auth rejects them, and defers their tier to the
+// second pass: per user once authenticated, per IP otherwise. Everything else
+// is counted per IP in the global pass.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if reqctx.RateLimited(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, _ := reqctx.UserIDFromContext(r.Context())
+			role, _ := reqctx.RoleFromContext(r.Context())
 			clientIP := getClientIP(r)
+			if userID == "" && r.Header.Get("Authorization") != "" && !reqctx.Authenticated(r.Context()) && !reqctx.RateLimitDeferred(r.Context()) {
+				tier := limiter.credentialsTier()
+				allowed, remaining, reset := limiter.allow(tier.Name+"|ip:"+clientIP, tier.RequestsPerMinute, tier.BurstSize)
+				if !allowed {
+					rejectRateLimited(w, r, tier, remaining, reset, clientIP)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(reqctx.WithRateLimitDeferred(r.Context())))
+				return
+			}
+
+			identity := "ip:" + clientIP
+			if userID != "" {
+				identity = "user:" + userID
+			}
 
-			if !limiter.Allow(clientIP) {
-				response.Error(w, http.StatusTooManyRequests, "rate limit exceeded", map[string]interface{}{
-					"retry_after": "60s",
-					"client_ip":   clientIP,
-				})
+			tier := limiter.tierFor(r.URL.Path, userID, role)
+			allowed, remaining, reset := limiter.allow(tier.Name+"|"+identity, tier.RequestsPerMinute, tier.BurstSize)
+			if !allowed {
+				rejectRateLimited(w, r, tier, remaining, reset, clientIP)
 				return
 			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(tier.BurstSize))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
 
-			next.ServeHTTP(w, r)
+			ctx := reqctx.WithRateLimited(r.Context())
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func (rl *RateLimiter) Allow(clientID string) bool {
+func rejectRateLimited(w http.ResponseWriter, r *http.Request, tier config.RateLimitTier, remaining int, reset time.Time, clientIP string) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(tier.BurstSize))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	retryAfter := int(math.Ceil(time.Until(reset).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	response.Error(w, r, http.StatusTooManyRequests, "rate limit exceeded", map[string]interface{}{
+		"client_ip": clientIP,
+		"tier":      tier.Name,
+	})
+}
+
+// credentialsTier is the limit for requests presenting credentials before they
+// are checked: the highest configured one, so it never throttles a user below
+// their own tier
+func (rl *RateLimiter) credentialsTier() config.RateLimitTier {
+	tier := config.RateLimitTier{
+		Name:              "credentials",
+		RequestsPerMinute: rl.rpm,
+		BurstSize:         rl.burst,
+	}
+	for _, t := range rl.tiers {
+		tier.RequestsPerMinute = max(tier.RequestsPerMinute, t.RequestsPerMinute)
+		tier.BurstSize = max(tier.BurstSize, t.BurstSize)
+	}
+	return tier
+}
+
+// tierFor picks the longest matching path tier, then a role tier, then the
+// user tier for authenticated requests, falling back to the default limit
+func (rl *RateLimiter) tierFor(path, userID, role string) config.RateLimitTier {
+	var pathTier, roleTier, userTier *config.RateLimitTier
+	for i := range rl.tiers {
+		tier := &rl.tiers[i]
+		switch tier.Scope {
+		case config.TierScopePath:
+			if strings.HasPrefix(path, tier.Match) && (pathTier == nil || len(tier.Match) > len(pathTier.Match)) {
+				pathTier = tier
+			}
+		case config.TierScopeRole:
+			if userID != "" && role == tier.Match && roleTier == nil {
+				roleTier = tier
+			}
+		case config.TierScopeUser:
+			if userID != "" && userTier == nil {
+				userTier = tier
+			}
+		}
+	}
+
+	for _, tier := range []*config.RateLimitTier{pathTier, roleTier, userTier} {
+		if tier != nil {
+			return *tier
+		}
+	}
+	return config.RateLimitTier{
+		Name:              "default",
+		RequestsPerMinute: rl.rpm,
+		BurstSize:         rl.burst,
+	}
+}
+
+// Allow takes a token for clientID at the default limit. It returns whether the
+// request is allowed, the tokens left and when the next token is added.
+func (rl *RateLimiter) Allow(clientID string) (bool, int, time.Time) {
+	return rl.allow(clientID, rl.rpm, rl.burst)
+}
+
+func (rl *RateLimiter) allow(key string, rpm, burst int) (bool, int, time.Time) {
 	rl.mu.RLock()
-	client, exists := rl.clients[clientID]
+	client, exists := rl.clients[key]
 	rl.mu.RUnlock()
 
 	if !exists {
-		client = &ClientLimiter{
-			tokens:     rl.burst,
-			lastRefill: time.Now(),
-		}
-
 		rl.mu.Lock()
-		rl.clients[clientID] = client
+		if client, exists = rl.clients[key]; !exists {
+			client = &ClientLimiter{
+				tokens:     burst,
+				lastRefill: time.Now(),
+				rpm:        rpm,
+				burst:      burst,
+			}
+			rl.clients[key] = client
+		}
 		rl.mu.Unlock()
 	}
 
-	return client.allow(rl.rpm, rl.burst)
+	return client.allow()
 }
 
-func (cl *ClientLimiter) allow(rpm, burst int) bool {
+func (cl *ClientLimiter) allow() (bool, int, time.Time) {
 	cl.mu.Lock()
 	defer cl.mu.Unlock()
 
 	now := time.Now()
-	elapsed := now.Sub(cl.lastRefill)
+	interval := time.Minute / time.Duration(cl.rpm)
 
-	// Refill tokens based on elapsed time
-	tokensToAdd := int(elapsed.Seconds() * float64(rpm) / 60.0)
-	cl.tokens += tokensToAdd
-
-	if cl.tokens > burst {
-		cl.tokens = burst
+	// Refill whole tokens, keeping the remainder of a partial interval
+	tokensToAdd := int(now.Sub(cl.lastRefill) / interval)
+	if tokensToAdd > 0 {
+		cl.tokens += tokensToAdd
+		cl.lastRefill = cl.lastRefill.Add(time.Duration(tokensToAdd) * interval)
 	}
 
-	cl.lastRefill = now
+	if cl.tokens >= cl.burst {
+		cl.tokens = cl.burst
+		cl.lastRefill = now
+	}
 
 	// Check if request is allowed
-	if cl.tokens > 0 {
+	allowed := cl.tokens > 0
+	if allowed {
 		cl.tokens--
-		return true
 	}
 
-	return false
+	return allowed, cl.tokens, cl.lastRefill.Add(interval)
 }
 
 func (rl *RateLimiter) cleanup() {
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+)
+
+func testLimiter() *RateLimiter {
+	return NewRateLimiter(config.RateLimitConfig{
+		RequestsPerMinute: 1,
+		BurstSize:         2,
+		Tiers: []config.RateLimitTier{
+			{Name: "admin", Scope: config.TierScopeRole, Match: "admin", RequestsPerMinute: 1, BurstSize: 5},
+		},
+	})
+}
+
+// testAuth stands in for Auth: "Bearer <role>" authenticates as user-<role>,
+// anything else is rejected
+func testAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || role == "bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(reqctx.WithUser(r.Context(), &models.User{ID: "user-" + role, Role: role})))
+	})
+}
+
+// protectedChain mirrors the router: the global pass, Auth, then the second pass
+func protectedChain(limiter *RateLimiter) http.Handler {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return RateLimit(limiter)(testAuth(RateLimit(limiter)(ok)))
+}
+
+// publicChain mirrors a public route: the global pass, then the second pass
+func publicChain(limiter *RateLimiter) http.Handler {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return RateLimit(limiter)(RateLimit(limiter)(ok))
+}
+
+// allowedRequests sends requests until one is limited and returns how many got through
+func allowedRequests(t *testing.T, handler http.Handler, ip, authorization string) int {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+		req.RemoteAddr = ip + ":1234"
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code == http.StatusTooManyRequests {
+			return i
+		}
+	}
+	t.Fatal("requests were never limited")
+	return 0
+}
+
+func TestRateLimitAdminCeilingAboveAnonymous(t *testing.T) {
+	limiter := testLimiter()
+	handler := protectedChain(limiter)
+
+	if got := allowedRequests(t, handler, "10.0.0.1", ""); got != 2 {
+		t.Errorf("anonymous requests allowed = %d, want 2", got)
+	}
+	if got := allowedRequests(t, handler, "10.0.0.2", "Bearer admin"); got != 5 {
+		t.Errorf("admin requests allowed = %d, want 5", got)
+	}
+	if got := allowedRequests(t, handler, "10.0.0.3", "Bearer viewer"); got != 2 {
+		t.Errorf("authenticated viewer requests allowed = %d, want 2", got)
+	}
+}
+
+func TestRateLimitCountsRejectedTokens(t *testing.T) {
+	limiter := testLimiter()
+	handler := protectedChain(limiter)
+
+	// Bad tokens never reach the second pass, but are limited per IP
+	if got := allowedRequests(t, handler, "10.0.0.1", "Bearer bad"); got != 5 {
+		t.Errorf("requests with a rejected token allowed = %d, want 5", got)
+	}
+}
+
+func TestRateLimitJunkHeaderOnPublicRoute(t *testing.T) {
+	limiter := testLimiter()
+	handler := publicChain(limiter)
+
+	if got := allowedRequests(t, handler, "10.0.0.1", "Bearer junk"); got != 2 {
+		t.Errorf("public requests with a junk header allowed = %d, want the anonymous 2", got)
+	}
+}
@@ -29,7 +29,7 @@ func Recovery(redisClient *redis.Client) func(http.Handler) http.Handler {
 						"request_id": r.Header.Get("X-Request-ID"),
 					})
 
-					response.Error(w, http.StatusInternalServerError, "internal server error", nil)
+					response.Error(w, r, http.StatusInternalServerError, "internal server error", nil)
 				}
 			}()
 
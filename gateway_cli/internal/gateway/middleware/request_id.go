@@ -1,23 +1,39 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
+	"regexp"
 
 	"github.com/google/uuid"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
 )
 
-// RequestID middleware
-func RequestID() func(http.Handler) http.Handler {
+// Client IDs in validate mode: 1-128 chars, no spaces or control characters
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID middleware. Also attaches the client IP, so later stages key on it
+// the same way the rate limiter does.
+func RequestID(mode string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			requestID := r.Header.Get("X-Request-ID")
+			switch mode {
+			case config.RequestIDGenerate:
+				requestID = ""
+			case config.RequestIDValidate:
+				if !validRequestID.MatchString(requestID) {
+					requestID = ""
+				}
+			}
 			if requestID == "" {
 				requestID = uuid.New().String()
 			}
 
 			// Add to context
-			ctx := context.WithValue(r.Context(), "request_id", requestID)
+			ctx := reqctx.WithRequestID(r.Context(), requestID)
+			ctx = reqctx.WithClientIP(ctx, getClientIP(r))
 			r = r.WithContext(ctx)
 
 			// Add to response header
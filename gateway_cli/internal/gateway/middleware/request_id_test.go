@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+)
+
+func TestRequestIDModes(t *testing.T) {
+	const malformed = "bad id <script>"
+	const wellFormed = "trace-42"
+
+	tests := []struct {
+		mode     string
+		clientID string
+		want     string // empty: a freshly generated UUID
+	}{
+		{config.RequestIDAccept, malformed, malformed},
+		{config.RequestIDAccept, wellFormed, wellFormed},
+		{config.RequestIDValidate, malformed, ""},
+		{config.RequestIDValidate, wellFormed, wellFormed},
+		{config.RequestIDGenerate, malformed, ""},
+		{config.RequestIDGenerate, wellFormed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.clientID, func(t *testing.T) {
+			var contextID string
+			handler := RequestID(tt.mode)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID, _ = reqctx.RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+			req.Header["X-Request-Id"] = []string{tt.clientID}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if tt.want != "" {
+				if contextID != tt.want {
+					t.Fatalf("request ID = %q, want the client's %q", contextID, tt.want)
+				}
+			} else if _, err := uuid.Parse(contextID); err != nil || contextID == tt.clientID {
+				t.Fatalf("request ID = %q, want a generated UUID", contextID)
+			}
+			if got := rec.Header().Get("X-Request-ID"); got != contextID {
+				t.Fatalf("response X-Request-ID = %q, want %q", got, contextID)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+)
+
+// RequestTag tags requests carrying the configured header. Values are mapped
+// to a bounded set of tags, anything else is tagged "other".
+func RequestTag(cfg config.MetricsConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.TagHeader == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			value := r.Header.Get(cfg.TagHeader)
+			if value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tag, ok := cfg.Tags[value]
+			if !ok {
+				tag = "other"
+			}
+
+			ctx := reqctx.WithRequestTag(r.Context(), tag)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
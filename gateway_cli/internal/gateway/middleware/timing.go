@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+)
+
+// Timing middleware - records when the request arrived so later phases can be
+// measured against the request budget
+func Timing() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timings := &models.PhaseTimings{Start: time.Now()}
+
+			ctx := reqctx.WithPhaseTimings(r.Context(), timings)
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
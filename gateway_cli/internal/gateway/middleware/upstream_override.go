@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// UpstreamOverride strips the X-Upstream-Target header unless the request
+// comes directly from a trusted network. Only the socket address is checked,
+// since forwarded-for headers can be set by anyone.
+func UpstreamOverride(trusted []string) func(http.Handler) http.Handler {
+	var networks []*net.IPNet
+	for _, entry := range trusted {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Upstream-Target") != "" && !trustedAddr(r.RemoteAddr, networks) {
+				r.Header.Del("X-Upstream-Target")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func trustedAddr(remoteAddr string, networks []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamOverride(t *testing.T) {
+	handler := func(trusted []string) (http.Handler, *string) {
+		target := new(string)
+		return UpstreamOverride(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*target = r.Header.Get("X-Upstream-Target")
+		})), target
+	}
+
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  string
+		kept       bool
+	}{
+		{"trusted network", []string{"10.0.0.0/8"}, "10.1.2.3:51000", "", true},
+		{"trusted single address", []string{"192.168.1.5"}, "192.168.1.5:51000", "", true},
+		{"trusted IPv6 address", []string{"::1"}, "[::1]:51000", "", true},
+		{"untrusted address", []string{"10.0.0.0/8"}, "203.0.113.7:51000", "", false},
+		{"spoofed forwarded-for", []string{"10.0.0.0/8"}, "203.0.113.7:51000", "10.1.2.3", false},
+		{"neighbouring address", []string{"192.168.1.5"}, "192.168.1.6:51000", "", false},
+		{"override disabled", nil, "10.1.2.3:51000", "", false},
+		{"invalid entries ignored", []string{"not-an-ip", "10.0.0.0/33"}, "10.1.2.3:51000", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, target := handler(tt.trusted)
+			req := httptest.NewRequest(http.MethodGet, "/api/proxy/devices/list", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Upstream-Target", "http://devices-2:8080")
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if kept := *target != ""; kept != tt.kept {
+				t.Fatalf("override kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
@@ -1,14 +1,19 @@
 package middleware
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"strings"
 )
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture status code, body bytes
+// written and, once Auth has run, the user for the access log
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
+	userID     string
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -16,6 +21,27 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush and Hijack pass through for handlers that type-assert the writer
+// instead of using http.ResponseController
+func (rw *responseWriter) Flush() {
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (Flush, deadlines)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // getClientIP extracts client IP from request
 func getClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"io"
+	"net/http"
 	"time"
 )
 
@@ -8,6 +11,7 @@ type ProxyRequest struct {
 	Service   string            `json:"service"`
 	Method    string            `json:"method"`
 	Path      string            `json:"path"`
+	Route     string            `json:"route,omitempty"`
 	Body      interface{}       `json:"body,omitempty"`
 	Headers   map[string]string `json:"headers,omitempty"`
 	UserID    string            `json:"user_id,omitempty"`
@@ -16,20 +20,105 @@ type ProxyRequest struct {
 }
 
 type ProxyResponse struct {
-	StatusCode int               `json:"status_code"`
-	Body       interface{}       `json:"body,omitempty"`
-	Headers    map[string]string `json:"headers,omitempty"`
-	Duration   time.Duration     `json:"duration"`
-	Error      string            `json:"error,omitempty"`
+	StatusCode int `json:"status_code"`
+	// Body holds the upstream bytes as received, whatever the content type
+	Body     []byte        `json:"-"`
+	Headers  http.Header   `json:"headers,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// Stream is set instead of Body for streamed responses; the caller must close it
+	Stream io.ReadCloser `json:"-"`
+}
+
+// AggregateResult is the outcome of one part of an aggregate route
+type AggregateResult struct {
+	Status     string      `json:"status"` // "ok", "error", "timeout"
+	StatusCode int         `json:"status_code,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+// TestProxyRequest is an admin-supplied request sent to a service through the proxy path
+type TestProxyRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// TestProxyResult is the full upstream response to a test request
+type TestProxyResult struct {
+	Service    string      `json:"service"`
+	Instance   string      `json:"instance"`
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       interface{} `json:"body,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+// ServiceRegistration is a backend registered at runtime through the admin API
+type ServiceRegistration struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	HealthCheck string `json:"healthcheck,omitempty"`
+	Timeout     int    `json:"timeout,omitempty"`
+}
+
+// ServiceRegistryDiff lists how a reload changed the service registry
+type ServiceRegistryDiff struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []string `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+}
+
+type AggregateResponse struct {
+	Results map[string]*AggregateResult `json:"results"`
+	// Partial is set when at least one part missed the budget
+	Partial  bool  `json:"partial"`
+	BudgetMs int64 `json:"budget_ms"`
+}
+
+// PhaseTimings tracks where a request's time went before it reached the upstream
+type PhaseTimings struct {
+	Start time.Time
+	Auth  time.Duration
 }
 
 type HealthCheckResult struct {
 	Service   string        `json:"service"`
-	Status    string        `json:"status"` // "healthy", "unhealthy"
+	Status    string        `json:"status"` // "healthy", "degraded", "unhealthy", "starting"
 	URL       string        `json:"url"`
 	Duration  time.Duration `json:"duration"`
 	Error     string        `json:"error,omitempty"`
 	Timestamp time.Time     `json:"timestamp"`
+	// Circuit is the circuit breaker state, if breaking is enabled
+	Circuit string `json:"circuit,omitempty"`
+	// Instances maps each instance URL to its status for multi-instance services
+	Instances map[string]string `json:"instances,omitempty"`
+	// DependencyDown names the failed service at the root of a dependency chain
+	// when this one was marked unhealthy because of it
+	DependencyDown string `json:"dependency_down,omitempty"`
+	// Flapping is set when the status changed too often within the flap window
+	Flapping bool `json:"flapping,omitempty"`
+}
+
+// HealthHistoryEntry is one recorded health check
+type HealthHistoryEntry struct {
+	Status     string    `json:"status"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// HealthHistory lists a service's recent health checks, oldest first
+type HealthHistory struct {
+	Service  string               `json:"service"`
+	Flapping bool                 `json:"flapping"`
+	Changes  int                  `json:"changes"`
+	Entries  []HealthHistoryEntry `json:"entries"`
 }
 
 type MetricsEvent struct {
@@ -46,9 +135,10 @@ type MetricsEvent struct {
 }
 
 type User struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID    string   `json:"id"`
+	Email string   `json:"email"`
+	Role  string   `json:"role"`
+	Flags []string `json:"flags,omitempty"`
 }
 
 type AuthValidationRequest struct {
@@ -63,3 +153,14 @@ type AuthValidationResponse struct {
 	User      *User  `json:"user,omitempty"`
 	Error     string `json:"error,omitempty"`
 }
+
+// AuthResponseStats describes this instance's consumer group on the
+// auth-responses stream, as of the last reap
+type AuthResponseStats struct {
+	Group         string    `json:"group"`
+	Consumers     int64     `json:"consumers"`
+	Pending       int64     `json:"pending"`
+	IdleConsumers int64     `json:"idle_consumers"`
+	Waiting       int       `json:"waiting"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
@@ -0,0 +1,79 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+type aggregatePartResult struct {
+	name   string
+	result *models.AggregateResult
+}
+
+// Aggregate fans out to every part of an aggregate route and returns whatever
+// arrived within the route budget. Parts still running are marked as timed out
+// and left to finish in the background.
+func (gp *GatewayProcessor) Aggregate(ctx context.Context, route config.AggregateRoute, routeTemplate string, headers map[string]string, userID string) *models.AggregateResponse {
+	startTime := time.Now()
+	budget := time.Duration(route.BudgetMillis) * time.Millisecond
+
+	// Buffered so laggards can finish after we stop waiting
+	results := make(chan aggregatePartResult, len(route.Parts))
+	for _, part := range route.Parts {
+		go func(p config.AggregatePart) {
+			partStart := time.Now()
+			result := &models.AggregateResult{}
+
+			// Not cancelled with the client request: laggards may finish after the response
+			proxyResp, err := gp.ProxyRequest(context.WithoutCancel(ctx), p.Service, routeTemplate, p.Path, http.MethodGet, nil, headers, userID, nil)
+			if err != nil {
+				result.Status = "error"
+				result.Error = err.Error()
+			} else {
+				result.Status = "ok"
+				result.StatusCode = proxyResp.StatusCode
+				result.Body = decodeBody(proxyResp.Body)
+				if proxyResp.Stream != nil {
+					proxyResp.Stream.Close()
+				}
+			}
+			result.DurationMs = time.Since(partStart).Milliseconds()
+
+			results <- aggregatePartResult{name: p.Name, result: result}
+		}(part)
+	}
+
+	resp := &models.AggregateResponse{
+		Results:  make(map[string]*models.AggregateResult, len(route.Parts)),
+		BudgetMs: int64(route.BudgetMillis),
+	}
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+
+collect:
+	for range route.Parts {
+		select {
+		case part := <-results:
+			resp.Results[part.name] = part.result
+		case <-timer.C:
+			break collect
+		}
+	}
+
+	for _, part := range route.Parts {
+		if _, done := resp.Results[part.Name]; !done {
+			resp.Partial = true
+			resp.Results[part.Name] = &models.AggregateResult{
+				Status:     "timeout",
+				DurationMs: time.Since(startTime).Milliseconds(),
+			}
+		}
+	}
+
+	return resp
+}
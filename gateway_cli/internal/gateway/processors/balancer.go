@@ -0,0 +1,129 @@
+package processors
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// ServiceBalancer picks an upstream instance for a service using smooth
+// weighted round-robin
+type ServiceBalancer struct {
+	instances []string
+	weights   []int
+	current   []int
+	unhealthy map[string]bool
+	outliers  *OutlierDetector
+	mu        sync.Mutex
+}
+
+func NewServiceBalancer(serviceInfo *config.ServiceInfo, outlierCfg config.OutlierConfig) *ServiceBalancer {
+	instances := serviceInfo.Instances
+	if len(instances) == 0 {
+		instances = []string{serviceInfo.URL}
+	}
+
+	weights := make([]int, len(instances))
+	for i := range instances {
+		weights[i] = 1
+		if i < len(serviceInfo.InstanceWeights) && serviceInfo.InstanceWeights[i] > 0 {
+			weights[i] = serviceInfo.InstanceWeights[i]
+		}
+	}
+
+	balancer := &ServiceBalancer{
+		instances: instances,
+		weights:   weights,
+		current:   make([]int, len(instances)),
+		unhealthy: make(map[string]bool),
+	}
+
+	if outlierCfg.Enabled {
+		balancer.outliers = NewOutlierDetector(outlierCfg)
+	}
+
+	return balancer
+}
+
+// Pick returns the next healthy, admitted instance. If every instance is
+// unhealthy or ejected the full pool is used, since sending traffic somewhere
+// beats failing outright.
+func (b *ServiceBalancer) Pick() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if i := b.pickLocked(true, true); i != -1 {
+		return b.instances[i]
+	}
+	return b.instances[b.pickLocked(false, true)]
+}
+
+// Peek returns the instance Pick would return next without advancing the
+// rotation, so side traffic such as test requests doesn't shift production load
+func (b *ServiceBalancer) Peek() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if i := b.pickLocked(true, false); i != -1 {
+		return b.instances[i]
+	}
+	return b.instances[b.pickLocked(false, false)]
+}
+
+func (b *ServiceBalancer) pickLocked(onlyAvailable, advance bool) int {
+	best, bestScore, total := -1, 0, 0
+	for i, instance := range b.instances {
+		if onlyAvailable && (b.unhealthy[instance] || (b.outliers != nil && b.outliers.Ejected(instance))) {
+			continue
+		}
+		score := b.current[i] + b.weights[i]
+		if advance {
+			b.current[i] = score
+		}
+		total += b.weights[i]
+		if best == -1 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best != -1 && advance {
+		b.current[best] -= total
+	}
+	return best
+}
+
+// Instances returns the instance URLs in the balancer
+func (b *ServiceBalancer) Instances() []string {
+	return b.instances
+}
+
+// Lookup returns the configured instance matching target, ignoring a trailing slash
+func (b *ServiceBalancer) Lookup(target string) (string, bool) {
+	target = strings.TrimRight(target, "/")
+	for _, instance := range b.instances {
+		if strings.TrimRight(instance, "/") == target {
+			return instance, true
+		}
+	}
+	return "", false
+}
+
+// SetInstanceHealth records the latest health check outcome for an instance
+func (b *ServiceBalancer) SetInstanceHealth(instance string, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if healthy {
+		delete(b.unhealthy, instance)
+	} else {
+		b.unhealthy[instance] = true
+	}
+}
+
+// Observe records the latency of a completed request; returns true if the instance was ejected
+func (b *ServiceBalancer) Observe(instance string, latency time.Duration) bool {
+	if b.outliers == nil {
+		return false
+	}
+	return b.outliers.Observe(instance, latency)
+}
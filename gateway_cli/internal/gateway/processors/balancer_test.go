@@ -0,0 +1,106 @@
+package processors
+
+import (
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func newTestBalancer(weights ...int) *ServiceBalancer {
+	info := config.NewServiceInfo("devices", "http://a", "", 5)
+	info.Instances = []string{"http://a", "http://b", "http://c"}[:len(weights)]
+	info.InstanceWeights = weights
+	return NewServiceBalancer(&info, config.OutlierConfig{})
+}
+
+func pickCounts(b *ServiceBalancer, picks int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < picks; i++ {
+		counts[b.Pick()]++
+	}
+	return counts
+}
+
+func TestBalancerFollowsWeights(t *testing.T) {
+	b := newTestBalancer(5, 1, 1)
+
+	counts := pickCounts(b, 70)
+	if counts["http://a"] != 50 || counts["http://b"] != 10 || counts["http://c"] != 10 {
+		t.Fatalf("picks = %v, want 50/10/10", counts)
+	}
+
+	// Smooth: the heavy instance never takes a whole cycle in one run
+	run, longest := 0, 0
+	for i := 0; i < 7; i++ {
+		if b.Pick() == "http://a" {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	if longest >= 5 {
+		t.Fatalf("heavy instance picked %d times in a row", longest)
+	}
+}
+
+func TestBalancerDefaultsMissingWeights(t *testing.T) {
+	info := config.NewServiceInfo("devices", "http://a", "", 5)
+	info.Instances = []string{"http://a", "http://b"}
+	info.InstanceWeights = []int{0}
+	b := NewServiceBalancer(&info, config.OutlierConfig{})
+
+	if counts := pickCounts(b, 10); counts["http://a"] != 5 || counts["http://b"] != 5 {
+		t.Fatalf("picks = %v, want an even split", counts)
+	}
+}
+
+func TestBalancerSkipsUnhealthyInstances(t *testing.T) {
+	b := newTestBalancer(1, 1, 1)
+	b.SetInstanceHealth("http://b", false)
+
+	counts := pickCounts(b, 10)
+	if counts["http://b"] != 0 || counts["http://a"] != 5 || counts["http://c"] != 5 {
+		t.Fatalf("picks = %v, want b excluded and a/c even", counts)
+	}
+
+	b.SetInstanceHealth("http://b", true)
+	if counts := pickCounts(b, 30); counts["http://b"] == 0 {
+		t.Fatalf("picks = %v, recovered instance never picked", counts)
+	}
+}
+
+func TestBalancerUsesFullPoolWhenAllUnhealthy(t *testing.T) {
+	b := newTestBalancer(1, 1)
+	b.SetInstanceHealth("http://a", false)
+	b.SetInstanceHealth("http://b", false)
+
+	if counts := pickCounts(b, 10); counts["http://a"] != 5 || counts["http://b"] != 5 {
+		t.Fatalf("picks = %v, want traffic spread over the full pool", counts)
+	}
+}
+
+func TestBalancerPeekDoesNotAdvance(t *testing.T) {
+	b := newTestBalancer(2, 1)
+
+	for i := 0; i < 6; i++ {
+		next := b.Peek()
+		if b.Peek() != next {
+			t.Fatal("consecutive peeks disagree")
+		}
+		if got := b.Pick(); got != next {
+			t.Fatalf("pick %d = %s, peek said %s", i, got, next)
+		}
+	}
+}
+
+func TestBalancerLookupOnlyConfiguredInstances(t *testing.T) {
+	b := newTestBalancer(1, 1)
+
+	if instance, ok := b.Lookup("http://b/"); !ok || instance != "http://b" {
+		t.Fatalf("lookup = %q, %v, want the configured instance", instance, ok)
+	}
+	if _, ok := b.Lookup("http://attacker.example.com"); ok {
+		t.Fatal("lookup accepted an unconfigured target")
+	}
+}
@@ -0,0 +1,72 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// captureBodies logs the bodies of a proxied request for debugging. JSON bodies
+// are logged with sensitive fields masked; other bodies only by size.
+func (gp *GatewayProcessor) captureBodies(service, method, path string, status int, requestID string, requestBody, responseBody []byte) {
+	maxBytes := gp.config.Logging.CaptureMaxBytes
+	redact := make(map[string]bool, len(gp.config.Logging.CaptureRedactFields))
+	for _, field := range gp.config.Logging.CaptureRedactFields {
+		redact[strings.ToLower(field)] = true
+	}
+
+	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Captured bodies for %s %s", method, path), map[string]interface{}{
+		"service":       service,
+		"method":        method,
+		"path":          path,
+		"status":        status,
+		"request_id":    requestID,
+		"request_body":  captureBody(requestBody, maxBytes, redact),
+		"response_body": captureBody(responseBody, maxBytes, redact),
+	})
+}
+
+// captureBody renders a body for the logs: redacted JSON, cut to maxBytes
+func captureBody(body []byte, maxBytes int, redact map[string]bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return fmt.Sprintf("[%d bytes, not JSON]", len(body))
+	}
+
+	redacted, err := json.Marshal(redactJSON(value, redact))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes, not JSON]", len(body))
+	}
+	if len(redacted) > maxBytes {
+		return string(redacted[:maxBytes]) + fmt.Sprintf("...[truncated, %d bytes]", len(redacted))
+	}
+	return string(redacted)
+}
+
+// redactJSON masks the values of keys in redact, at any depth
+func redactJSON(value interface{}, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redact[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactJSON(field, redact)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item, redact)
+		}
+	}
+	return value
+}
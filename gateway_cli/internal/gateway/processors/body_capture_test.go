@@ -0,0 +1,72 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// capturedBodies returns the fields of the last body capture log entry
+func capturedBodies(t *testing.T, mr *miniredis.Miniredis) map[string]string {
+	t.Helper()
+
+	entries, _ := mr.Stream("logs-stream")
+	for i := len(entries) - 1; i >= 0; i-- {
+		fields := make(map[string]string)
+		values := entries[i].Values
+		for j := 0; j+1 < len(values); j += 2 {
+			fields[values[j]] = values[j+1]
+		}
+		if strings.HasPrefix(fields["message"], "Captured bodies") {
+			return fields
+		}
+	}
+	t.Fatal("no body capture logged")
+	return nil
+}
+
+func TestBodyCaptureRedactsAndTruncates(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"xyz","note":"` + strings.Repeat("n", 200) + `"}`))
+	}))
+	defer upstream.Close()
+
+	info := config.NewServiceInfo("devices", upstream.URL, "", 5)
+	info.CaptureBodies = true
+	gp, mr := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, func(cfg *config.Config) {
+		cfg.Logging.CaptureMaxBytes = 64
+		cfg.Logging.CaptureRedactFields = []string{"password", "token", "access_token", "secret"}
+	})
+
+	body := `{"user":"a","Password":"hunter2","x":{"token":"t1"}}`
+	if _, err := gp.ProxyRequest(context.Background(), "devices", "/api/login", "/api/login", http.MethodPost, strings.NewReader(body), nil, "", nil); err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+
+	fields := capturedBodies(t, mr)
+	request := fields["request_body"]
+	for _, secret := range []string{"hunter2", "t1"} {
+		if strings.Contains(request, secret) {
+			t.Fatalf("captured request %s leaks %q", request, secret)
+		}
+	}
+	if request != `{"Password":"[REDACTED]","user":"a","x":{"token":"[REDACTED]"}}` {
+		t.Fatalf("captured request = %s, want sensitive keys masked and the rest kept", request)
+	}
+
+	response := fields["response_body"]
+	if strings.Contains(response, "xyz") {
+		t.Fatalf("captured response %s leaks the token", response)
+	}
+	kept, suffix, truncated := strings.Cut(response, "...[truncated, ")
+	if !truncated || len(kept) != 64 || suffix != "239 bytes]" {
+		t.Fatalf("captured response = %q, want 64 bytes and a truncation note", response)
+	}
+}
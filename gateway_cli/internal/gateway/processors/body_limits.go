@@ -0,0 +1,70 @@
+package processors
+
+import (
+	"errors"
+	"io"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// ErrRequestBodyTooLarge is returned for request bodies over the service's limit
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+// ErrResponseBodyTooLarge is returned for upstream responses over the service's limit
+var ErrResponseBodyTooLarge = errors.New("upstream response too large")
+
+// bodyLimits returns the request and response body limits of a service, 0 meaning no limit
+func (gp *GatewayProcessor) bodyLimits(serviceInfo *config.ServiceInfo) (requestLimit, responseLimit int64) {
+	requestLimit = gp.config.Server.MaxRequestBodyBytes
+	if serviceInfo.MaxRequestBodyBytes > 0 {
+		requestLimit = serviceInfo.MaxRequestBodyBytes
+	}
+	responseLimit = gp.config.Server.MaxResponseBodyBytes
+	if serviceInfo.MaxResponseBodyBytes > 0 {
+		responseLimit = serviceInfo.MaxResponseBodyBytes
+	}
+	return requestLimit, responseLimit
+}
+
+// readRequestBody reads body, buffering at most one byte past limit before
+// giving up with ErrRequestBodyTooLarge
+func readRequestBody(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(body)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrRequestBodyTooLarge
+	}
+	return data, nil
+}
+
+// limitedStream relays at most limit bytes of a streamed response and then
+// fails with ErrResponseBodyTooLarge, since the status has already been sent
+type limitedStream struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func limitStream(reader io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return reader
+	}
+	return &limitedStream{reader: reader, limit: limit}
+}
+
+func (s *limitedStream) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.read += int64(n)
+	if s.read > s.limit {
+		n -= int(s.read - s.limit)
+		s.read = s.limit
+		return n, ErrResponseBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,73 @@
+package processors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// Request phases measured against the request budget
+const (
+	PhaseAuth     = "auth"
+	PhaseQueue    = "queue"
+	PhaseUpstream = "upstream"
+)
+
+// BudgetExhaustedError is returned when a request runs out of its overall time
+// budget. Phase names the phase that consumed most of it, so a slow auth
+// round-trip isn't reported as a slow upstream.
+type BudgetExhaustedError struct {
+	Phase  string
+	Phases map[string]time.Duration
+}
+
+func (e *BudgetExhaustedError) Error() string {
+	return fmt.Sprintf("request budget exhausted in %s phase", e.Phase)
+}
+
+// Code returns a machine-readable error code, e.g. "BUDGET_EXHAUSTED_AUTH"
+func (e *BudgetExhaustedError) Code() string {
+	return "BUDGET_EXHAUSTED_" + strings.ToUpper(e.Phase)
+}
+
+// PhasesMillis returns the phase timings in milliseconds for error details
+func (e *BudgetExhaustedError) PhasesMillis() map[string]int64 {
+	phases := make(map[string]int64, len(e.Phases))
+	for phase, duration := range e.Phases {
+		phases[phase] = duration.Milliseconds()
+	}
+	return phases
+}
+
+// budgetDeadline returns when the request budget runs out. ok is false if the
+// budget is disabled or the request wasn't timed.
+func (gp *GatewayProcessor) budgetDeadline(timings *models.PhaseTimings) (time.Time, bool) {
+	if gp.config.Server.RequestBudgetSeconds <= 0 || timings == nil {
+		return time.Time{}, false
+	}
+	return timings.Start.Add(time.Duration(gp.config.Server.RequestBudgetSeconds) * time.Second), true
+}
+
+// budgetExhausted attributes an exhausted budget to the phase that spent most of it.
+// Queue is whatever time isn't auth, from arrival until the upstream call started.
+func budgetExhausted(timings *models.PhaseTimings, dispatchStart time.Time) *BudgetExhaustedError {
+	phases := map[string]time.Duration{
+		PhaseAuth:     timings.Auth,
+		PhaseQueue:    max(dispatchStart.Sub(timings.Start)-timings.Auth, 0),
+		PhaseUpstream: max(time.Since(dispatchStart), 0),
+	}
+
+	phase := PhaseUpstream
+	for _, candidate := range []string{PhaseAuth, PhaseQueue} {
+		if phases[candidate] > phases[phase] {
+			phase = candidate
+		}
+	}
+
+	return &BudgetExhaustedError{
+		Phase:  phase,
+		Phases: phases,
+	}
+}
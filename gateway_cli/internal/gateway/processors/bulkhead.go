@@ -0,0 +1,205 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+)
+
+// ErrBulkheadFull is returned when a service is at its concurrency limit and the
+// request couldn't be queued or waited too long in the queue
+var ErrBulkheadFull = errors.New("service at capacity")
+
+// Per-client wait stats are kept for at most this many clients
+const maxTrackedClients = 100
+
+type bulkheadWaiter struct {
+	ready    chan struct{}
+	admitted bool
+}
+
+type clientWait struct {
+	count   int64
+	totalMs float64
+}
+
+// Bulkhead limits concurrent requests to a service. Requests over the limit wait
+// in a bounded queue with per-client FIFOs that are admitted round-robin, so a
+// single heavy client can't starve the others.
+type Bulkhead struct {
+	mu        sync.Mutex
+	limit     int
+	cfg       config.BulkheadConfig
+	active    int
+	queued    int
+	queues    map[string][]*bulkheadWaiter
+	order     []string
+	waitStats map[string]*clientWait
+}
+
+func NewBulkhead(limit int, cfg config.BulkheadConfig) *Bulkhead {
+	return &Bulkhead{
+		limit:     limit,
+		cfg:       cfg,
+		queues:    make(map[string][]*bulkheadWaiter),
+		waitStats: make(map[string]*clientWait),
+	}
+}
+
+// Acquire takes a slot for client, queueing if the service is saturated. A
+// queued request gives up when ctx ends, returning its error. Every successful
+// Acquire must be followed by Release.
+func (b *Bulkhead) Acquire(ctx context.Context, client string) error {
+	b.mu.Lock()
+	if b.active < b.limit && b.queued == 0 {
+		b.active++
+		b.mu.Unlock()
+		return nil
+	}
+
+	if b.queued >= b.cfg.QueueSize || len(b.queues[client]) >= b.cfg.QueuePerClient {
+		b.mu.Unlock()
+		return ErrBulkheadFull
+	}
+
+	waiter := &bulkheadWaiter{ready: make(chan struct{})}
+	if len(b.queues[client]) == 0 {
+		b.order = append(b.order, client)
+	}
+	b.queues[client] = append(b.queues[client], waiter)
+	b.queued++
+	b.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(time.Duration(b.cfg.QueueTimeoutMs) * time.Millisecond)
+	defer timer.Stop()
+
+	err := ErrBulkheadFull
+	select {
+	case <-waiter.ready:
+		b.recordWait(client, time.Since(start))
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	if waiter.admitted {
+		if err == ErrBulkheadFull {
+			// Admitted just as the wait timed out; keep the slot
+			b.recordWaitLocked(client, time.Since(start))
+			b.mu.Unlock()
+			return nil
+		}
+		// Nobody will use the slot it was handed
+		b.mu.Unlock()
+		b.Release()
+		return err
+	}
+	b.removeWaiter(client, waiter)
+	b.mu.Unlock()
+	return err
+}
+
+// Release frees a slot, handing it to the next client in round-robin order
+func (b *Bulkhead) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.order) == 0 {
+		b.active--
+		return
+	}
+
+	client := b.order[0]
+	waiter := b.queues[client][0]
+	b.queues[client] = b.queues[client][1:]
+	b.queued--
+
+	b.order = b.order[1:]
+	if len(b.queues[client]) > 0 {
+		b.order = append(b.order, client)
+	} else {
+		delete(b.queues, client)
+	}
+
+	// The slot passes straight to the waiter, so active is unchanged
+	waiter.admitted = true
+	close(waiter.ready)
+}
+
+func (b *Bulkhead) removeWaiter(client string, waiter *bulkheadWaiter) {
+	queue := b.queues[client]
+	for i, w := range queue {
+		if w == waiter {
+			b.queues[client] = append(queue[:i], queue[i+1:]...)
+			b.queued--
+			break
+		}
+	}
+
+	if len(b.queues[client]) == 0 {
+		delete(b.queues, client)
+		for i, c := range b.order {
+			if c == client {
+				b.order = append(b.order[:i], b.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (b *Bulkhead) recordWait(client string, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recordWaitLocked(client, wait)
+}
+
+func (b *Bulkhead) recordWaitLocked(client string, wait time.Duration) {
+	stats, exists := b.waitStats[client]
+	if !exists {
+		if len(b.waitStats) >= maxTrackedClients {
+			return
+		}
+		stats = &clientWait{}
+		b.waitStats[client] = stats
+	}
+	stats.count++
+	stats.totalMs += float64(wait.Milliseconds())
+}
+
+// Stats returns the queue depth and the average queue wait per client
+func (b *Bulkhead) Stats() (int, map[string]float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	waits := make(map[string]float64, len(b.waitStats))
+	for client, stats := range b.waitStats {
+		waits[client] = stats.totalMs / float64(stats.count)
+	}
+	return b.queued, waits
+}
+
+// bulkheadClient keys bulkhead fairness on the authenticated user, else the
+// client IP, never on headers the client sets itself
+func bulkheadClient(ctx context.Context) string {
+	if userID, _ := reqctx.UserIDFromContext(ctx); userID != "" {
+		return "user:" + userID
+	}
+	if ip, _ := reqctx.ClientIPFromContext(ctx); ip != "" {
+		return "ip:" + ip
+	}
+	return "anonymous"
+}
+
+// bulkheadFor returns the bulkhead of a service, or nil if it has no concurrency limit
+func (gp *GatewayProcessor) bulkheadFor(service string) *Bulkhead {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+	return gp.bulkheads[service]
+}
@@ -0,0 +1,137 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
+)
+
+func newTestBulkhead(limit int) *Bulkhead {
+	return NewBulkhead(limit, config.BulkheadConfig{
+		QueueSize:      20,
+		QueuePerClient: 10,
+		QueueTimeoutMs: 5000,
+	})
+}
+
+// waitQueued waits until n requests are queued
+func waitQueued(t *testing.T, b *Bulkhead, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if queued, _ := b.Stats(); queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			queued, _ := b.Stats()
+			t.Fatalf("queued = %d, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkheadAdmitsClientsRoundRobin(t *testing.T) {
+	b := newTestBulkhead(1)
+	if err := b.Acquire(context.Background(), "busy"); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		admitted []string
+		wg       sync.WaitGroup
+	)
+	queue := func(client string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Acquire(context.Background(), client); err != nil {
+				t.Errorf("acquire for %s: %v", client, err)
+				return
+			}
+			mu.Lock()
+			admitted = append(admitted, client)
+			mu.Unlock()
+		}()
+	}
+
+	// The heavy client queues first and more; the light one arrives last
+	for i := 0; i < 4; i++ {
+		queue("heavy")
+		waitQueued(t, b, i+1)
+	}
+	queue("light")
+	waitQueued(t, b, 5)
+
+	for i := 0; i < 5; i++ {
+		b.Release()
+		wait := time.Now().Add(2 * time.Second)
+		for {
+			mu.Lock()
+			n := len(admitted)
+			mu.Unlock()
+			if n == i+1 || time.Now().After(wait) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wg.Wait()
+
+	if len(admitted) != 5 || admitted[1] != "light" {
+		t.Fatalf("admission order = %v, want the light client second", admitted)
+	}
+}
+
+func TestBulkheadQueuedAcquireStopsWithContext(t *testing.T) {
+	b := newTestBulkhead(1)
+	if err := b.Acquire(context.Background(), "busy"); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Acquire(ctx, "waiting") }()
+	waitQueued(t, b, 1)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued acquire ignored the cancelled context")
+	}
+	if queued, _ := b.Stats(); queued != 0 {
+		t.Fatalf("queued = %d after cancel, want 0", queued)
+	}
+
+	// The slot is still usable once released
+	b.Release()
+	if err := b.Acquire(context.Background(), "next"); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+func TestBulkheadClientIgnoresClientHeaders(t *testing.T) {
+	ctx := reqctx.WithClientIP(context.Background(), "10.0.0.1")
+	if got := bulkheadClient(ctx); got != "ip:10.0.0.1" {
+		t.Errorf("anonymous client = %q, want its IP", got)
+	}
+
+	ctx = reqctx.WithUser(ctx, &models.User{ID: "user-1"})
+	if got := bulkheadClient(ctx); got != "user:user-1" {
+		t.Errorf("authenticated client = %q, want its user", got)
+	}
+
+	if got := bulkheadClient(context.Background()); got != "anonymous" {
+		t.Errorf("client without identity = %q, want anonymous", got)
+	}
+}
@@ -0,0 +1,145 @@
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen is returned without contacting the upstream while its circuit is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreaker stops traffic to a failing service. It opens after threshold
+// consecutive failures, lets up to maxProbes requests through once the cooldown
+// has passed (half-open), and closes again when a probe succeeds.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	probes    int
+	openedAt  time.Time
+	threshold int
+	maxProbes int
+	cooldown  time.Duration
+}
+
+func NewCircuitBreaker(cfg config.CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		state:     CircuitClosed,
+		threshold: max(cfg.FailureThreshold, 1),
+		maxProbes: max(cfg.HalfOpenProbes, 1),
+		cooldown:  time.Duration(cfg.CooldownSeconds) * time.Second,
+	}
+}
+
+// Allow reports whether a request may be sent. Every allowed request must be
+// followed by Success, Failure or Cancel.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.probes = 0
+		fallthrough
+	case CircuitHalfOpen:
+		if cb.probes >= cb.maxProbes {
+			return false
+		}
+		cb.probes++
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = CircuitClosed
+	cb.failures = 0
+	cb.probes = 0
+}
+
+// Cancel gives back the probe slot of an allowed request that ended without an
+// outcome, e.g. because its client disconnected, so a half-open circuit keeps
+// letting probes through
+func (cb *CircuitBreaker) Cancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// Failure records a failed request and reports whether it opened the circuit
+func (cb *CircuitBreaker) Failure() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		cb.open()
+		return true
+	case CircuitClosed:
+		cb.failures++
+		if cb.failures >= cb.threshold {
+			cb.open()
+			return true
+		}
+	}
+	return false
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.state = CircuitOpen
+	cb.openedAt = time.Now()
+	cb.failures = 0
+	cb.probes = 0
+}
+
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// breakerFor returns the circuit breaker of a service, or nil if disabled
+func (gp *GatewayProcessor) breakerFor(service string) *CircuitBreaker {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+	return gp.breakers[service]
+}
+
+// recordCircuitOutcome feeds a request result into the service's breaker
+func (gp *GatewayProcessor) recordCircuitOutcome(service string, breaker *CircuitBreaker, success bool) {
+	if breaker == nil {
+		return
+	}
+	if success {
+		breaker.Success()
+		return
+	}
+	if breaker.Failure() {
+		gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Circuit opened for %s", service), map[string]interface{}{
+			"service":          service,
+			"cooldown_seconds": gp.config.CircuitBreaker.CooldownSeconds,
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func newTestBreaker(threshold, probes int) *CircuitBreaker {
+	return NewCircuitBreaker(config.CircuitBreakerConfig{
+		Enabled:          true,
+		FailureThreshold: threshold,
+		CooldownSeconds:  60,
+		HalfOpenProbes:   probes,
+	})
+}
+
+// expireCooldown makes an open breaker eligible for half-open probes
+func expireCooldown(cb *CircuitBreaker) {
+	cb.mu.Lock()
+	cb.openedAt = time.Now().Add(-cb.cooldown - time.Second)
+	cb.mu.Unlock()
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	cb := newTestBreaker(3, 1)
+
+	for i := 0; i < 2; i++ {
+		if cb.Failure() {
+			t.Fatalf("failure %d opened the circuit before the threshold", i+1)
+		}
+	}
+	if !cb.Allow() || cb.State() != CircuitClosed {
+		t.Fatalf("state = %s, want closed and allowing", cb.State())
+	}
+	if !cb.Failure() {
+		t.Fatal("third failure didn't open the circuit")
+	}
+	if cb.State() != CircuitOpen {
+		t.Fatalf("state = %s, want %s", cb.State(), CircuitOpen)
+	}
+	if cb.Allow() {
+		t.Fatal("open circuit allowed a request before the cooldown")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	cb := newTestBreaker(2, 1)
+
+	cb.Failure()
+	cb.Success()
+	if cb.Failure() {
+		t.Fatal("failures before a success counted towards the threshold")
+	}
+	if cb.State() != CircuitClosed {
+		t.Fatalf("state = %s, want %s", cb.State(), CircuitClosed)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeCloses(t *testing.T) {
+	cb := newTestBreaker(1, 2)
+	cb.Failure()
+	expireCooldown(cb)
+
+	if !cb.Allow() || !cb.Allow() {
+		t.Fatal("half-open circuit didn't allow its probes")
+	}
+	if cb.State() != CircuitHalfOpen {
+		t.Fatalf("state = %s, want %s", cb.State(), CircuitHalfOpen)
+	}
+	if cb.Allow() {
+		t.Fatal("half-open circuit allowed more than its probes")
+	}
+
+	cb.Success()
+	if cb.State() != CircuitClosed {
+		t.Fatalf("state = %s, want %s", cb.State(), CircuitClosed)
+	}
+	if !cb.Allow() {
+		t.Fatal("closed circuit refused a request")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeReopens(t *testing.T) {
+	cb := newTestBreaker(1, 1)
+	cb.Failure()
+	expireCooldown(cb)
+
+	if !cb.Allow() {
+		t.Fatal("half-open circuit refused its probe")
+	}
+	if !cb.Failure() {
+		t.Fatal("failed probe didn't report reopening the circuit")
+	}
+	if cb.State() != CircuitOpen {
+		t.Fatalf("state = %s, want %s", cb.State(), CircuitOpen)
+	}
+	// The cooldown starts over
+	if cb.Allow() {
+		t.Fatal("reopened circuit allowed a request before the cooldown")
+	}
+}
+
+func TestCircuitBreakerCancelReleasesProbe(t *testing.T) {
+	cb := newTestBreaker(1, 1)
+	cb.Failure()
+	expireCooldown(cb)
+
+	if !cb.Allow() {
+		t.Fatal("half-open circuit refused its probe")
+	}
+	cb.Cancel()
+	if cb.State() != CircuitHalfOpen {
+		t.Fatalf("state = %s, want %s", cb.State(), CircuitHalfOpen)
+	}
+	if !cb.Allow() {
+		t.Fatal("cancelled probe didn't give its slot back")
+	}
+}
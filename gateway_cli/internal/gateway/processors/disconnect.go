@@ -0,0 +1,39 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrClientDisconnected is returned when the client went away before the
+// upstream answered. It isn't an upstream failure and isn't counted as one.
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// isClientDisconnect reports whether an upstream context was cancelled by the
+// caller rather than by the gateway's own timeout
+func isClientDisconnect(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), context.Canceled)
+}
+
+// recordClientDisconnect counts and logs a request abandoned by its client
+func (gp *GatewayProcessor) recordClientDisconnect(service, method, path string, duration time.Duration, userID, requestID string, metadata map[string]interface{}) {
+	// Counted in the totals, but neither as a success nor as an error
+	gp.metrics.mu.Lock()
+	gp.metrics.TotalRequests++
+	gp.metrics.ClientDisconnects++
+	if serviceMetrics, exists := gp.metrics.ServiceMetrics[service]; exists {
+		serviceMetrics.TotalRequests++
+		serviceMetrics.ClientDisconnects++
+	}
+	gp.metrics.mu.Unlock()
+
+	gp.logMetrics("client_disconnect", service, method, path, duration, 0, userID, requestID, metadata)
+	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Client disconnected during request to %s", service), map[string]interface{}{
+		"service":     service,
+		"path":        path,
+		"request_id":  requestID,
+		"duration_ms": duration.Milliseconds(),
+	})
+}
@@ -0,0 +1,121 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestClientDisconnectReleasesHalfOpenProbe(t *testing.T) {
+	var hang atomic.Bool
+	arrived := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			arrived <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 5),
+	}, func(cfg *config.Config) {
+		cfg.CircuitBreaker.Enabled = true
+		cfg.CircuitBreaker.FailureThreshold = 1
+		cfg.CircuitBreaker.CooldownSeconds = 60
+		cfg.CircuitBreaker.HalfOpenProbes = 1
+		cfg.Retry.MaxAttempts = 1
+	})
+
+	breaker := gp.breakerFor("devices")
+	if breaker == nil {
+		t.Fatal("circuit breaker not created")
+	}
+	// Open with the cooldown already over, so the next request is the probe
+	breaker.Failure()
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-time.Hour)
+	breaker.mu.Unlock()
+
+	hang.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	_, err := gp.ProxyRequest(ctx, "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+	if !errors.Is(err, ErrClientDisconnected) {
+		t.Fatalf("err = %v, want ErrClientDisconnected", err)
+	}
+
+	metrics := gp.GetMetrics()
+	if metrics.ClientDisconnects != 1 || metrics.ErrorRequests != 0 {
+		t.Fatalf("client_disconnects = %d, error_requests = %d, want 1 and 0", metrics.ClientDisconnects, metrics.ErrorRequests)
+	}
+	if state := breaker.State(); state != CircuitHalfOpen {
+		t.Fatalf("state after disconnect = %s, want %s", state, CircuitHalfOpen)
+	}
+
+	// The abandoned probe gave its slot back, so the next one gets through
+	hang.Store(false)
+	resp, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+	if err != nil {
+		t.Fatalf("probe after disconnect: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("probe status = %d, want 200", resp.StatusCode)
+	}
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("state after probe = %s, want %s", state, CircuitClosed)
+	}
+}
+
+func TestClientCancelAbortsUpstreamRequest(t *testing.T) {
+	arrived := make(chan struct{})
+	aborted := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(5 * time.Second):
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer upstream.Close()
+
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 30),
+	}, func(cfg *config.Config) {
+		cfg.Retry.MaxAttempts = 1
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := gp.ProxyRequest(ctx, "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+	if !errors.Is(err, ErrClientDisconnected) {
+		t.Fatalf("err = %v, want ErrClientDisconnected", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("proxy returned after %v, want it to stop when the client went away", elapsed)
+	}
+
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request was not cancelled")
+	}
+}
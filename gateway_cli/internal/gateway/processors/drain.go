@@ -0,0 +1,65 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrShuttingDown is returned for proxy requests arriving while the gateway drains
+var ErrShuttingDown = errors.New("gateway shutting down")
+
+// requestTracker counts in-flight proxy requests so shutdown can wait for them
+type requestTracker struct {
+	mu       sync.RWMutex
+	draining bool
+	inFlight sync.WaitGroup
+	active   atomic.Int64
+}
+
+// begin registers a request, failing once draining has started
+func (t *requestTracker) begin() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.draining {
+		return false
+	}
+	t.inFlight.Add(1)
+	t.active.Add(1)
+	return true
+}
+
+func (t *requestTracker) done() {
+	t.active.Add(-1)
+	t.inFlight.Done()
+}
+
+// Drain makes new proxy requests fail with ErrShuttingDown and waits for those
+// in flight to finish, returning ctx's error if it ends first
+func (gp *GatewayProcessor) Drain(ctx context.Context) error {
+	gp.requests.mu.Lock()
+	gp.requests.draining = true
+	gp.requests.mu.Unlock()
+
+	gp.redis.PublishLog("info", "gateway", "Draining in-flight requests", map[string]interface{}{
+		"in_flight": gp.requests.active.Load(),
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		gp.requests.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		gp.redis.PublishLog("warn", "gateway", "Drain timed out with requests still in flight", map[string]interface{}{
+			"in_flight": gp.requests.active.Load(),
+		})
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,115 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// blockingUpstream holds every request until release is called, at the
+// latest when the test ends
+func blockingUpstream(t *testing.T) (*httptest.Server, func()) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var once sync.Once
+	release := func() { once.Do(func() { close(unblock) }) }
+	t.Cleanup(release)
+	return server, release
+}
+
+// waitInFlight polls the in-flight gauge until it reads want
+func waitInFlight(t *testing.T, gp *GatewayProcessor, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for gp.GetMetrics().InFlightRequests != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("in-flight requests = %d, want %d", gp.GetMetrics().InFlightRequests, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestInFlightGaugeFollowsSlowProxy(t *testing.T) {
+	upstream, release := blockingUpstream(t)
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 5),
+	}, nil)
+
+	waitInFlight(t, gp, 0)
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+			done <- err
+		}()
+	}
+	waitInFlight(t, gp, 2)
+
+	release()
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("proxy: %v", err)
+		}
+	}
+	waitInFlight(t, gp, 0)
+}
+
+func TestDrainWaitsForInFlightRequests(t *testing.T) {
+	upstream, release := blockingUpstream(t)
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 5),
+	}, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+		done <- err
+	}()
+	waitInFlight(t, gp, 1)
+
+	drained := make(chan error, 1)
+	go func() { drained <- gp.Drain(context.Background()) }()
+
+	// Drain starts asynchronously; wait for it before sending another request
+	deadline := time.Now().Add(time.Second)
+	for {
+		gp.requests.mu.RLock()
+		draining := gp.requests.draining
+		gp.requests.mu.RUnlock()
+		if draining {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("drain did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("request while draining: err = %v, want ErrShuttingDown", err)
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight request: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+}
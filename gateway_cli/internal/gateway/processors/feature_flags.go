@@ -0,0 +1,68 @@
+package processors
+
+import (
+	"sort"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// FeatureFlagSource resolves the feature flags enabled for a user
+type FeatureFlagSource interface {
+	Flags(userID string) []string
+}
+
+// StaticFlagSource serves flags from the FEATURE_FLAGS config
+type StaticFlagSource struct {
+	flags []config.FeatureFlag
+}
+
+func NewStaticFlagSource(cfg config.FeatureFlagsConfig) *StaticFlagSource {
+	return &StaticFlagSource{flags: cfg.Flags}
+}
+
+func (s *StaticFlagSource) Flags(userID string) []string {
+	var enabled []string
+	for _, flag := range s.flags {
+		for _, user := range flag.Users {
+			if user == "*" || (userID != "" && user == userID) {
+				enabled = append(enabled, flag.Name)
+				break
+			}
+		}
+	}
+	return enabled
+}
+
+// SetFeatureFlagSource replaces the flag source; nil disables it
+func (gp *GatewayProcessor) SetFeatureFlagSource(source FeatureFlagSource) {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	gp.flagSource = source
+}
+
+// ResolveFeatureFlags merges the flags from the user's claims with those from
+// the configured source, returning them sorted and without duplicates
+func (gp *GatewayProcessor) ResolveFeatureFlags(userID string, claimed []string) []string {
+	gp.mu.RLock()
+	source := gp.flagSource
+	gp.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var flags []string
+	add := func(names []string) {
+		for _, name := range names {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				flags = append(flags, name)
+			}
+		}
+	}
+
+	add(claimed)
+	if source != nil {
+		add(source.Flags(userID))
+	}
+
+	sort.Strings(flags)
+	return flags
+}
@@ -3,83 +3,210 @@ package processors
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc"
 
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
 	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
 	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
 )
 
+// ErrNoServicesConfigured is returned when the registry is empty, e.g. SERVICES
+// is unset with dev defaults disabled
+var ErrNoServicesConfigured = errors.New("gateway has no services configured")
+
+// ErrServiceNotFound is returned for services missing from the registry
+var ErrServiceNotFound = errors.New("service not found")
+
 type GatewayProcessor struct {
-	config      *config.Config
-	redis       *redis.Client
-	services    map[string]*config.ServiceInfo
-	healthStats map[string]*models.HealthCheckResult
-	metrics     *GatewayMetrics
-	mu          sync.RWMutex
-	stopChan    chan struct{}
-	httpClient  *http.Client
+	config           *config.Config
+	redis            *redis.Client
+	services         map[string]*config.ServiceInfo
+	balancers        map[string]*ServiceBalancer
+	breakers         map[string]*CircuitBreaker
+	bulkheads        map[string]*Bulkhead
+	serviceClients   map[string]*upstreamClients
+	defaultClients   *upstreamClients
+	healthStats      map[string]*models.HealthCheckResult
+	healthHistory    map[string]*healthHistory
+	startupDeadlines map[string]time.Time
+	metrics          *GatewayMetrics
+	mu               sync.RWMutex
+	reloadMu         sync.Mutex
+	stopChan         chan struct{}
+	stopOnce         sync.Once
+	publicURL        *url.URL
+	grpcConns        map[string]*grpc.ClientConn
+	grpcMu           sync.Mutex
+	healthFlights    map[string]*healthFlight
+	flightMu         sync.Mutex
+	probeSlots       chan struct{}
+	healthLoops      map[string]*healthLoop
+	healthChecking   bool
+	loopMu           sync.Mutex
+	probesInFlight   atomic.Int64
+	cache            *ResponseCache
+	notifiers        []HealthNotifier
+	notifyStates     map[string]*notifyState
+	notifyMu         sync.Mutex
+	flagSource       FeatureFlagSource
+	activeStreams    streamRegistry
+	requests         requestTracker
+	controller       ServiceController
+	// discovery and registered (services added through the admin API) are guarded by reloadMu
+	discovery  ServiceDiscovery
+	registered map[string]models.ServiceRegistration
 }
 
 type GatewayMetrics struct {
-	TotalRequests   int64                                `json:"total_requests"`
-	SuccessRequests int64                                `json:"success_requests"`
-	ErrorRequests   int64                                `json:"error_requests"`
-	AverageLatency  float64                              `json:"average_latency_ms"`
-	ServiceMetrics  map[string]*ServiceMetrics           `json:"service_metrics"`
-	HealthStats     map[string]*models.HealthCheckResult `json:"health_stats"`
-	StartTime       time.Time                            `json:"start_time"`
-	mu              sync.RWMutex
+	TotalRequests   int64 `json:"total_requests"`
+	SuccessRequests int64 `json:"success_requests"`
+	ErrorRequests   int64 `json:"error_requests"`
+	// ClientDisconnects counts requests abandoned by the client, which aren't errors
+	ClientDisconnects   int64                                `json:"client_disconnects"`
+	InFlightRequests    int64                                `json:"in_flight_requests"`
+	UpstreamConnections int64                                `json:"upstream_connections"`
+	Goroutines          int                                  `json:"goroutines"`
+	AverageLatency      float64                              `json:"average_latency_ms"`
+	ErrorAverageLatency float64                              `json:"error_average_latency_ms"`
+	P50Latency          float64                              `json:"p50_latency_ms"`
+	P95Latency          float64                              `json:"p95_latency_ms"`
+	P99Latency          float64                              `json:"p99_latency_ms"`
+	ServiceMetrics      map[string]*ServiceMetrics           `json:"service_metrics"`
+	TagMetrics          map[string]*TagMetrics               `json:"tag_metrics"`
+	HealthStats         map[string]*models.HealthCheckResult `json:"health_stats"`
+	StartTime           time.Time                            `json:"start_time"`
+	latency             *latencyWindow
+	latencySamples      int64
+	errorSamples        int64
+	mu                  sync.RWMutex
 }
 
 type ServiceMetrics struct {
-	TotalRequests   int64     `json:"total_requests"`
-	SuccessRequests int64     `json:"success_requests"`
-	ErrorRequests   int64     `json:"error_requests"`
-	AverageLatency  float64   `json:"average_latency_ms"`
-	LastRequest     time.Time `json:"last_request"`
+	TotalRequests       int64     `json:"total_requests"`
+	SuccessRequests     int64     `json:"success_requests"`
+	ErrorRequests       int64     `json:"error_requests"`
+	ClientDisconnects   int64     `json:"client_disconnects"`
+	AverageLatency      float64   `json:"average_latency_ms"`
+	ErrorAverageLatency float64   `json:"error_average_latency_ms"`
+	P50Latency          float64   `json:"p50_latency_ms"`
+	P95Latency          float64   `json:"p95_latency_ms"`
+	P99Latency          float64   `json:"p99_latency_ms"`
+	LastRequest         time.Time `json:"last_request"`
+	CacheHits           int64     `json:"cache_hits"`
+	CacheMisses         int64     `json:"cache_misses"`
+	latency             *latencyWindow
+	latencySamples      int64
+	errorSamples        int64
+
+	QueueDepth  int                `json:"queue_depth,omitempty"`
+	QueueWaitMs map[string]float64 `json:"queue_wait_ms,omitempty"`
+
+	HeaderRequests      int64            `json:"header_requests"`
+	AverageHeaderBytes  float64          `json:"average_header_bytes"`
+	HeaderSizeHistogram map[string]int64 `json:"header_size_histogram,omitempty"`
+
+	// Moving averages for header size creep detection
+	headerBaseline float64
+	headerRecent   float64
+	headerAlertAt  time.Time
 }
 
 func NewGatewayProcessor(cfg *config.Config, redisClient *redis.Client) *GatewayProcessor {
+	// Public base URL is validated by config.Load
+	var publicURL *url.URL
+	if cfg.Server.PublicBaseURL != "" {
+		publicURL, _ = url.Parse(cfg.Server.PublicBaseURL)
+	}
+
+	notifiers, err := newConfiguredNotifiers(cfg.HealthCheck.Notify)
+	if err != nil {
+		redisClient.PublishLog("error", "gateway", "Health notifications disabled: invalid webhook config", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	controller, err := NewServiceController(cfg.ServiceControl)
+	if err != nil {
+		redisClient.PublishLog("error", "gateway", "Service restarts disabled: invalid service control config", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var flagSource FeatureFlagSource
+	if len(cfg.Features.Flags) > 0 {
+		flagSource = NewStaticFlagSource(cfg.Features)
+	}
+
 	return &GatewayProcessor{
-		config:      cfg,
-		redis:       redisClient,
-		services:    make(map[string]*config.ServiceInfo),
-		healthStats: make(map[string]*models.HealthCheckResult),
+		config:           cfg,
+		redis:            redisClient,
+		services:         make(map[string]*config.ServiceInfo),
+		balancers:        make(map[string]*ServiceBalancer),
+		breakers:         make(map[string]*CircuitBreaker),
+		bulkheads:        make(map[string]*Bulkhead),
+		serviceClients:   make(map[string]*upstreamClients),
+		defaultClients:   newUpstreamClients(newTransport(), 30*time.Second),
+		healthStats:      make(map[string]*models.HealthCheckResult),
+		healthHistory:    make(map[string]*healthHistory),
+		startupDeadlines: make(map[string]time.Time),
 		metrics: &GatewayMetrics{
 			ServiceMetrics: make(map[string]*ServiceMetrics),
+			TagMetrics:     make(map[string]*TagMetrics),
 			HealthStats:    make(map[string]*models.HealthCheckResult),
 			StartTime:      time.Now(),
+			latency:        newLatencyWindow(cfg.Metrics.LatencyWindowSize, time.Duration(cfg.Metrics.LatencyWindowSeconds)*time.Second),
 		},
-		stopChan: make(chan struct{}),
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		},
+		stopChan:  make(chan struct{}),
+		publicURL: publicURL,
+		grpcConns: make(map[string]*grpc.ClientConn),
+
+		healthFlights: make(map[string]*healthFlight),
+		probeSlots:    make(chan struct{}, max(cfg.HealthCheck.MaxConcurrent, 1)),
+		healthLoops:   make(map[string]*healthLoop),
+		cache:         NewResponseCache(cfg.Cache.MaxEntries),
+		notifiers:     notifiers,
+		notifyStates:  make(map[string]*notifyState),
+		flagSource:    flagSource,
+		activeStreams: streamRegistry{streams: make(map[*countingStream]struct{})},
+		controller:    controller,
+		discovery:     NewServiceDiscovery(cfg, redisClient),
+		registered:    make(map[string]models.ServiceRegistration),
 	}
 }
 
 func (gp *GatewayProcessor) Start() {
-	// Initialize services from config
-	for name, serviceInfo := range gp.config.Services.Registry {
-		gp.mu.Lock()
-		service := serviceInfo // Copy to avoid pointer issues
-		gp.services[name] = &service
+	// Initialize services from discovery and earlier runtime registrations
+	gp.reloadMu.Lock()
+	gp.loadRegistrations()
+	registry, err := gp.discovery.Services(context.Background())
+	if err != nil {
+		gp.redis.PublishLog("error", "gateway", "Service discovery failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	gp.swapServices(gp.withRegistered(registry))
+	gp.reloadMu.Unlock()
 
-		// Initialize service metrics
-		gp.metrics.ServiceMetrics[name] = &ServiceMetrics{}
-		gp.mu.Unlock()
+	if gp.config.Services.Discovery == config.DiscoveryStatic && len(gp.config.Services.Registry) == 0 {
+		gp.redis.PublishLog("warn", "gateway", "No services configured: SERVICES is empty and dev defaults are disabled", map[string]interface{}{
+			"disable_dev_defaults": gp.config.Services.DisableDevDefaults,
+		})
 	}
 
 	// Log startup
@@ -89,47 +216,134 @@ func (gp *GatewayProcessor) Start() {
 	})
 }
 
-func (gp *GatewayProcessor) ProxyRequest(service, path, method string, body io.Reader, headers map[string]string, userID string) (*models.ProxyResponse, error) {
+// ProxyRequest forwards a request to service. route is the gateway route template
+// that matched (e.g. "/api/devices/{id}") and is used for logs, metrics and upstream correlation.
+// timings, if set, are checked against the request budget. Cancelling ctx, e.g.
+// when the client disconnects, aborts the upstream request.
+func (gp *GatewayProcessor) ProxyRequest(ctx context.Context, service, route, path, method string, body io.Reader, headers map[string]string, userID string, timings *models.PhaseTimings) (*models.ProxyResponse, error) {
+	if !gp.requests.begin() {
+		return nil, ErrShuttingDown
+	}
+	defer gp.requests.done()
+
+	tag, _ := reqctx.RequestTagFromContext(ctx)
+	if tag == "" {
+		return gp.proxyRequest(ctx, service, route, path, method, body, headers, userID, timings)
+	}
+
 	startTime := time.Now()
-	requestID := uuid.New().String()
+	proxyResp, err := gp.proxyRequest(ctx, service, route, path, method, body, headers, userID, timings)
+	if !errors.Is(err, ErrClientDisconnected) {
+		gp.recordTagMetrics(tag, time.Since(startTime), err == nil && proxyResp.StatusCode < 400)
+	}
+	return proxyResp, err
+}
 
-	// Update metrics
-	gp.updateRequestMetrics(service, true)
+// requestIDFor returns the request ID assigned by the RequestID middleware, so
+// logs, metrics and the upstream share one correlation ID. Calls made outside
+// a request get a fresh one.
+func requestIDFor(ctx context.Context) string {
+	if requestID, ok := reqctx.RequestIDFromContext(ctx); ok && requestID != "" {
+		return requestID
+	}
+	return uuid.New().String()
+}
 
+func (gp *GatewayProcessor) proxyRequest(ctx context.Context, service, route, path, method string, body io.Reader, headers map[string]string, userID string, timings *models.PhaseTimings) (*models.ProxyResponse, error) {
+	startTime := time.Now()
+	requestID := requestIDFor(ctx)
+
+	// Each exit path counts the request exactly once: failures where they
+	// happen, successes once the outcome is known
 	// Log request start
 	gp.logRequest(models.ProxyRequest{
 		Service:   service,
 		Method:    method,
 		Path:      path,
+		Route:     route,
 		UserID:    userID,
 		RequestID: requestID,
 		Headers:   headers,
 		Timestamp: startTime,
 	})
 
+	// Resolve bounded metric labels from request headers
+	metricLabels := gp.resolveMetricLabels(headers)
+
 	// Get service info
 	gp.mu.RLock()
 	serviceInfo, exists := gp.services[service]
+	balancer := gp.balancers[service]
 	gp.mu.RUnlock()
 
 	if !exists {
 		gp.updateRequestMetrics(service, false)
-		return nil, fmt.Errorf("service %s not found", service)
+		if gp.ServiceCount() == 0 {
+			return nil, ErrNoServicesConfigured
+		}
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, service)
 	}
 
-	// Read body if present
+	// The cache is shared unless the service keys it per user; requests with
+	// credentials may get user-specific responses, so they skip a shared cache.
+	// Per-user keys use the authenticated user only, never the client's
+	// X-User-ID, and requests without one aren't cached. HEAD is answered from
+	// a cached GET but never stored.
+	cacheable := (method == http.MethodGet || method == http.MethodHead) && serviceInfo.CacheTTLSeconds > 0 && !serviceInfo.StreamNDJSON
+	cacheTTL := time.Duration(serviceInfo.CacheTTLSeconds) * time.Second
+	cacheKey := service + "\x00" + path
+	if serviceInfo.CachePerUser {
+		authUserID, _ := reqctx.UserIDFromContext(ctx)
+		cacheKey = service + "\x00" + authUserID + "\x00" + path
+		cacheable = cacheable && authUserID != ""
+	} else if reqctx.CachePrivate(ctx) {
+		cacheable = false
+	}
+	if cacheable {
+		if cached, hit := gp.cache.Get(cacheKey, headers); hit {
+			gp.recordCacheResult(service, true)
+			return gp.cachedResponse(cached, "hit", service, method, path, route, startTime, userID, requestID, metricLabels), nil
+		}
+		// Revalidations count as misses since they reach the upstream
+		gp.recordCacheResult(service, false)
+	}
+
+	// Select upstream instance
+	instance := serviceInfo.URL
+	if balancer != nil {
+		instance = balancer.Pick()
+	}
+
+	// Pinned instance from a trusted client; the middleware strips the header otherwise
+	if target := headers["X-Upstream-Target"]; target != "" && balancer != nil {
+		if pinned, ok := balancer.Lookup(target); ok {
+			instance = pinned
+		} else {
+			gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Ignoring unknown upstream target for %s", service), map[string]interface{}{
+				"service":    service,
+				"target":     target,
+				"request_id": requestID,
+			})
+		}
+	}
+
+	// Read body if present, up to the service's limit
+	requestLimit, responseLimit := gp.bodyLimits(serviceInfo)
 	var bodyBytes []byte
 	if body != nil {
 		var err error
-		bodyBytes, err = io.ReadAll(body)
+		bodyBytes, err = readRequestBody(body, requestLimit)
 		if err != nil {
 			gp.updateRequestMetrics(service, false)
+			if errors.Is(err, ErrRequestBodyTooLarge) {
+				return nil, err
+			}
 			return nil, fmt.Errorf("failed to read request body: %w", err)
 		}
 	}
 
 	// Create HTTP request
-	fullURL := serviceInfo.URL + path
+	fullURL := instance + transformPath(serviceInfo.Transform, path)
 	req, err := http.NewRequest(method, fullURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		gp.updateRequestMetrics(service, false)
@@ -140,109 +354,610 @@ func (gp *GatewayProcessor) ProxyRequest(service, path, method string, body io.R
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
+	req.Header.Del("X-Upstream-Target")
+	transformHeaders(serviceInfo.Transform, req.Header)
+
+	// Revalidate a stale cached copy instead of fetching it again, unless the
+	// client sent its own conditions
+	revalidating := false
+	if cacheable && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		if etag, lastModified, ok := gp.cache.Validators(cacheKey, headers); ok {
+			revalidating = true
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
 
 	// Add tracing headers
 	req.Header.Set("X-Request-ID", requestID)
 	req.Header.Set("X-User-ID", userID)
 	req.Header.Set("X-Gateway-Timestamp", startTime.Format(time.RFC3339))
 	req.Header.Set("X-Service-Name", service)
+	setUpstreamEncoding(req, serviceInfo)
+	if route != "" {
+		req.Header.Set("X-Gateway-Route", route)
+	}
 
-	// Execute request with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(serviceInfo.Timeout)*time.Second)
-	defer cancel()
+	// Forward the gateway's public origin so upstreams can build absolute URLs
+	if gp.publicURL != nil {
+		req.Header.Set("X-Forwarded-Proto", gp.publicURL.Scheme)
+		req.Header.Set("X-Forwarded-Host", gp.publicURL.Host)
+		req.Header.Set("Forwarded", fmt.Sprintf("proto=%s;host=%q", gp.publicURL.Scheme, gp.publicURL.Host))
+	}
+
+	// The upstream only gets what's left of the request budget
+	timeout := time.Duration(serviceInfo.Timeout) * time.Second
+	dispatchStart := time.Now()
+	deadline, budgeted := gp.budgetDeadline(timings)
+	if budgeted {
+		remaining := deadline.Sub(dispatchStart)
+		if remaining <= 0 {
+			gp.updateRequestMetrics(service, false)
+			return nil, budgetExhausted(timings, dispatchStart)
+		}
+		timeout = min(timeout, remaining)
+	}
+
+	// Wait for a slot on services with a concurrency limit
+	if bulkhead := gp.bulkheadFor(service); bulkhead != nil {
+		if err := bulkhead.Acquire(ctx, bulkheadClient(ctx)); err != nil {
+			if isClientDisconnect(ctx) {
+				gp.recordClientDisconnect(service, method, path, time.Since(startTime), userID, requestID, withLabels(map[string]interface{}{
+					"phase": "bulkhead",
+					"route": route,
+				}, metricLabels))
+				return nil, ErrClientDisconnected
+			}
+			gp.updateRequestMetrics(service, false)
+			return nil, err
+		}
+		defer bulkhead.Release()
+	}
+
+	// Fail fast while the service's circuit is open
+	breaker := gp.breakerFor(service)
+	if breaker != nil && !breaker.Allow() {
+		gp.updateRequestMetrics(service, false)
+		if serviceInfo.Fallback != nil {
+			return gp.fallbackResponse(service, serviceInfo.Fallback, time.Since(startTime), ErrCircuitOpen.Error()), nil
+		}
+		return nil, ErrCircuitOpen
+	}
+
+	// NDJSON services are streamed through without buffering the body
+	if serviceInfo.StreamNDJSON {
+		return gp.proxyNDJSON(ctx, req, breaker, service, route, path, timeout, startTime, userID, requestID, metricLabels)
+	}
+
+	// Execute request. The timeout bounds the wait for response headers and the
+	// reading of buffered bodies; streamed bodies aren't cut off by it.
+	ctx, cancel := context.WithCancelCause(ctx)
+	upstreamDeadline := time.Now().Add(timeout)
+	timeoutTimer := time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+	streamed := false
+	defer func() {
+		if !streamed {
+			timeoutTimer.Stop()
+			cancel(nil)
+		}
+	}()
 	req = req.WithContext(ctx)
 
-	resp, err := gp.httpClient.Do(req)
+	resp, retries, roundTrip, err := gp.doWithRetry(ctx, upstreamDeadline, gp.clientsFor(service).stream, req, bodyBytes, serviceInfo.RetryOnBody)
 	duration := time.Since(startTime)
 
+	if err != nil && isClientDisconnect(ctx) {
+		// Neither a success nor a failure of the upstream
+		if breaker != nil {
+			breaker.Cancel()
+		}
+		gp.recordClientDisconnect(service, method, path, duration, userID, requestID, withLabels(map[string]interface{}{
+			"phase":   "upstream",
+			"route":   route,
+			"retries": retries,
+		}, metricLabels))
+		return nil, ErrClientDisconnected
+	}
+
 	if err != nil {
+		gp.recordCircuitOutcome(service, breaker, false)
 		gp.updateRequestMetrics(service, false)
-		gp.updateLatencyMetrics(service, duration)
-		gp.logMetrics("request", service, method, path, duration, 0, userID, requestID, map[string]interface{}{
-			"error": err.Error(),
-		})
+		gp.updateLatencyMetrics(service, duration, false)
+		gp.logMetrics("request", service, method, path, duration, 0, userID, requestID, withLabels(map[string]interface{}{
+			"error":   err.Error(),
+			"route":   route,
+			"retries": retries,
+		}, metricLabels))
+		if serviceInfo.Fallback != nil {
+			return gp.fallbackResponse(service, serviceInfo.Fallback, duration, err.Error()), nil
+		}
+		timedOut := errors.Is(context.Cause(ctx), context.DeadlineExceeded)
+		if budgeted && timedOut && !time.Now().Before(deadline) {
+			return nil, budgetExhausted(timings, dispatchStart)
+		}
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
-	defer resp.Body.Close()
+	defer func() {
+		if !streamed {
+			resp.Body.Close()
+		}
+	}()
+	gp.recordCircuitOutcome(service, breaker, resp.StatusCode < 500)
 
-	// Read response body
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
+	if revalidating && resp.StatusCode == http.StatusNotModified {
+		if cached, ok := gp.cache.Revalidate(cacheKey, headers, resp.Header, cacheTTL); ok {
+			return gp.cachedResponse(cached, "revalidated", service, method, path, route, startTime, userID, requestID, metricLabels), nil
+		}
+	}
+
+	// Reject responses that declare a size over the limit without reading them
+	if responseLimit > 0 && resp.ContentLength > responseLimit {
 		gp.updateRequestMetrics(service, false)
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		gp.updateLatencyMetrics(service, duration, false)
+		gp.logMetrics("request", service, method, path, duration, resp.StatusCode, userID, requestID, withLabels(map[string]interface{}{
+			"error":   ErrResponseBodyTooLarge.Error(),
+			"route":   route,
+			"retries": retries,
+		}, metricLabels))
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseBodyTooLarge, resp.ContentLength)
+	}
+
+	// Track instance latency for outlier detection: only the instance's own
+	// round trip, not queueing, cache work or retry backoff in the gateway
+	if balancer != nil && balancer.Observe(instance, roundTrip) {
+		gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Instance %s of %s ejected as latency outlier", instance, service), map[string]interface{}{
+			"service":          service,
+			"instance":         instance,
+			"latency_ms":       roundTrip.Milliseconds(),
+			"ejection_seconds": gp.config.Outlier.EjectionSeconds,
+		})
 	}
 
-	// Update metrics based on status code
 	success := resp.StatusCode >= 200 && resp.StatusCode < 400
-	if !success {
-		gp.updateRequestMetrics(service, false)
+
+	// Convert response headers
+	responseHeaders := gp.responseHeaders(service, resp.Header)
+
+	// Streaming content types and bodies over the threshold are relayed as they
+	// arrive instead of being buffered. Error statuses are always buffered so a
+	// fallback can replace them.
+	threshold := int64(gp.config.Streaming.BufferThresholdBytes)
+	streamBody := !isUpstreamDownStatus(resp.StatusCode) &&
+		(isStreamingContentType(resp.Header.Get("Content-Type")) || resp.ContentLength > threshold)
+
+	// Read response body, never buffering more than the threshold or the response limit
+	readLimit := threshold
+	if responseLimit > 0 && responseLimit < readLimit {
+		readLimit = responseLimit
+	}
+	var responseBody []byte
+	if !streamBody {
+		responseBody, err = io.ReadAll(io.LimitReader(resp.Body, readLimit+1))
+		if err != nil && isClientDisconnect(ctx) {
+			gp.recordClientDisconnect(service, method, path, time.Since(startTime), userID, requestID, withLabels(map[string]interface{}{
+				"phase": "response",
+				"route": route,
+			}, metricLabels))
+			return nil, ErrClientDisconnected
+		}
+		if err != nil {
+			gp.updateRequestMetrics(service, false)
+			gp.updateLatencyMetrics(service, duration, false)
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if responseLimit > 0 && int64(len(responseBody)) > responseLimit {
+			gp.updateRequestMetrics(service, false)
+			gp.updateLatencyMetrics(service, duration, false)
+			return nil, ErrResponseBodyTooLarge
+		}
+		streamBody = int64(len(responseBody)) > threshold
 	}
-	gp.updateLatencyMetrics(service, duration)
 
-	// Log successful request metrics
-	gp.logMetrics("request", service, method, path, duration, resp.StatusCode, userID, requestID, map[string]interface{}{
+	if streamBody {
+		streamed = true
+		timeoutTimer.Stop()
+		gp.updateRequestMetrics(service, success)
+		gp.updateLatencyMetrics(service, duration, success)
+		return &models.ProxyResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    responseHeaders,
+			Duration:   duration,
+			Stream: gp.trackStream(&countingStream{
+				reader: limitStream(io.MultiReader(bytes.NewReader(responseBody), resp.Body), responseLimit),
+				body:   resp.Body,
+				cancel: func() { cancel(nil) },
+				onClose: func(_, size int64) {
+					gp.logMetrics("request", service, method, path, time.Since(startTime), resp.StatusCode, userID, requestID, withLabels(map[string]interface{}{
+						"response_size":   size,
+						"success":         success,
+						"streamed":        true,
+						"time_to_headers": duration.Milliseconds(),
+						"route":           route,
+						"retries":         retries,
+					}, metricLabels))
+				},
+			}),
+		}, nil
+	}
+
+	// Normalize 2xx responses that report an error in their body
+	if serviceInfo.StatusRemap != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if status, remapped := remapStatus(serviceInfo.StatusRemap, resp.Header.Get("Content-Type"), responseBody); remapped {
+			responseHeaders.Set("X-Gateway-Original-Status", strconv.Itoa(resp.StatusCode))
+			resp.StatusCode = status
+			success = false
+		}
+	}
+
+	// Log request metrics
+	gp.updateRequestMetrics(service, success)
+	gp.updateLatencyMetrics(service, duration, success)
+	gp.logMetrics("request", service, method, path, duration, resp.StatusCode, userID, requestID, withLabels(map[string]interface{}{
 		"response_size": len(responseBody),
 		"success":       success,
-	})
+		"route":         route,
+		"retries":       retries,
+	}, metricLabels))
+	if serviceInfo.CaptureBodies {
+		gp.captureBodies(service, method, path, resp.StatusCode, requestID, bodyBytes, responseBody)
+	}
 
-	// Parse JSON response if possible
-	var bodyInterface interface{}
-	if len(responseBody) > 0 {
-		if json.Unmarshal(responseBody, &bodyInterface) != nil {
-			// If not valid JSON, return as string
-			bodyInterface = string(responseBody)
-		}
+	// Upstream reachable but reporting itself down
+	if serviceInfo.Fallback != nil && isUpstreamDownStatus(resp.StatusCode) {
+		return gp.fallbackResponse(service, serviceInfo.Fallback, duration, fmt.Sprintf("status code: %d", resp.StatusCode)), nil
 	}
 
-	// Convert response headers
-	responseHeaders := make(map[string]string)
-	for key, values := range resp.Header {
-		if len(values) > 0 {
-			responseHeaders[key] = values[0]
-		}
+	if cacheable && method == http.MethodGet && isCacheableStatus(resp.StatusCode) {
+		gp.cache.Put(cacheKey, headers, resp.StatusCode, resp.Header, responseBody, cacheTTL)
 	}
 
 	return &models.ProxyResponse{
 		StatusCode: resp.StatusCode,
-		Body:       bodyInterface,
+		Body:       responseBody,
 		Headers:    responseHeaders,
 		Duration:   duration,
 	}, nil
 }
 
+// fallbackResponse builds the configured static response for a service whose upstream is down
+func (gp *GatewayProcessor) fallbackResponse(service string, fallback *config.FallbackResponse, duration time.Duration, cause string) *models.ProxyResponse {
+	gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Serving fallback response for %s", service), map[string]interface{}{
+		"service": service,
+		"status":  fallback.StatusCode,
+		"cause":   cause,
+	})
+
+	return &models.ProxyResponse{
+		StatusCode: fallback.StatusCode,
+		Body:       []byte(fallback.Body),
+		Headers: http.Header{
+			"Content-Type":       {fallback.ContentType},
+			"X-Gateway-Fallback": {"true"},
+		},
+		Duration: duration,
+	}
+}
+
+// SetLogLevel changes the effective log level, globally or for one service,
+// reverting after ttl if it is positive
+func (gp *GatewayProcessor) SetLogLevel(level, service string, ttl time.Duration) error {
+	if err := gp.redis.SetLogLevel(level, service, ttl); err != nil {
+		return err
+	}
+
+	gp.redis.PublishLog("info", "gateway", "Log level changed", map[string]interface{}{
+		"level":          level,
+		"target_service": service,
+		"ttl_seconds":    int(ttl.Seconds()),
+	})
+	return nil
+}
+
+// LogLevels returns the global log level and per-service overrides
+func (gp *GatewayProcessor) LogLevels() (string, map[string]string) {
+	return gp.redis.LogLevels()
+}
+
+// ServiceCount returns the number of registered services
+func (gp *GatewayProcessor) ServiceCount() int {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+	return len(gp.services)
+}
+
 func (gp *GatewayProcessor) CheckServiceHealth(service string) (*models.HealthCheckResult, error) {
 	gp.mu.RLock()
 	serviceInfo, exists := gp.services[service]
 	gp.mu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("service %s not found", service)
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, service)
 	}
 
 	return gp.performHealthCheck(service, serviceInfo)
 }
 
-func (gp *GatewayProcessor) performHealthCheck(service string, serviceInfo *config.ServiceInfo) (*models.HealthCheckResult, error) {
+// ReloadConfig validates a new configuration and swaps in its service registry.
+// If validation or the optional critical-service probe fails, the running
+// registry is kept and the errors are returned.
+func (gp *GatewayProcessor) ReloadConfig(cfg *config.Config) error {
+	gp.reloadMu.Lock()
+	defer gp.reloadMu.Unlock()
+
+	return gp.reloadConfig(cfg)
+}
+
+func (gp *GatewayProcessor) reloadConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		gp.redis.PublishLog("error", "gateway", "Config reload rejected: validation failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	registry, err := gp.discoveredRegistry(cfg)
+	if err != nil {
+		gp.redis.PublishLog("error", "gateway", "Config reload rejected: service discovery failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Errorf("service discovery failed: %w", err)
+	}
+
+	if cfg.Reload.ProbeCritical {
+		var errs []error
+		for name, serviceInfo := range registry {
+			if !serviceInfo.Critical {
+				continue
+			}
+
+			info := serviceInfo
+			result, err := gp.probeHealth(name, &info)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("critical service %s: %w", name, err))
+			} else if !isServing(result.Status) {
+				errs = append(errs, fmt.Errorf("critical service %s is %s: %s", name, result.Status, result.Error))
+			}
+		}
+
+		if len(errs) > 0 {
+			err := errors.Join(errs...)
+			gp.redis.PublishLog("error", "gateway", "Config reload rejected: critical service probe failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return fmt.Errorf("critical service probe failed: %w", err)
+		}
+	}
+
+	if _, static := gp.discovery.(*StaticDiscovery); static {
+		gp.discovery = NewStaticDiscovery(cfg.Services.Registry)
+	}
+	gp.swapServices(gp.withRegistered(registry))
+
+	gp.redis.PublishLog("info", "gateway", "Config reloaded", map[string]interface{}{
+		"services_count": len(registry),
+	})
+
+	return nil
+}
+
+// swapServices atomically replaces the service registry. Balancer state is kept
+// for services whose configuration is unchanged.
+func (gp *GatewayProcessor) swapServices(registry map[string]config.ServiceInfo) {
+	services := make(map[string]*config.ServiceInfo, len(registry))
+	balancers := make(map[string]*ServiceBalancer, len(registry))
+	breakers := make(map[string]*CircuitBreaker)
+	bulkheads := make(map[string]*Bulkhead)
+	serviceClients := make(map[string]*upstreamClients)
+	clientErrors := make(map[string]error)
+
+	gp.mu.Lock()
+	for name, serviceInfo := range registry {
+		service := serviceInfo // Copy to avoid pointer issues
+		services[name] = &service
+
+		// In-flight requests keep their bulkhead while the limit is unchanged
+		if service.MaxConcurrent > 0 {
+			if existing, ok := gp.services[name]; ok && existing.MaxConcurrent == service.MaxConcurrent && gp.bulkheads[name] != nil {
+				bulkheads[name] = gp.bulkheads[name]
+			} else {
+				bulkheads[name] = NewBulkhead(service.MaxConcurrent, gp.config.Bulkhead)
+			}
+		}
+
+		// Breaker state survives reloads of a service
+		if gp.config.CircuitBreaker.Enabled {
+			if breaker, ok := gp.breakers[name]; ok {
+				breakers[name] = breaker
+			} else {
+				breakers[name] = NewCircuitBreaker(gp.config.CircuitBreaker)
+			}
+		}
+
+		if existing, ok := gp.services[name]; ok && reflect.DeepEqual(*existing, service) && gp.balancers[name] != nil {
+			balancers[name] = gp.balancers[name]
+			if clients, ok := gp.serviceClients[name]; ok {
+				serviceClients[name] = clients
+			}
+			continue
+		}
+
+		balancers[name] = NewServiceBalancer(&service, gp.config.Outlier)
+
+		// Newly registered services get a grace period before being reported unhealthy
+		if _, existed := gp.services[name]; !existed && service.StartupGraceSeconds > 0 {
+			gp.startupDeadlines[name] = time.Now().Add(time.Duration(service.StartupGraceSeconds) * time.Second)
+		}
+
+		// Services whose TLS settings can't be loaded use the default clients,
+		// which verify against the system roots
+		clients, err := newServiceClients(&service)
+		if err != nil {
+			clientErrors[name] = err
+		} else {
+			serviceClients[name] = clients
+		}
+	}
+
+	// Drop health data for removed services
+	for name := range gp.healthStats {
+		if _, ok := services[name]; !ok {
+			delete(gp.healthStats, name)
+		}
+	}
+	for name := range gp.healthHistory {
+		if _, ok := services[name]; !ok {
+			delete(gp.healthHistory, name)
+		}
+	}
+	for name := range gp.startupDeadlines {
+		if _, ok := services[name]; !ok {
+			delete(gp.startupDeadlines, name)
+		}
+	}
+	gp.notifyMu.Lock()
+	for name := range gp.notifyStates {
+		if _, ok := services[name]; !ok {
+			delete(gp.notifyStates, name)
+		}
+	}
+	gp.notifyMu.Unlock()
+
+	gp.services = services
+	gp.balancers = balancers
+	gp.breakers = breakers
+	gp.bulkheads = bulkheads
+	replacedClients := gp.serviceClients
+	gp.serviceClients = serviceClients
+	gp.mu.Unlock()
+
+	// In-flight requests finish on their connections; idle ones of replaced pools are closed
+	for name, clients := range replacedClients {
+		if serviceClients[name] != clients {
+			clients.closeIdle()
+		}
+	}
+
+	for name, err := range clientErrors {
+		gp.redis.PublishLog("error", "gateway", fmt.Sprintf("Failed to load TLS settings for %s", name), map[string]interface{}{
+			"service": name,
+			"error":   err.Error(),
+		})
+	}
+
+	// Initialize service metrics
+	gp.metrics.mu.Lock()
+	for name := range services {
+		if _, exists := gp.metrics.ServiceMetrics[name]; !exists {
+			gp.metrics.ServiceMetrics[name] = &ServiceMetrics{}
+		}
+	}
+	for name := range gp.metrics.ServiceMetrics {
+		if _, ok := services[name]; !ok {
+			delete(gp.metrics.ServiceMetrics, name)
+			delete(gp.metrics.HealthStats, name)
+		}
+	}
+	gp.metrics.mu.Unlock()
+
+	// Probe new services and pick up interval changes
+	gp.syncHealthLoops()
+}
+
+// recordHealthCheck probes a service and stores the result. Services with a
+// dependency down are marked unhealthy without a probe.
+func (gp *GatewayProcessor) recordHealthCheck(service string, serviceInfo *config.ServiceInfo) (*models.HealthCheckResult, error) {
+	result := gp.dependencyHealth(service, serviceInfo)
+	if result == nil {
+		var err error
+		result, err = gp.probeInstances(service, serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		markDegraded(result, serviceInfo)
+	}
+
+	// Store result, unless a reload removed the service while it was probed
+	gp.mu.Lock()
+	if _, registered := gp.services[service]; !registered {
+		gp.mu.Unlock()
+		return result, nil
+	}
+	if deadline, inGrace := gp.startupDeadlines[service]; inGrace {
+		if isServing(result.Status) || time.Now().After(deadline) {
+			delete(gp.startupDeadlines, service)
+		} else if result.Status == "unhealthy" {
+			// Still within the startup grace period
+			result.Status = "starting"
+		}
+	}
+	result.Flapping = gp.recordHealthHistory(service, result)
+	gp.healthStats[service] = result
+	gp.mu.Unlock()
+
+	gp.metrics.mu.Lock()
+	if _, registered := gp.metrics.ServiceMetrics[service]; registered {
+		gp.metrics.HealthStats[service] = result
+	}
+	gp.metrics.mu.Unlock()
+
+	gp.observeHealthTransition(service, result)
+
+	// Log health check metrics
+	status := 0
+	if isServing(result.Status) {
+		status = 1
+	}
+
+	gp.logMetrics("health_check", service, "GET", "/health", result.Duration, status, "", "", map[string]interface{}{
+		"health_status": result.Status,
+		"health_error":  result.Error,
+	})
+
+	return result, nil
+}
+
+// probeHealth runs a health check request without recording the result
+func (gp *GatewayProcessor) probeHealth(service string, serviceInfo *config.ServiceInfo) (*models.HealthCheckResult, error) {
+	release, err := gp.acquireProbeSlot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	startTime := time.Now()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(serviceInfo.Timeout)*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", serviceInfo.HealthCheck, nil)
+	healthURL := serviceInfo.HealthCheckURL()
+	if u, err := url.Parse(healthURL); err == nil && u.Scheme == "grpc" {
+		return gp.probeGRPCHealth(service, serviceInfo, u.Host, healthURL), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create health check request: %w", err)
 	}
 
+	// Add configured headers (e.g. auth token) for protected health endpoints
+	for key, value := range serviceInfo.HealthHeaders {
+		req.Header.Set(key, value)
+	}
+
 	// Add gateway headers
 	req.Header.Set("X-Health-Check", "true")
 	req.Header.Set("X-Gateway-Service", "gateway")
 
-	resp, err := gp.httpClient.Do(req)
+	resp, err := gp.clientsFor(service).http.Do(req)
 	duration := time.Since(startTime)
 
 	result := &models.HealthCheckResult{
 		Service:   service,
-		URL:       serviceInfo.HealthCheck,
+		URL:       healthURL,
 		Duration:  duration,
 		Timestamp: startTime,
 	}
@@ -260,24 +975,25 @@ func (gp *GatewayProcessor) performHealthCheck(service string, serviceInfo *conf
 		}
 	}
 
-	// Store result
-	gp.mu.Lock()
-	gp.healthStats[service] = result
-	gp.metrics.HealthStats[service] = result
-	gp.mu.Unlock()
+	return result, nil
+}
 
-	// Log health check metrics
-	status := 0
-	if result.Status == "healthy" {
-		status = 1
+// markDegraded downgrades a passing health check that exceeded the service's
+// latency threshold
+func markDegraded(result *models.HealthCheckResult, serviceInfo *config.ServiceInfo) {
+	if result.Status != "healthy" || serviceInfo.DegradedLatencyMs <= 0 {
+		return
 	}
+	threshold := time.Duration(serviceInfo.DegradedLatencyMs) * time.Millisecond
+	if result.Duration > threshold {
+		result.Status = "degraded"
+		result.Error = fmt.Sprintf("health check took %dms, threshold %dms", result.Duration.Milliseconds(), serviceInfo.DegradedLatencyMs)
+	}
+}
 
-	gp.logMetrics("health_check", service, "GET", "/health", duration, status, "", "", map[string]interface{}{
-		"health_status": result.Status,
-		"health_error":  result.Error,
-	})
-
-	return result, nil
+// isServing reports whether a service with this health status still receives traffic
+func isServing(status string) bool {
+	return status == "healthy" || status == "degraded"
 }
 
 func (gp *GatewayProcessor) GetServicesStatus() map[string]*models.HealthCheckResult {
@@ -302,6 +1018,12 @@ func (gp *GatewayProcessor) GetServicesStatus() map[string]*models.HealthCheckRe
 		}
 	}
 
+	for service, breaker := range gp.breakers {
+		if health, exists := result[service]; exists {
+			health.Circuit = breaker.State()
+		}
+	}
+
 	return result
 }
 
@@ -309,28 +1031,130 @@ func (gp *GatewayProcessor) GetMetrics() *GatewayMetrics {
 	gp.metrics.mu.RLock()
 	defer gp.metrics.mu.RUnlock()
 
-	// Create a copy of metrics
+	return gp.snapshotMetrics()
+}
+
+// RequiredRoles returns the roles allowed to reach a service, empty when it is
+// unrestricted or unknown
+func (gp *GatewayProcessor) RequiredRoles(service string) []string {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+
+	if serviceInfo, exists := gp.services[service]; exists {
+		return serviceInfo.RequiredRoles
+	}
+	return nil
+}
+
+// Uptime is the time since the metrics start time
+func (gp *GatewayProcessor) Uptime() time.Duration {
+	gp.metrics.mu.RLock()
+	defer gp.metrics.mu.RUnlock()
+
+	return time.Since(gp.metrics.StartTime)
+}
+
+// ResetMetrics zeroes the request counters, latencies and per-service and tag
+// metrics, returning their values from before the reset. Health stats are kept,
+// and StartTime only moves to now if resetStartTime is set.
+func (gp *GatewayProcessor) ResetMetrics(resetStartTime bool) *GatewayMetrics {
+	gp.metrics.mu.Lock()
+	snapshot := gp.snapshotMetrics()
+
+	gp.metrics.TotalRequests = 0
+	gp.metrics.SuccessRequests = 0
+	gp.metrics.ErrorRequests = 0
+	gp.metrics.ClientDisconnects = 0
+	gp.metrics.AverageLatency = 0
+	gp.metrics.ErrorAverageLatency = 0
+	gp.metrics.latencySamples = 0
+	gp.metrics.errorSamples = 0
+	gp.metrics.latency = newLatencyWindow(gp.config.Metrics.LatencyWindowSize, time.Duration(gp.config.Metrics.LatencyWindowSeconds)*time.Second)
+	for service := range gp.metrics.ServiceMetrics {
+		gp.metrics.ServiceMetrics[service] = &ServiceMetrics{}
+	}
+	gp.metrics.TagMetrics = make(map[string]*TagMetrics)
+	if resetStartTime {
+		gp.metrics.StartTime = time.Now()
+	}
+	gp.metrics.mu.Unlock()
+
+	gp.redis.PublishLog("info", "gateway", "Metrics reset", map[string]interface{}{
+		"total_requests":   snapshot.TotalRequests,
+		"error_requests":   snapshot.ErrorRequests,
+		"reset_start_time": resetStartTime,
+	})
+	return snapshot
+}
+
+// snapshotMetrics copies the metrics; the caller holds gp.metrics.mu
+func (gp *GatewayProcessor) snapshotMetrics() *GatewayMetrics {
+	p50, p95, p99 := gp.metrics.latency.percentiles()
 	result := &GatewayMetrics{
-		TotalRequests:   gp.metrics.TotalRequests,
-		SuccessRequests: gp.metrics.SuccessRequests,
-		ErrorRequests:   gp.metrics.ErrorRequests,
-		AverageLatency:  gp.metrics.AverageLatency,
-		ServiceMetrics:  make(map[string]*ServiceMetrics),
-		HealthStats:     make(map[string]*models.HealthCheckResult),
-		StartTime:       gp.metrics.StartTime,
+		TotalRequests:       gp.metrics.TotalRequests,
+		SuccessRequests:     gp.metrics.SuccessRequests,
+		ErrorRequests:       gp.metrics.ErrorRequests,
+		ClientDisconnects:   gp.metrics.ClientDisconnects,
+		InFlightRequests:    gp.requests.active.Load(),
+		UpstreamConnections: openUpstreamConns.Load(),
+		Goroutines:          runtime.NumGoroutine(),
+		AverageLatency:      gp.metrics.AverageLatency,
+		ErrorAverageLatency: gp.metrics.ErrorAverageLatency,
+		P50Latency:          p50,
+		P95Latency:          p95,
+		P99Latency:          p99,
+		ServiceMetrics:      make(map[string]*ServiceMetrics),
+		TagMetrics:          make(map[string]*TagMetrics, len(gp.metrics.TagMetrics)),
+		HealthStats:         make(map[string]*models.HealthCheckResult),
+		StartTime:           gp.metrics.StartTime,
 	}
 
 	// Copy service metrics
 	for service, metrics := range gp.metrics.ServiceMetrics {
+		histogram := make(map[string]int64, len(metrics.HeaderSizeHistogram))
+		for bucket, count := range metrics.HeaderSizeHistogram {
+			histogram[bucket] = count
+		}
+
+		var p50, p95, p99 float64
+		if metrics.latency != nil {
+			p50, p95, p99 = metrics.latency.percentiles()
+		}
+
 		result.ServiceMetrics[service] = &ServiceMetrics{
-			TotalRequests:   metrics.TotalRequests,
-			SuccessRequests: metrics.SuccessRequests,
-			ErrorRequests:   metrics.ErrorRequests,
-			AverageLatency:  metrics.AverageLatency,
-			LastRequest:     metrics.LastRequest,
+			TotalRequests:       metrics.TotalRequests,
+			SuccessRequests:     metrics.SuccessRequests,
+			ErrorRequests:       metrics.ErrorRequests,
+			ClientDisconnects:   metrics.ClientDisconnects,
+			AverageLatency:      metrics.AverageLatency,
+			ErrorAverageLatency: metrics.ErrorAverageLatency,
+			P50Latency:          p50,
+			P95Latency:          p95,
+			P99Latency:          p99,
+			LastRequest:         metrics.LastRequest,
+			CacheHits:           metrics.CacheHits,
+			CacheMisses:         metrics.CacheMisses,
+			HeaderRequests:      metrics.HeaderRequests,
+			AverageHeaderBytes:  metrics.AverageHeaderBytes,
+			HeaderSizeHistogram: histogram,
 		}
 	}
 
+	// Copy tag metrics
+	for tag, metrics := range gp.metrics.TagMetrics {
+		tagCopy := *metrics
+		result.TagMetrics[tag] = &tagCopy
+	}
+
+	// Bulkhead queue state
+	gp.mu.RLock()
+	for service, bulkhead := range gp.bulkheads {
+		if serviceMetrics, exists := result.ServiceMetrics[service]; exists {
+			serviceMetrics.QueueDepth, serviceMetrics.QueueWaitMs = bulkhead.Stats()
+		}
+	}
+	gp.mu.RUnlock()
+
 	// Copy health stats
 	for service, health := range gp.metrics.HealthStats {
 		healthCopy := *health
@@ -341,20 +1165,28 @@ func (gp *GatewayProcessor) GetMetrics() *GatewayMetrics {
 }
 
 func (gp *GatewayProcessor) StartHealthChecker() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	if gp.stopped() {
+		return
+	}
+
+	// Each service is probed on its own timer; this loop only logs the summary
+	gp.loopMu.Lock()
+	gp.healthChecking = true
+	gp.loopMu.Unlock()
+	gp.syncHealthLoops()
 
-	// Initial health check
-	gp.checkAllServices()
+	ticker := time.NewTicker(gp.healthCheckInterval())
+	defer ticker.Stop()
 
 	gp.redis.PublishLog("info", "gateway", "Health checker started", map[string]interface{}{
-		"interval_seconds": 30,
+		"interval_seconds": gp.config.HealthCheck.IntervalSeconds,
+		"stagger":          gp.config.HealthCheck.Stagger,
 	})
 
 	for {
 		select {
 		case <-ticker.C:
-			gp.checkAllServices()
+			gp.logHealthSummary()
 		case <-gp.stopChan:
 			gp.redis.PublishLog("info", "gateway", "Health checker stopped", nil)
 			return
@@ -363,6 +1195,10 @@ func (gp *GatewayProcessor) StartHealthChecker() {
 }
 
 func (gp *GatewayProcessor) StartMetricsCollector() {
+	if gp.stopped() {
+		return
+	}
+
 	ticker := time.NewTicker(60 * time.Second) // Collect metrics every minute
 	defer ticker.Stop()
 
@@ -381,84 +1217,153 @@ func (gp *GatewayProcessor) StartMetricsCollector() {
 	}
 }
 
+// Stop ends the background checkers; calling it more than once is a no-op
 func (gp *GatewayProcessor) Stop() {
-	gp.redis.PublishLog("info", "gateway", "Gateway processor stopping", nil)
-	close(gp.stopChan)
+	gp.stopOnce.Do(func() {
+		gp.redis.PublishLog("info", "gateway", "Gateway processor stopping", nil)
+		close(gp.stopChan)
+		gp.closeGRPCConns()
+	})
 }
 
-// Private helper methods
-func (gp *GatewayProcessor) checkAllServices() {
-	var wg sync.WaitGroup
-
-	gp.mu.RLock()
-	services := make(map[string]*config.ServiceInfo)
-	for k, v := range gp.services {
-		services[k] = v
-	}
-	gp.mu.RUnlock()
-
-	for service, serviceInfo := range services {
-		wg.Add(1)
-		go func(s string, si *config.ServiceInfo) {
-			defer wg.Done()
-			gp.performHealthCheck(s, si)
-		}(service, serviceInfo)
+func (gp *GatewayProcessor) stopped() bool {
+	select {
+	case <-gp.stopChan:
+		return true
+	default:
+		return false
 	}
+}
 
-	wg.Wait()
+// Private helper methods
 
-	// Log health check summary
+// logHealthSummary logs how many services passed their latest health check
+func (gp *GatewayProcessor) logHealthSummary() {
 	healthy := 0
-	total := len(services)
+	degraded := 0
+	starting := 0
+	var flapping []string
 
 	gp.mu.RLock()
-	for _, health := range gp.healthStats {
-		if health.Status == "healthy" {
+	total := len(gp.services)
+	for service, health := range gp.healthStats {
+		switch health.Status {
+		case "healthy":
 			healthy++
+		case "degraded":
+			degraded++
+		case "starting":
+			starting++
+		}
+		if health.Flapping {
+			flapping = append(flapping, service)
 		}
 	}
 	gp.mu.RUnlock()
+	sort.Strings(flapping)
 
-	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Health check completed: %d/%d services healthy", healthy, total), map[string]interface{}{
-		"healthy_count": healthy,
-		"total_count":   total,
+	message := fmt.Sprintf("Health check completed: %d/%d services healthy", healthy, total)
+	if degraded > 0 {
+		message += fmt.Sprintf(", %d degraded", degraded)
+	}
+	if len(flapping) > 0 {
+		message += fmt.Sprintf(", %d flapping", len(flapping))
+	}
+	gp.redis.PublishLog("info", "gateway", message, map[string]interface{}{
+		"healthy_count":  healthy,
+		"degraded_count": degraded,
+		"starting_count": starting,
+		"total_count":    total,
+		"flapping":       flapping,
 	})
 }
 
+func (gp *GatewayProcessor) healthCheckInterval() time.Duration {
+	if gp.config.HealthCheck.IntervalSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(gp.config.HealthCheck.IntervalSeconds) * time.Second
+}
+
+// probeOffsets spreads probes evenly across the check interval when staggering is
+// enabled, so services sharing a dependency aren't all probed at the same instant.
+// Each probe gets a random jitter within its slot to avoid lockstep across gateways.
+func (gp *GatewayProcessor) probeOffsets(services map[string]*config.ServiceInfo) map[string]time.Duration {
+	offsets := make(map[string]time.Duration, len(services))
+	if !gp.config.HealthCheck.Stagger || len(services) < 2 {
+		return offsets
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	slot := gp.healthCheckInterval() / time.Duration(len(names))
+	for i, name := range names {
+		offsets[name] = time.Duration(i)*slot + time.Duration(rand.Int63n(int64(slot)/2+1))
+	}
+
+	return offsets
+}
+
 func (gp *GatewayProcessor) collectAndPublishMetrics() {
 	// Get current metrics
 	metrics := gp.GetMetrics()
 
 	// Publish to Redis
 	gp.redis.PublishMetrics("gateway_summary", "gateway", map[string]interface{}{
-		"total_requests":   metrics.TotalRequests,
-		"success_requests": metrics.SuccessRequests,
-		"error_requests":   metrics.ErrorRequests,
-		"average_latency":  metrics.AverageLatency,
-		"uptime_seconds":   time.Since(metrics.StartTime).Seconds(),
-		"services_count":   len(metrics.ServiceMetrics),
-		"healthy_services": gp.countHealthyServices(),
+		"total_requests":        metrics.TotalRequests,
+		"success_requests":      metrics.SuccessRequests,
+		"error_requests":        metrics.ErrorRequests,
+		"average_latency":       metrics.AverageLatency,
+		"error_average_latency": metrics.ErrorAverageLatency,
+		"p50_latency":           metrics.P50Latency,
+		"p95_latency":           metrics.P95Latency,
+		"p99_latency":           metrics.P99Latency,
+		"uptime_seconds":        time.Since(metrics.StartTime).Seconds(),
+		"services_count":        len(metrics.ServiceMetrics),
+		"healthy_services":      gp.countHealthyServices(),
+		"in_flight_requests":    metrics.InFlightRequests,
+		"upstream_connections":  metrics.UpstreamConnections,
+		"goroutines":            metrics.Goroutines,
 	})
 
+	// Publish per-tag metrics
+	for tag, tagMetrics := range metrics.TagMetrics {
+		gp.redis.PublishMetrics("tag_summary", "gateway", map[string]interface{}{
+			"tag":             tag,
+			"total_requests":  tagMetrics.TotalRequests,
+			"error_requests":  tagMetrics.ErrorRequests,
+			"average_latency": tagMetrics.AverageLatency,
+		})
+	}
+
 	// Publish per-service metrics
 	for service, serviceMetrics := range metrics.ServiceMetrics {
 		gp.redis.PublishMetrics("service_summary", service, map[string]interface{}{
-			"total_requests":   serviceMetrics.TotalRequests,
-			"success_requests": serviceMetrics.SuccessRequests,
-			"error_requests":   serviceMetrics.ErrorRequests,
-			"average_latency":  serviceMetrics.AverageLatency,
-			"last_request":     serviceMetrics.LastRequest.Unix(),
+			"total_requests":        serviceMetrics.TotalRequests,
+			"success_requests":      serviceMetrics.SuccessRequests,
+			"error_requests":        serviceMetrics.ErrorRequests,
+			"average_latency":       serviceMetrics.AverageLatency,
+			"error_average_latency": serviceMetrics.ErrorAverageLatency,
+			"p50_latency":           serviceMetrics.P50Latency,
+			"p95_latency":           serviceMetrics.P95Latency,
+			"p99_latency":           serviceMetrics.P99Latency,
+			"last_request":          serviceMetrics.LastRequest.Unix(),
 		})
 	}
 }
 
+// countHealthyServices counts services that are healthy or degraded
 func (gp *GatewayProcessor) countHealthyServices() int {
 	gp.mu.RLock()
 	defer gp.mu.RUnlock()
 
 	count := 0
 	for _, health := range gp.healthStats {
-		if health.Status == "healthy" {
+		if isServing(health.Status) {
 			count++
 		}
 	}
@@ -489,26 +1394,65 @@ func (gp *GatewayProcessor) updateRequestMetrics(service string, success bool) {
 	}
 }
 
-func (gp *GatewayProcessor) updateLatencyMetrics(service string, duration time.Duration) {
+// cachedResponse finishes a response served from the cache
+func (gp *GatewayProcessor) cachedResponse(cached *models.ProxyResponse, cacheStatus, service, method, path, route string, startTime time.Time, userID, requestID string, metricLabels map[string]string) *models.ProxyResponse {
+	cached.Headers = gp.limitResponseHeaders(service, cached.Headers)
+	cached.Duration = time.Since(startTime)
+	gp.updateRequestMetrics(service, true)
+	gp.updateLatencyMetrics(service, cached.Duration, true)
+	gp.logMetrics("request", service, method, path, cached.Duration, cached.StatusCode, userID, requestID, withLabels(map[string]interface{}{
+		"success": true,
+		"cache":   cacheStatus,
+		"route":   route,
+	}, metricLabels))
+	return cached
+}
+
+func (gp *GatewayProcessor) recordCacheResult(service string, hit bool) {
+	gp.metrics.mu.Lock()
+	defer gp.metrics.mu.Unlock()
+
+	if serviceMetrics, exists := gp.metrics.ServiceMetrics[service]; exists {
+		if hit {
+			serviceMetrics.CacheHits++
+		} else {
+			serviceMetrics.CacheMisses++
+		}
+	}
+}
+
+// updateLatencyMetrics records a request's latency in the success or error
+// average, so failures (often timeouts) don't skew AverageLatency. Percentiles
+// are computed over both.
+func (gp *GatewayProcessor) updateLatencyMetrics(service string, duration time.Duration, success bool) {
 	gp.metrics.mu.Lock()
 	defer gp.metrics.mu.Unlock()
 
 	latencyMs := float64(duration.Milliseconds())
 
-	// Update global average latency (simple moving average)
-	if gp.metrics.TotalRequests == 1 {
-		gp.metrics.AverageLatency = latencyMs
+	// Averages count their own samples: not every counted request has a latency
+	if success {
+		gp.metrics.latencySamples++
+		gp.metrics.AverageLatency += (latencyMs - gp.metrics.AverageLatency) / float64(gp.metrics.latencySamples)
 	} else {
-		gp.metrics.AverageLatency = (gp.metrics.AverageLatency*float64(gp.metrics.TotalRequests-1) + latencyMs) / float64(gp.metrics.TotalRequests)
+		gp.metrics.errorSamples++
+		gp.metrics.ErrorAverageLatency += (latencyMs - gp.metrics.ErrorAverageLatency) / float64(gp.metrics.errorSamples)
 	}
+	gp.metrics.latency.add(latencyMs)
 
 	// Update service average latency
 	if serviceMetrics, exists := gp.metrics.ServiceMetrics[service]; exists {
-		if serviceMetrics.TotalRequests == 1 {
-			serviceMetrics.AverageLatency = latencyMs
+		if success {
+			serviceMetrics.latencySamples++
+			serviceMetrics.AverageLatency += (latencyMs - serviceMetrics.AverageLatency) / float64(serviceMetrics.latencySamples)
 		} else {
-			serviceMetrics.AverageLatency = (serviceMetrics.AverageLatency*float64(serviceMetrics.TotalRequests-1) + latencyMs) / float64(serviceMetrics.TotalRequests)
+			serviceMetrics.errorSamples++
+			serviceMetrics.ErrorAverageLatency += (latencyMs - serviceMetrics.ErrorAverageLatency) / float64(serviceMetrics.errorSamples)
+		}
+		if serviceMetrics.latency == nil {
+			serviceMetrics.latency = newLatencyWindow(gp.config.Metrics.LatencyWindowSize, time.Duration(gp.config.Metrics.LatencyWindowSeconds)*time.Second)
 		}
+		serviceMetrics.latency.add(latencyMs)
 	}
 }
 
@@ -517,11 +1461,53 @@ func (gp *GatewayProcessor) logRequest(req models.ProxyRequest) {
 		"service":    req.Service,
 		"method":     req.Method,
 		"path":       req.Path,
+		"route":      req.Route,
 		"user_id":    req.UserID,
 		"request_id": req.RequestID,
 	})
 }
 
+// resolveMetricLabels maps configured request headers to label values, bucketing
+// unexpected values into "other" and absent headers into "none"
+func (gp *GatewayProcessor) resolveMetricLabels(headers map[string]string) map[string]string {
+	if len(gp.config.Metrics.Labels) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(gp.config.Metrics.Labels))
+	for _, label := range gp.config.Metrics.Labels {
+		value, ok := headers[http.CanonicalHeaderKey(label.Header)]
+		if !ok || value == "" {
+			labels[label.Name] = "none"
+			continue
+		}
+
+		labels[label.Name] = "other"
+		for _, allowed := range label.AllowedValues {
+			if value == allowed {
+				labels[label.Name] = value
+				break
+			}
+		}
+	}
+
+	return labels
+}
+
+// withLabels adds metric labels to event metadata under a "label_" prefix
+func withLabels(metadata map[string]interface{}, labels map[string]string) map[string]interface{} {
+	for name, value := range labels {
+		metadata["label_"+name] = value
+	}
+	return metadata
+}
+
+func isUpstreamDownStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
 func (gp *GatewayProcessor) logMetrics(eventType, service, method, path string, duration time.Duration, status int, userID, requestID string, metadata map[string]interface{}) {
 	metrics := map[string]interface{}{
 		"method":      method,
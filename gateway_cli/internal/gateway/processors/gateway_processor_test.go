@@ -0,0 +1,274 @@
+package processors
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// newTestProcessor starts a processor backed by miniredis serving the given
+// services. setup, if set, adjusts the default config first.
+func newTestProcessor(t *testing.T, services map[string]config.ServiceInfo, setup func(*config.Config)) (*GatewayProcessor, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.Services.Discovery = config.DiscoveryStatic
+	cfg.Services.Registry = services
+	if setup != nil {
+		setup(cfg)
+	}
+
+	cfg.Redis.URL = "redis://" + mr.Addr()
+	redisClient, err := redis.NewClient(cfg.Redis)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { redisClient.Close() })
+
+	gp := NewGatewayProcessor(cfg, redisClient)
+	gp.Start()
+	return gp, mr
+}
+
+// statusUpstream answers 500 on paths starting with /fail and 200 otherwise
+func statusUpstream(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestConcurrentRequestsAreCountedOnce(t *testing.T) {
+	upstream := statusUpstream(t)
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 5),
+	}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		path := "/ok"
+		if i%2 == 1 {
+			path = "/fail"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gp.ProxyRequest(context.Background(), "devices", path, path, http.MethodGet, nil, nil, "", nil)
+		}()
+	}
+	wg.Wait()
+
+	metrics := gp.GetMetrics()
+	if metrics.TotalRequests != 40 || metrics.SuccessRequests != 20 || metrics.ErrorRequests != 20 {
+		t.Fatalf("total/success/error = %d/%d/%d, want 40/20/20", metrics.TotalRequests, metrics.SuccessRequests, metrics.ErrorRequests)
+	}
+	service := metrics.ServiceMetrics["devices"]
+	if service.TotalRequests != 40 || service.SuccessRequests != 20 || service.ErrorRequests != 20 {
+		t.Fatalf("service total/success/error = %d/%d/%d, want 40/20/20", service.TotalRequests, service.SuccessRequests, service.ErrorRequests)
+	}
+}
+
+func TestConcurrentLatencyUpdatesKeepAverage(t *testing.T) {
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", "http://devices.test", "", 5),
+	}, nil)
+
+	// Latencies 1..100ms in any order average to 50.5ms
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(latency time.Duration) {
+			defer wg.Done()
+			gp.updateRequestMetrics("devices", true)
+			gp.updateLatencyMetrics("devices", latency, true)
+		}(time.Duration(i) * time.Millisecond)
+	}
+	wg.Wait()
+
+	metrics := gp.GetMetrics()
+	if metrics.TotalRequests != 100 {
+		t.Fatalf("total requests = %d, want 100", metrics.TotalRequests)
+	}
+	if math.Abs(metrics.AverageLatency-50.5) > 1e-9 {
+		t.Fatalf("average latency = %v, want 50.5", metrics.AverageLatency)
+	}
+	if got := metrics.ServiceMetrics["devices"].AverageLatency; math.Abs(got-50.5) > 1e-9 {
+		t.Fatalf("service average latency = %v, want 50.5", got)
+	}
+}
+
+func TestFailuresDoNotSkewAverageLatency(t *testing.T) {
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", "http://devices.test", "", 5),
+	}, nil)
+
+	sequence := []struct {
+		latency time.Duration
+		success bool
+	}{
+		{10 * time.Millisecond, true},
+		{5 * time.Second, false},
+		{20 * time.Millisecond, true},
+		{1 * time.Second, false},
+		{30 * time.Millisecond, true},
+	}
+	for _, sample := range sequence {
+		gp.updateRequestMetrics("devices", sample.success)
+		gp.updateLatencyMetrics("devices", sample.latency, sample.success)
+	}
+
+	metrics := gp.GetMetrics()
+	if metrics.AverageLatency != 20 || metrics.ErrorAverageLatency != 3000 {
+		t.Fatalf("success/error average = %v/%v ms, want 20/3000", metrics.AverageLatency, metrics.ErrorAverageLatency)
+	}
+	service := metrics.ServiceMetrics["devices"]
+	if service.AverageLatency != 20 || service.ErrorAverageLatency != 3000 {
+		t.Fatalf("service success/error average = %v/%v ms, want 20/3000", service.AverageLatency, service.ErrorAverageLatency)
+	}
+}
+
+func TestResetMetricsDuringUpdates(t *testing.T) {
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", "http://devices.test", "", 5),
+	}, nil)
+	startTime := gp.GetMetrics().StartTime
+
+	const writers, updates = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(success bool) {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				gp.updateRequestMetrics("devices", success)
+				gp.updateLatencyMetrics("devices", time.Millisecond, success)
+			}
+		}(w%2 == 0)
+	}
+
+	// Reset while the writers are running
+	for gp.GetMetrics().TotalRequests < writers*updates/4 {
+		time.Sleep(time.Millisecond)
+	}
+	snapshot := gp.ResetMetrics(false)
+	wg.Wait()
+
+	// Every update lands either before the reset, in the snapshot, or after it
+	after := gp.GetMetrics()
+	if snapshot.TotalRequests+after.TotalRequests != writers*updates {
+		t.Fatalf("snapshot %d + after %d requests, want %d", snapshot.TotalRequests, after.TotalRequests, writers*updates)
+	}
+	if snapshot.TotalRequests == 0 || snapshot.SuccessRequests+snapshot.ErrorRequests != snapshot.TotalRequests {
+		t.Fatalf("snapshot total/success/error = %d/%d/%d, want a consistent non-empty snapshot",
+			snapshot.TotalRequests, snapshot.SuccessRequests, snapshot.ErrorRequests)
+	}
+	service := snapshot.ServiceMetrics["devices"]
+	if service == nil || service.TotalRequests != snapshot.TotalRequests {
+		t.Fatalf("snapshot service metrics = %+v, want %d requests", service, snapshot.TotalRequests)
+	}
+	if !after.StartTime.Equal(startTime) {
+		t.Fatalf("start time moved to %v, want it kept at %v", after.StartTime, startTime)
+	}
+}
+
+func TestDegradedLatencyBoundaries(t *testing.T) {
+	tests := []struct {
+		status    string
+		duration  time.Duration
+		threshold int
+		want      string
+	}{
+		{"healthy", 99 * time.Millisecond, 100, "healthy"},
+		{"healthy", 100 * time.Millisecond, 100, "healthy"},
+		{"healthy", 101 * time.Millisecond, 100, "degraded"},
+		{"healthy", time.Minute, 0, "healthy"},
+		{"unhealthy", time.Second, 100, "unhealthy"},
+	}
+	for _, tt := range tests {
+		result := &models.HealthCheckResult{Status: tt.status, Duration: tt.duration}
+		markDegraded(result, &config.ServiceInfo{DegradedLatencyMs: tt.threshold})
+		if result.Status != tt.want {
+			t.Errorf("%s check taking %v with threshold %dms = %s, want %s", tt.status, tt.duration, tt.threshold, result.Status, tt.want)
+		}
+		if (result.Status == "degraded") != (result.Error != "") {
+			t.Errorf("%s check taking %v: error %q", tt.status, tt.duration, result.Error)
+		}
+	}
+}
+
+func TestSlowHealthCheckReportsDegraded(t *testing.T) {
+	upstream := delayedUpstream(t, 60*time.Millisecond, false)
+	info := config.NewServiceInfo("devices", upstream.URL, "", 5)
+	info.DegradedLatencyMs = 20
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, nil)
+
+	result, err := gp.CheckServiceHealth("devices")
+	if err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	if result.Status != "degraded" {
+		t.Fatalf("status = %s, want degraded", result.Status)
+	}
+	if gp.countHealthyServices() != 1 {
+		t.Fatal("a degraded service should still count as serving")
+	}
+}
+
+func TestStopTwiceEndsBackgroundWorkers(t *testing.T) {
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", "http://devices.test", "", 5),
+	}, nil)
+
+	workers := []func(){gp.StartHealthChecker, gp.StartMetricsCollector}
+	done := make(chan struct{}, len(workers))
+	for _, worker := range workers {
+		go func(worker func()) {
+			worker()
+			done <- struct{}{}
+		}(worker)
+	}
+
+	gp.Stop()
+	gp.Stop()
+
+	for range workers {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("background worker still running after Stop")
+		}
+	}
+
+	// Workers started after Stop return right away
+	for _, worker := range workers {
+		returned := make(chan struct{})
+		go func() {
+			worker()
+			close(returned)
+		}()
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatal("worker started after Stop kept running")
+		}
+	}
+}
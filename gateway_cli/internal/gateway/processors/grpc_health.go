@@ -0,0 +1,103 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// grpcConn returns a shared client connection for target, creating it on first
+// use. Connections use TLS when the service has TLS settings.
+func (gp *GatewayProcessor) grpcConn(target string, tlsSettings *config.TLSConfig) (*grpc.ClientConn, error) {
+	gp.grpcMu.Lock()
+	defer gp.grpcMu.Unlock()
+
+	key := target
+	if tlsSettings != nil {
+		key = "tls:" + target
+	}
+	if conn, exists := gp.grpcConns[key]; exists {
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if tlsSettings != nil {
+		tlsConfig, err := tlsSettings.Build()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	gp.grpcConns[key] = conn
+	return conn, nil
+}
+
+// probeGRPCHealth runs the standard grpc.health.v1.Health/Check RPC against target
+func (gp *GatewayProcessor) probeGRPCHealth(service string, serviceInfo *config.ServiceInfo, target, healthURL string) *models.HealthCheckResult {
+	startTime := time.Now()
+
+	result := &models.HealthCheckResult{
+		Service:   service,
+		URL:       healthURL,
+		Timestamp: startTime,
+	}
+
+	conn, err := gp.grpcConn(target, serviceInfo.TLS)
+	if err != nil {
+		result.Status = "unhealthy"
+		result.Error = fmt.Sprintf("grpc connection: %v", err)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(serviceInfo.Timeout)*time.Second)
+	defer cancel()
+
+	// Health headers are sent as request metadata
+	md := metadata.Pairs("x-health-check", "true", "x-gateway-service", "gateway")
+	for key, value := range serviceInfo.HealthHeaders {
+		md.Append(key, value)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: serviceInfo.GRPCHealthService,
+	})
+	result.Duration = time.Since(startTime)
+
+	if err != nil {
+		result.Status = "unhealthy"
+		result.Error = err.Error()
+	} else if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		result.Status = "unhealthy"
+		result.Error = fmt.Sprintf("grpc status: %s", resp.GetStatus())
+	} else {
+		result.Status = "healthy"
+	}
+
+	return result
+}
+
+func (gp *GatewayProcessor) closeGRPCConns() {
+	gp.grpcMu.Lock()
+	defer gp.grpcMu.Unlock()
+
+	for target, conn := range gp.grpcConns {
+		conn.Close()
+		delete(gp.grpcConns, target)
+	}
+}
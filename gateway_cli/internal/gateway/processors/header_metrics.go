@@ -0,0 +1,73 @@
+package processors
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Upper bounds (bytes) of the request header size histogram buckets
+var headerSizeBuckets = []int{1024, 2048, 4096, 8192, 16384, 32768}
+
+const (
+	// Slow and fast moving averages used to spot header sizes creeping up
+	headerBaselineAlpha = 0.01
+	headerRecentAlpha   = 0.2
+	headerCreepFactor   = 1.5
+	headerCreepSamples  = 100
+	headerAlertCooldown = 10 * time.Minute
+)
+
+// RecordHeaderSize adds the total request header size of a request to the
+// service's metrics and warns when the recent average grows well past the baseline
+func (gp *GatewayProcessor) RecordHeaderSize(service string, headerBytes int) {
+	gp.metrics.mu.Lock()
+	serviceMetrics, exists := gp.metrics.ServiceMetrics[service]
+	if !exists {
+		gp.metrics.mu.Unlock()
+		return
+	}
+
+	size := float64(headerBytes)
+	serviceMetrics.HeaderRequests++
+	if serviceMetrics.HeaderRequests == 1 {
+		serviceMetrics.AverageHeaderBytes = size
+		serviceMetrics.headerBaseline = size
+		serviceMetrics.headerRecent = size
+	} else {
+		serviceMetrics.AverageHeaderBytes = (serviceMetrics.AverageHeaderBytes*float64(serviceMetrics.HeaderRequests-1) + size) / float64(serviceMetrics.HeaderRequests)
+		serviceMetrics.headerBaseline += headerBaselineAlpha * (size - serviceMetrics.headerBaseline)
+		serviceMetrics.headerRecent += headerRecentAlpha * (size - serviceMetrics.headerRecent)
+	}
+
+	if serviceMetrics.HeaderSizeHistogram == nil {
+		serviceMetrics.HeaderSizeHistogram = make(map[string]int64)
+	}
+	serviceMetrics.HeaderSizeHistogram[headerSizeBucket(headerBytes)]++
+
+	creeping := serviceMetrics.HeaderRequests >= headerCreepSamples &&
+		serviceMetrics.headerRecent > serviceMetrics.headerBaseline*headerCreepFactor &&
+		time.Since(serviceMetrics.headerAlertAt) > headerAlertCooldown
+	baseline, recent := serviceMetrics.headerBaseline, serviceMetrics.headerRecent
+	if creeping {
+		serviceMetrics.headerAlertAt = time.Now()
+	}
+	gp.metrics.mu.Unlock()
+
+	if creeping {
+		gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Request header size for %s is growing", service), map[string]interface{}{
+			"service":               service,
+			"baseline_header_bytes": int(baseline),
+			"recent_header_bytes":   int(recent),
+		})
+	}
+}
+
+func headerSizeBucket(headerBytes int) string {
+	for _, bound := range headerSizeBuckets {
+		if headerBytes <= bound {
+			return "le_" + strconv.Itoa(bound)
+		}
+	}
+	return "gt_" + strconv.Itoa(headerSizeBuckets[len(headerSizeBuckets)-1])
+}
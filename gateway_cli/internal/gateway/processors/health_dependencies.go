@@ -0,0 +1,53 @@
+package processors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// dependencyHealth checks a service's dependencies before it is probed. Results
+// older than a dependency's own interval are refreshed first, so the chain is
+// checked from the bottom up. If a dependency is down, the returned result marks
+// the service unhealthy and names the failed service at the root of the chain;
+// otherwise it returns nil and the service should be probed.
+func (gp *GatewayProcessor) dependencyHealth(service string, serviceInfo *config.ServiceInfo) *models.HealthCheckResult {
+	for _, dependency := range serviceInfo.DependsOn {
+		gp.mu.RLock()
+		dependencyInfo, exists := gp.services[dependency]
+		health := gp.healthStats[dependency]
+		gp.mu.RUnlock()
+		if !exists {
+			continue
+		}
+
+		if health == nil || time.Since(health.Timestamp) > gp.serviceHealthInterval(dependencyInfo) {
+			refreshed, err := gp.performHealthCheck(dependency, dependencyInfo)
+			if err != nil {
+				continue
+			}
+			health = refreshed
+		}
+
+		if health.Status != "unhealthy" {
+			continue
+		}
+
+		root := health.DependencyDown
+		if root == "" {
+			root = dependency
+		}
+		return &models.HealthCheckResult{
+			Service:        service,
+			Status:         "unhealthy",
+			URL:            serviceInfo.HealthCheckURL(),
+			Error:          fmt.Sprintf("dependency %s down", root),
+			Timestamp:      time.Now(),
+			DependencyDown: root,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package processors
+
+import (
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestDependencyChainReportsRootFailure(t *testing.T) {
+	healthy, _ := countingUpstream(t)
+	down, _ := countingUpstream(t)
+	down.Close()
+
+	devices := config.NewServiceInfo("devices", down.URL, "", 1)
+	automation := config.NewServiceInfo("automation", healthy.URL, "", 1)
+	automation.DependsOn = []string{"devices"}
+	scenes := config.NewServiceInfo("scenes", healthy.URL, "", 1)
+	scenes.DependsOn = []string{"automation"}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices":    devices,
+		"automation": automation,
+		"scenes":     scenes,
+	}, nil)
+
+	result, err := gp.CheckServiceHealth("scenes")
+	if err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	if result.Status != "unhealthy" || result.Error != "dependency devices down" || result.DependencyDown != "devices" {
+		t.Fatalf("scenes = %s (%s, root %q), want unhealthy (dependency devices down)", result.Status, result.Error, result.DependencyDown)
+	}
+
+	// The chain was checked bottom up on the way
+	status := gp.GetServicesStatus()
+	if automation := status["automation"]; automation.Status != "unhealthy" || automation.Error != "dependency devices down" {
+		t.Fatalf("automation = %s (%s), want unhealthy (dependency devices down)", automation.Status, automation.Error)
+	}
+	if devices := status["devices"]; devices.Status != "unhealthy" || devices.DependencyDown != "" {
+		t.Fatalf("devices = %s (root %q), want unhealthy on its own probe", devices.Status, devices.DependencyDown)
+	}
+
+	// Once the root recovers, dependents are probed themselves
+	gp.swapServices(map[string]config.ServiceInfo{
+		"devices":    config.NewServiceInfo("devices", healthy.URL, "", 1),
+		"automation": automation,
+		"scenes":     scenes,
+	})
+	if _, err := gp.CheckServiceHealth("devices"); err != nil {
+		t.Fatalf("devices health check: %v", err)
+	}
+	if _, err := gp.CheckServiceHealth("automation"); err != nil {
+		t.Fatalf("automation health check: %v", err)
+	}
+	if result, _ := gp.CheckServiceHealth("scenes"); result.Status != "healthy" || result.DependencyDown != "" {
+		t.Fatalf("scenes after recovery = %s (%s), want healthy", result.Status, result.Error)
+	}
+}
@@ -0,0 +1,41 @@
+package processors
+
+import (
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// healthFlight is a health check in progress that concurrent callers wait on
+type healthFlight struct {
+	done   chan struct{}
+	result *models.HealthCheckResult
+	err    error
+}
+
+// performHealthCheck runs a health check for service. With dedupe enabled, a
+// manual check and a scheduled one for the same service share a single probe
+// and its result is stored once.
+func (gp *GatewayProcessor) performHealthCheck(service string, serviceInfo *config.ServiceInfo) (*models.HealthCheckResult, error) {
+	if !gp.config.HealthCheck.Dedupe {
+		return gp.recordHealthCheck(service, serviceInfo)
+	}
+
+	gp.flightMu.Lock()
+	if flight, inFlight := gp.healthFlights[service]; inFlight {
+		gp.flightMu.Unlock()
+		<-flight.done
+		return flight.result, flight.err
+	}
+	flight := &healthFlight{done: make(chan struct{})}
+	gp.healthFlights[service] = flight
+	gp.flightMu.Unlock()
+
+	flight.result, flight.err = gp.recordHealthCheck(service, serviceInfo)
+
+	gp.flightMu.Lock()
+	delete(gp.healthFlights, service)
+	gp.flightMu.Unlock()
+	close(flight.done)
+
+	return flight.result, flight.err
+}
@@ -0,0 +1,99 @@
+package processors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// healthHistory is a ring buffer of a service's latest health checks
+type healthHistory struct {
+	entries []models.HealthHistoryEntry
+	next    int
+	full    bool
+}
+
+// newHealthHistory keeps the last size results, at least one
+func newHealthHistory(size int) *healthHistory {
+	size = max(size, 1)
+	return &healthHistory{entries: make([]models.HealthHistoryEntry, size)}
+}
+
+func (h *healthHistory) add(entry models.HealthHistoryEntry) {
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the entries oldest first
+func (h *healthHistory) list() []models.HealthHistoryEntry {
+	if !h.full {
+		return append([]models.HealthHistoryEntry(nil), h.entries[:h.next]...)
+	}
+	return append(append([]models.HealthHistoryEntry(nil), h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+// changesSince counts status changes between entries recorded after since
+func (h *healthHistory) changesSince(since time.Time) int {
+	changes := 0
+	previous := ""
+	for _, entry := range h.list() {
+		if entry.Timestamp.Before(since) {
+			previous = entry.Status
+			continue
+		}
+		if previous != "" && entry.Status != previous {
+			changes++
+		}
+		previous = entry.Status
+	}
+	return changes
+}
+
+// recordHealthHistory appends a result to the service's history and reports
+// whether the service is flapping. Callers hold gp.mu.
+func (gp *GatewayProcessor) recordHealthHistory(service string, result *models.HealthCheckResult) bool {
+	history, exists := gp.healthHistory[service]
+	if !exists {
+		history = newHealthHistory(gp.config.HealthCheck.HistorySize)
+		gp.healthHistory[service] = history
+	}
+
+	history.add(models.HealthHistoryEntry{
+		Status:     result.Status,
+		DurationMs: result.Duration.Milliseconds(),
+		Error:      result.Error,
+		Timestamp:  result.Timestamp,
+	})
+
+	return history.changesSince(gp.flapWindowStart()) >= gp.config.HealthCheck.FlapThreshold
+}
+
+func (gp *GatewayProcessor) flapWindowStart() time.Time {
+	return time.Now().Add(-time.Duration(gp.config.HealthCheck.FlapWindowSeconds) * time.Second)
+}
+
+// HealthHistory returns the recent health checks of a service
+func (gp *GatewayProcessor) HealthHistory(service string) (*models.HealthHistory, error) {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+
+	if _, exists := gp.services[service]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, service)
+	}
+
+	result := &models.HealthHistory{
+		Service: service,
+		Entries: []models.HealthHistoryEntry{},
+	}
+	if history, exists := gp.healthHistory[service]; exists {
+		result.Entries = history.list()
+		result.Changes = history.changesSince(gp.flapWindowStart())
+		result.Flapping = result.Changes >= gp.config.HealthCheck.FlapThreshold
+	}
+
+	return result, nil
+}
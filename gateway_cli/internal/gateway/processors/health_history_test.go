@@ -0,0 +1,113 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+func historyProcessor(size, threshold, windowSeconds int) *GatewayProcessor {
+	cfg := &config.Config{}
+	cfg.HealthCheck.HistorySize = size
+	cfg.HealthCheck.FlapThreshold = threshold
+	cfg.HealthCheck.FlapWindowSeconds = windowSeconds
+	return &GatewayProcessor{
+		config:        cfg,
+		healthHistory: make(map[string]*healthHistory),
+	}
+}
+
+// recordSequence feeds statuses one second apart, ending now, and returns the
+// flapping flag after the last one
+func recordSequence(gp *GatewayProcessor, service string, statuses ...string) bool {
+	flapping := false
+	start := time.Now().Add(-time.Duration(len(statuses)) * time.Second)
+	for i, status := range statuses {
+		flapping = gp.recordHealthHistory(service, &models.HealthCheckResult{
+			Service:   service,
+			Status:    status,
+			Timestamp: start.Add(time.Duration(i+1) * time.Second),
+		})
+	}
+	return flapping
+}
+
+func TestHealthHistoryRingKeepsLatestOldestFirst(t *testing.T) {
+	history := newHealthHistory(3)
+	for i, status := range []string{"a", "b", "c", "d", "e"} {
+		history.add(models.HealthHistoryEntry{Status: status, DurationMs: int64(i)})
+	}
+
+	entries := history.list()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, want := range []string{"c", "d", "e"} {
+		if entries[i].Status != want {
+			t.Errorf("entry %d = %s, want %s", i, entries[i].Status, want)
+		}
+	}
+}
+
+func TestHealthHistoryClampsSize(t *testing.T) {
+	for _, size := range []int{0, -5} {
+		history := newHealthHistory(size)
+		history.add(models.HealthHistoryEntry{Status: "healthy"})
+		history.add(models.HealthHistoryEntry{Status: "unhealthy"})
+
+		entries := history.list()
+		if len(entries) != 1 || entries[0].Status != "unhealthy" {
+			t.Fatalf("size %d: got %+v, want only the latest entry", size, entries)
+		}
+	}
+}
+
+func TestRecordHealthHistoryFlapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     bool
+	}{
+		{"stable healthy", []string{"healthy", "healthy", "healthy", "healthy", "healthy"}, false},
+		{"single outage", []string{"healthy", "unhealthy", "unhealthy", "unhealthy", "unhealthy"}, false},
+		{"outage and recovery", []string{"healthy", "unhealthy", "healthy", "healthy"}, false},
+		{"alternating", []string{"healthy", "unhealthy", "healthy", "unhealthy", "healthy"}, true},
+		{"degraded counts as a change", []string{"healthy", "degraded", "healthy", "degraded"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gp := historyProcessor(10, 3, 60)
+			if got := recordSequence(gp, "auth", tt.statuses...); got != tt.want {
+				t.Fatalf("flapping = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordHealthHistoryIgnoresChangesOutsideWindow(t *testing.T) {
+	gp := historyProcessor(10, 3, 60)
+
+	old := time.Now().Add(-10 * time.Minute)
+	for i, status := range []string{"healthy", "unhealthy", "healthy", "unhealthy", "healthy"} {
+		gp.recordHealthHistory("auth", &models.HealthCheckResult{
+			Status:    status,
+			Timestamp: old.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	if recordSequence(gp, "auth", "healthy", "healthy") {
+		t.Fatal("changes before the flap window should not count")
+	}
+}
+
+func TestRecordHealthHistoryWithZeroSizeDoesNotPanic(t *testing.T) {
+	gp := historyProcessor(0, 1, 60)
+	recordSequence(gp, "auth", "healthy", "unhealthy", "healthy")
+
+	if entries := gp.healthHistory["auth"].list(); len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+}
@@ -0,0 +1,93 @@
+package processors
+
+import (
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// healthLoop probes one service on its own interval until stop is closed
+type healthLoop struct {
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// serviceHealthInterval returns the service's own check interval, or the global one
+func (gp *GatewayProcessor) serviceHealthInterval(serviceInfo *config.ServiceInfo) time.Duration {
+	if serviceInfo.HealthCheckInterval > 0 {
+		return time.Duration(serviceInfo.HealthCheckInterval) * time.Second
+	}
+	return gp.healthCheckInterval()
+}
+
+// syncHealthLoops starts a probe loop for every registered service and stops
+// loops of removed services. Loops whose interval changed are restarted.
+func (gp *GatewayProcessor) syncHealthLoops() {
+	gp.loopMu.Lock()
+	defer gp.loopMu.Unlock()
+	if !gp.healthChecking {
+		return
+	}
+
+	gp.mu.RLock()
+	services := make(map[string]*config.ServiceInfo, len(gp.services))
+	for name, info := range gp.services {
+		services[name] = info
+	}
+	gp.mu.RUnlock()
+
+	for name, loop := range gp.healthLoops {
+		info, exists := services[name]
+		if !exists || gp.serviceHealthInterval(info) != loop.interval {
+			close(loop.stop)
+			delete(gp.healthLoops, name)
+		}
+	}
+
+	offsets := gp.probeOffsets(services)
+	for name, info := range services {
+		if _, running := gp.healthLoops[name]; running {
+			continue
+		}
+		loop := &healthLoop{
+			interval: gp.serviceHealthInterval(info),
+			stop:     make(chan struct{}),
+		}
+		gp.healthLoops[name] = loop
+		go gp.runHealthLoop(name, loop, offsets[name]%loop.interval)
+	}
+}
+
+func (gp *GatewayProcessor) runHealthLoop(service string, loop *healthLoop, offset time.Duration) {
+	if offset > 0 {
+		select {
+		case <-time.After(offset):
+		case <-loop.stop:
+			return
+		case <-gp.stopChan:
+			return
+		}
+	}
+
+	ticker := time.NewTicker(loop.interval)
+	defer ticker.Stop()
+
+	for {
+		// Probe with the current registry entry, which a reload may have replaced
+		gp.mu.RLock()
+		serviceInfo, exists := gp.services[service]
+		gp.mu.RUnlock()
+		if !exists {
+			return
+		}
+		gp.performHealthCheck(service, serviceInfo)
+
+		select {
+		case <-ticker.C:
+		case <-loop.stop:
+			return
+		case <-gp.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+var (
+	// ErrIdempotencyInProgress is returned while another request with the same
+	// Idempotency-Key is still being processed
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key in progress")
+	// ErrIdempotencyKeyReused is returned when a key comes back with a different
+	// method or path than the request it was first used for
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused for a different request")
+)
+
+const idempotencyPollInterval = 100 * time.Millisecond
+
+// Deletes the claim only if it is still held by the same request
+var releaseIdempotencyClaim = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Extends the claim only if it is still held by the same request
+var refreshIdempotencyClaim = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// idempotentResponse is the stored outcome of a request with an Idempotency-Key
+type idempotentResponse struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	StatusCode int         `json:"status_code"`
+	Body       []byte      `json:"body,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+}
+
+// idempotencyKey identifies a stored response. The user is part of the key so
+// one client's key never replays another's response.
+func idempotencyKey(service, userID, key string) string {
+	return fmt.Sprintf("gateway:idempotency:%s:%s:%s", service, userID, key)
+}
+
+// IdempotencyClaim is held by the one request forwarded for an Idempotency-Key
+type IdempotencyClaim struct {
+	gp         *GatewayProcessor
+	key        string
+	token      string
+	method     string
+	path       string
+	service    string
+	ttlSeconds int
+	done       chan struct{}
+}
+
+// ClaimIdempotencyKey returns the stored response of an earlier request with
+// the same key, or claims the key for this request. userID must be the
+// authenticated user, never a client-supplied header. A request finding the key
+// claimed waits up to the claim timeout for the first one's response, then
+// fails with ErrIdempotencyInProgress. The claim is refreshed until Complete
+// or until ctx ends, so a request outliving the claim timeout keeps it. Without
+// Redis the request is forwarded unprotected, with neither a replay nor a claim.
+func (gp *GatewayProcessor) ClaimIdempotencyKey(ctx context.Context, service, userID, key, method, path string) (*models.ProxyResponse, *IdempotencyClaim, error) {
+	cfg := gp.config.Idempotency
+	storeKey := idempotencyKey(service, userID, key)
+	claimKey := storeKey + ":claim"
+	token := uuid.New().String()
+	claimTTL := time.Duration(cfg.ClaimSeconds) * time.Second
+	deadline := time.Now().Add(claimTTL)
+
+	for {
+		replay, err := gp.lookupIdempotent(ctx, storeKey, method, path)
+		if replay != nil || err != nil {
+			return replay, nil, err
+		}
+
+		claimed, err := gp.redis.SetNX(ctx, claimKey, token, claimTTL).Result()
+		if err != nil {
+			gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Idempotency key unavailable for %s, forwarding unprotected", service), map[string]interface{}{
+				"service": service,
+				"error":   err.Error(),
+			})
+			return nil, nil, nil
+		}
+		if claimed {
+			// The previous holder may have stored its response just before releasing
+			replay, err := gp.lookupIdempotent(ctx, storeKey, method, path)
+			if replay != nil || err != nil {
+				releaseIdempotencyClaim.Run(ctx, gp.redis, []string{claimKey}, token)
+				return replay, nil, err
+			}
+			claim := &IdempotencyClaim{
+				gp:         gp,
+				key:        storeKey,
+				token:      token,
+				method:     method,
+				path:       path,
+				service:    service,
+				ttlSeconds: cfg.TTLSeconds,
+				done:       make(chan struct{}),
+			}
+			go claim.keepAlive(ctx, claimTTL)
+			return nil, claim, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil, ErrIdempotencyInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+// lookupIdempotent returns the stored response for key, if any
+func (gp *GatewayProcessor) lookupIdempotent(ctx context.Context, key, method, path string) (*models.ProxyResponse, error) {
+	data, err := gp.redis.Get(ctx, key).Result()
+	if err != nil {
+		return nil, nil
+	}
+
+	var stored idempotentResponse
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, nil
+	}
+	if stored.Method != method || stored.Path != path {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	headers := stored.Headers
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("X-Gateway-Idempotent-Replay", "true")
+
+	return &models.ProxyResponse{
+		StatusCode: stored.StatusCode,
+		Body:       stored.Body,
+		Headers:    headers,
+	}, nil
+}
+
+// keepAlive extends the claim every third of its TTL while the request is in
+// flight, so only a gateway that stopped refreshing it loses it
+func (c *IdempotencyClaim) keepAlive(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshIdempotencyClaim.Run(ctx, c.gp.redis, []string{c.key + ":claim"}, c.token, ttl.Milliseconds())
+		}
+	}
+}
+
+// Complete stores the response for replay and releases the claim. Failed
+// requests, 5xx responses, fallbacks and streams aren't stored, so a retry is
+// forwarded again.
+func (c *IdempotencyClaim) Complete(resp *models.ProxyResponse, err error) {
+	close(c.done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	defer releaseIdempotencyClaim.Run(ctx, c.gp.redis, []string{c.key + ":claim"}, c.token)
+
+	if err != nil || resp == nil || resp.Stream != nil || resp.StatusCode >= 500 || resp.Headers.Get("X-Gateway-Fallback") != "" {
+		return
+	}
+
+	data, marshalErr := json.Marshal(idempotentResponse{
+		Method:     c.method,
+		Path:       c.path,
+		StatusCode: resp.StatusCode,
+		Body:       resp.Body,
+		Headers:    resp.Headers,
+	})
+	if marshalErr != nil {
+		return
+	}
+
+	if err := c.gp.redis.Set(ctx, c.key, data, time.Duration(c.ttlSeconds)*time.Second).Err(); err != nil {
+		c.gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Failed to store idempotent response for %s", c.service), map[string]interface{}{
+			"service": c.service,
+			"path":    c.path,
+			"error":   err.Error(),
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+func created(body string) *models.ProxyResponse {
+	return &models.ProxyResponse{
+		StatusCode: http.StatusCreated,
+		Body:       []byte(body),
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	gp, _ := newTestProcessor(t, nil, nil)
+	ctx := context.Background()
+
+	replay, claim, err := gp.ClaimIdempotencyKey(ctx, "devices", "user-1", "key-1", http.MethodPost, "/devices")
+	if err != nil || replay != nil || claim == nil {
+		t.Fatalf("first request: replay = %v, claim = %v, err = %v, want a claim", replay, claim, err)
+	}
+	claim.Complete(created(`{"id":1}`), nil)
+
+	replay, claim, err = gp.ClaimIdempotencyKey(ctx, "devices", "user-1", "key-1", http.MethodPost, "/devices")
+	if err != nil || claim != nil || replay == nil {
+		t.Fatalf("repeat: replay = %v, claim = %v, err = %v, want a replay", replay, claim, err)
+	}
+	if replay.StatusCode != http.StatusCreated || string(replay.Body) != `{"id":1}` {
+		t.Errorf("replay = %d %s, want 201 {\"id\":1}", replay.StatusCode, replay.Body)
+	}
+	if replay.Headers.Get("X-Gateway-Idempotent-Replay") != "true" {
+		t.Error("replay isn't marked with X-Gateway-Idempotent-Replay")
+	}
+
+	// Another user's key, or another path, never gets this response
+	if replay, _, _ := gp.ClaimIdempotencyKey(ctx, "devices", "user-2", "key-1", http.MethodPost, "/devices"); replay != nil {
+		t.Error("another user's request got the replay")
+	}
+	if _, _, err := gp.ClaimIdempotencyKey(ctx, "devices", "user-1", "key-1", http.MethodPost, "/scenes"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("key reused for another path: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+func TestIdempotencyConcurrentRequestsForwardOnce(t *testing.T) {
+	gp, _ := newTestProcessor(t, nil, nil)
+
+	const requests = 10
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claims  int
+		replays int
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replay, claim, err := gp.ClaimIdempotencyKey(context.Background(), "devices", "user-1", "key-1", http.MethodPost, "/devices")
+			if err != nil {
+				t.Errorf("claim: %v", err)
+				return
+			}
+			if claim != nil {
+				// Still in flight while the others arrive
+				time.Sleep(200 * time.Millisecond)
+				claim.Complete(created(`{"id":1}`), nil)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if claim != nil {
+				claims++
+			} else if replay != nil && string(replay.Body) == `{"id":1}` {
+				replays++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claims != 1 || replays != requests-1 {
+		t.Fatalf("claims = %d, replays = %d, want 1 and %d", claims, replays, requests-1)
+	}
+}
+
+func TestIdempotencyClaimRefreshedWhileInFlight(t *testing.T) {
+	gp, mr := newTestProcessor(t, nil, func(cfg *config.Config) {
+		cfg.Idempotency.ClaimSeconds = 1
+	})
+	claimKey := idempotencyKey("devices", "user-1", "key-1") + ":claim"
+
+	_, claim, err := gp.ClaimIdempotencyKey(context.Background(), "devices", "user-1", "key-1", http.MethodPost, "/devices")
+	if err != nil || claim == nil {
+		t.Fatalf("claim = %v, err = %v, want a claim", claim, err)
+	}
+
+	// Most of the claim's TTL passes while the upstream is still working
+	mr.FastForward(800 * time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	if ttl := mr.TTL(claimKey); ttl <= 500*time.Millisecond {
+		t.Fatalf("claim TTL = %v, want it refreshed to about 1s", ttl)
+	}
+
+	claim.Complete(nil, errors.New("upstream failed"))
+	if mr.Exists(claimKey) {
+		t.Fatal("claim not released by Complete")
+	}
+	time.Sleep(500 * time.Millisecond)
+	if mr.Exists(claimKey) {
+		t.Fatal("released claim came back")
+	}
+}
@@ -0,0 +1,44 @@
+package processors
+
+import (
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// probeInstances health checks every instance of a multi-instance service,
+// marking each one in the balancer. The service counts as healthy while any
+// instance is, so a single down instance doesn't take the service offline.
+func (gp *GatewayProcessor) probeInstances(service string, serviceInfo *config.ServiceInfo) (*models.HealthCheckResult, error) {
+	gp.mu.RLock()
+	balancer := gp.balancers[service]
+	gp.mu.RUnlock()
+
+	if balancer == nil || len(balancer.Instances()) < 2 {
+		return gp.probeHealth(service, serviceInfo)
+	}
+
+	var result *models.HealthCheckResult
+	statuses := make(map[string]string, len(balancer.Instances()))
+	for _, instance := range balancer.Instances() {
+		instanceInfo, ok := serviceInfo.ForInstance(instance)
+		if !ok {
+			// Health endpoint is shared, so instances can't be told apart
+			return gp.probeHealth(service, serviceInfo)
+		}
+
+		instanceResult, err := gp.probeHealth(service, &instanceInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		healthy := instanceResult.Status == "healthy"
+		balancer.SetInstanceHealth(instance, healthy)
+		statuses[instance] = instanceResult.Status
+		if result == nil || (healthy && result.Status != "healthy") {
+			result = instanceResult
+		}
+	}
+
+	result.Instances = statuses
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+)
+
+// DecodeJSON parses a JSON body for inspection or transformation. Numbers are
+// kept as json.Number so large integer IDs and timestamps survive re-encoding
+// exactly instead of being rounded through float64.
+func DecodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON: unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+// jsonField returns the value at a dotted path in a JSON body
+func jsonField(body []byte, field string) (interface{}, bool) {
+	value, err := DecodeJSON(body)
+	if err != nil {
+		return nil, false
+	}
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// isJSONContentType reports whether a Content-Type is JSON, including +json types
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// decodeBody parses a JSON body if possible, otherwise returns it as a string
+func decodeBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+
+	bodyInterface, err := DecodeJSON(body)
+	if err != nil {
+		return string(body)
+	}
+	return bodyInterface
+}
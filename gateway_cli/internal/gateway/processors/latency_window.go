@@ -0,0 +1,66 @@
+package processors
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type latencySample struct {
+	latencyMs float64
+	at        time.Time
+}
+
+// latencyWindow keeps the last size latency samples, optionally dropping samples
+// older than maxAge, so percentiles reflect recent traffic with bounded memory
+type latencyWindow struct {
+	samples []latencySample
+	next    int
+	full    bool
+	maxAge  time.Duration
+}
+
+func newLatencyWindow(size int, maxAge time.Duration) *latencyWindow {
+	if size <= 0 {
+		size = 1024
+	}
+	return &latencyWindow{
+		samples: make([]latencySample, size),
+		maxAge:  maxAge,
+	}
+}
+
+func (w *latencyWindow) add(latencyMs float64) {
+	w.samples[w.next] = latencySample{latencyMs: latencyMs, at: time.Now()}
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// percentiles returns p50, p95 and p99 of the samples in the window using the
+// nearest-rank method. All are 0 if the window is empty.
+func (w *latencyWindow) percentiles() (p50, p95, p99 float64) {
+	count := w.next
+	if w.full {
+		count = len(w.samples)
+	}
+
+	values := make([]float64, 0, count)
+	for _, sample := range w.samples[:count] {
+		if w.maxAge > 0 && time.Since(sample.at) > w.maxAge {
+			continue
+		}
+		values = append(values, sample.latencyMs)
+	}
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+
+	sort.Float64s(values)
+	rank := func(p float64) float64 {
+		idx := int(math.Ceil(p*float64(len(values)))) - 1
+		return values[max(idx, 0)]
+	}
+	return rank(0.50), rank(0.95), rank(0.99)
+}
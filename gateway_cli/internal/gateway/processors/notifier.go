@@ -0,0 +1,168 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// HealthChange describes a service moving between healthy and unhealthy
+type HealthChange struct {
+	Service   string    `json:"service"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HealthNotifier is told about health transitions, e.g. to page someone
+type HealthNotifier interface {
+	NotifyHealthChange(change HealthChange) error
+}
+
+// WebhookNotifier POSTs transitions to an HTTP endpoint such as a Slack or
+// PagerDuty webhook
+type WebhookNotifier struct {
+	url      string
+	template *template.Template
+	client   *http.Client
+}
+
+// NewWebhookNotifier creates a notifier for url. payload is a text/template
+// rendered with the HealthChange; if empty the change is sent as JSON.
+func NewWebhookNotifier(url, payload string) (*WebhookNotifier, error) {
+	notifier := &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if payload != "" {
+		tmpl, err := template.New("payload").Parse(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload template: %w", err)
+		}
+		notifier.template = tmpl
+	}
+
+	return notifier, nil
+}
+
+func (n *WebhookNotifier) NotifyHealthChange(change HealthChange) error {
+	var body bytes.Buffer
+	if n.template != nil {
+		if err := n.template.Execute(&body, change); err != nil {
+			return fmt.Errorf("failed to render payload: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(change); err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", &body)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifyState tracks the last reported status of a service and any pending change
+type notifyState struct {
+	notified     string
+	pending      string
+	pendingSince time.Time
+}
+
+// AddHealthNotifier registers a notifier for health transitions
+func (gp *GatewayProcessor) AddHealthNotifier(notifier HealthNotifier) {
+	gp.notifyMu.Lock()
+	defer gp.notifyMu.Unlock()
+	gp.notifiers = append(gp.notifiers, notifier)
+}
+
+// observeHealthTransition reports a healthy/unhealthy transition once the new
+// status has held for the debounce period. The first result for a service and
+// "starting" results are never reported.
+func (gp *GatewayProcessor) observeHealthTransition(service string, result *models.HealthCheckResult) {
+	status := result.Status
+	if status == "degraded" {
+		// Degraded services still serve traffic, so they count as up here
+		status = "healthy"
+	}
+	if status != "healthy" && status != "unhealthy" {
+		return
+	}
+
+	gp.notifyMu.Lock()
+	notifiers := gp.notifiers
+	state, exists := gp.notifyStates[service]
+	if !exists {
+		gp.notifyStates[service] = &notifyState{notified: status}
+		gp.notifyMu.Unlock()
+		return
+	}
+
+	if status == state.notified {
+		// Flapped back before the change was reported
+		state.pending = ""
+		gp.notifyMu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if state.pending != status {
+		state.pending = status
+		state.pendingSince = now
+	}
+
+	debounce := time.Duration(gp.config.HealthCheck.Notify.DebounceSeconds) * time.Second
+	if now.Sub(state.pendingSince) < debounce {
+		gp.notifyMu.Unlock()
+		return
+	}
+
+	change := HealthChange{
+		Service:   service,
+		From:      state.notified,
+		To:        status,
+		Error:     result.Error,
+		Timestamp: now,
+	}
+	state.notified = status
+	state.pending = ""
+	gp.notifyMu.Unlock()
+
+	for _, notifier := range notifiers {
+		go func(n HealthNotifier) {
+			if err := n.NotifyHealthChange(change); err != nil {
+				gp.redis.PublishLog("error", "gateway", fmt.Sprintf("Health notification for %s failed", service), map[string]interface{}{
+					"service": service,
+					"to":      change.To,
+					"error":   err.Error(),
+				})
+			}
+		}(notifier)
+	}
+}
+
+// newConfiguredNotifiers builds the notifiers enabled in config
+func newConfiguredNotifiers(cfg config.HealthNotifyConfig) ([]HealthNotifier, error) {
+	if cfg.WebhookURL == "" {
+		return nil, nil
+	}
+
+	webhook, err := NewWebhookNotifier(cfg.WebhookURL, cfg.PayloadTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return []HealthNotifier{webhook}, nil
+}
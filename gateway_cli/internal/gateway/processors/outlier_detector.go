@@ -0,0 +1,117 @@
+package processors
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// latencyAlpha is the smoothing factor for the per-instance latency EWMA
+const latencyAlpha = 0.3
+
+// OutlierDetector ejects upstream instances whose latency is a multiple of the pool median
+type OutlierDetector struct {
+	multiplier float64
+	minSamples int
+	ejection   time.Duration
+	instances  map[string]*instanceLatency
+	mu         sync.Mutex
+}
+
+type instanceLatency struct {
+	averageMs    float64
+	samples      int
+	ejectedUntil time.Time
+}
+
+func NewOutlierDetector(cfg config.OutlierConfig) *OutlierDetector {
+	return &OutlierDetector{
+		multiplier: cfg.LatencyMultiplier,
+		minSamples: cfg.MinSamples,
+		ejection:   time.Duration(cfg.EjectionSeconds) * time.Second,
+		instances:  make(map[string]*instanceLatency),
+	}
+}
+
+// Observe records a latency sample and reports whether the instance was just ejected
+func (od *OutlierDetector) Observe(instance string, latency time.Duration) bool {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	stats, exists := od.instances[instance]
+	if !exists {
+		stats = &instanceLatency{}
+		od.instances[instance] = stats
+	}
+
+	latencyMs := float64(latency.Milliseconds())
+	if stats.samples == 0 {
+		stats.averageMs = latencyMs
+	} else {
+		stats.averageMs = latencyAlpha*latencyMs + (1-latencyAlpha)*stats.averageMs
+	}
+	stats.samples++
+
+	if stats.samples < od.minSamples || time.Now().Before(stats.ejectedUntil) {
+		return false
+	}
+
+	median := od.peerMedian(instance)
+	if median <= 0 {
+		return false
+	}
+
+	if stats.averageMs > median*od.multiplier {
+		stats.ejectedUntil = time.Now().Add(od.ejection)
+		return true
+	}
+
+	return false
+}
+
+// Ejected reports whether the instance is currently ejected. Once the ejection
+// window has passed the instance is re-admitted with fresh statistics so it
+// has to prove itself again during the probe window.
+func (od *OutlierDetector) Ejected(instance string) bool {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	stats, exists := od.instances[instance]
+	if !exists || stats.ejectedUntil.IsZero() {
+		return false
+	}
+
+	if time.Now().Before(stats.ejectedUntil) {
+		return true
+	}
+
+	// Probe window elapsed - re-admit
+	stats.ejectedUntil = time.Time{}
+	stats.samples = 0
+	stats.averageMs = 0
+	return false
+}
+
+// peerMedian returns the median latency of the other admitted instances with enough samples
+func (od *OutlierDetector) peerMedian(instance string) float64 {
+	now := time.Now()
+	latencies := make([]float64, 0, len(od.instances))
+	for peer, stats := range od.instances {
+		if peer != instance && stats.samples >= od.minSamples && !now.Before(stats.ejectedUntil) {
+			latencies = append(latencies, stats.averageMs)
+		}
+	}
+
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	sort.Float64s(latencies)
+	mid := len(latencies) / 2
+	if len(latencies)%2 == 0 {
+		return (latencies[mid-1] + latencies[mid]) / 2
+	}
+	return latencies[mid]
+}
@@ -0,0 +1,69 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// delayedUpstream answers after delay. With flaky set, every other request
+// gets a 502 first, so the gateway retries it after a backoff.
+func delayedUpstream(t *testing.T, delay time.Duration, flaky bool) *httptest.Server {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if flaky && calls.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOutlierDetectionEjectsOnlyTheSlowInstance(t *testing.T) {
+	// The flaky instance answers as fast as the healthy one, but the retry
+	// backoff makes its requests take longer than the slow instance's
+	flaky := delayedUpstream(t, 5*time.Millisecond, true)
+	fast := delayedUpstream(t, 5*time.Millisecond, false)
+	slow := delayedUpstream(t, 60*time.Millisecond, false)
+
+	info := config.NewServiceInfo("devices", flaky.URL, "", 5)
+	info.Instances = []string{flaky.URL, fast.URL, slow.URL}
+	info.InstanceWeights = []int{1, 1, 1}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, func(cfg *config.Config) {
+		cfg.Outlier = config.OutlierConfig{
+			Enabled:           true,
+			LatencyMultiplier: 3,
+			MinSamples:        3,
+			EjectionSeconds:   60,
+		}
+		cfg.Retry.MaxAttempts = 2
+		cfg.Retry.BaseDelayMs = 100
+		cfg.Retry.MaxDelayMs = 100
+	})
+
+	for i := 0; i < 9; i++ {
+		resp, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: resp = %v, err = %v", i, resp, err)
+		}
+	}
+
+	outliers := gp.balancers["devices"].outliers
+	if !outliers.Ejected(slow.URL) {
+		t.Error("slow instance not ejected")
+	}
+	if outliers.Ejected(flaky.URL) {
+		t.Error("instance slowed only by retry backoff was ejected")
+	}
+	if outliers.Ejected(fast.URL) {
+		t.Error("fast instance was ejected")
+	}
+}
@@ -0,0 +1,22 @@
+package processors
+
+import "errors"
+
+// errStopping is returned to probes still waiting for a slot at shutdown
+var errStopping = errors.New("gateway stopping")
+
+// acquireProbeSlot waits for one of the process-wide health probe slots, so a
+// large registry plus manual checks can't run unbounded probes at once
+func (gp *GatewayProcessor) acquireProbeSlot() (func(), error) {
+	select {
+	case gp.probeSlots <- struct{}{}:
+	case <-gp.stopChan:
+		return nil, errStopping
+	}
+
+	gp.probesInFlight.Add(1)
+	return func() {
+		gp.probesInFlight.Add(-1)
+		<-gp.probeSlots
+	}, nil
+}
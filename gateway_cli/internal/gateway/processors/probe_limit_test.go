@@ -0,0 +1,80 @@
+package processors
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// concurrencyUpstream answers slowly and records the most requests it had in flight at once
+func concurrencyUpstream(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int64) {
+	var current, peak atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+		for {
+			seen := peak.Load()
+			if n <= seen || peak.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &peak
+}
+
+func TestProbeCapHoldsAcrossCheckSources(t *testing.T) {
+	upstream, peak := concurrencyUpstream(t, 20*time.Millisecond)
+
+	registry := make(map[string]config.ServiceInfo)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("service-%d", i)
+		info := config.NewServiceInfo(name, upstream.URL, "", 5)
+		info.Critical = true
+		if i > 0 {
+			info.DependsOn = []string{"service-0"}
+		}
+		registry[name] = info
+	}
+	gp, _ := newTestProcessor(t, registry, func(cfg *config.Config) {
+		cfg.HealthCheck.MaxConcurrent = 2
+	})
+
+	// Scheduled loops, manual checks, dependency refreshes and the critical
+	// probes of a reload all compete for the same slots
+	go gp.StartHealthChecker()
+	t.Cleanup(gp.Stop)
+
+	var wg sync.WaitGroup
+	for round := 0; round < 3; round++ {
+		for name := range registry {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				gp.CheckServiceHealth(name)
+			}(name)
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := gp.ReloadConfig(reloadedConfig(t, registry, func(cfg *config.Config) {
+			cfg.Reload.ProbeCritical = true
+		})); err != nil {
+			t.Errorf("reload: %v", err)
+		}
+	}()
+	wg.Wait()
+
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("peak concurrent probes = %d, want the cap of 2 reached and never exceeded", got)
+	}
+}
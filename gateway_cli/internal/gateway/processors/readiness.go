@@ -0,0 +1,32 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const readinessRedisTimeout = 2 * time.Second
+
+var (
+	// ErrRedisUnavailable is returned by Ready when Redis doesn't answer a ping
+	ErrRedisUnavailable = errors.New("redis unavailable")
+	// ErrNoHealthyServices is returned by Ready when no backend is serving traffic
+	ErrNoHealthyServices = errors.New("no healthy services")
+)
+
+// Ready reports whether the gateway can serve traffic: Redis must answer a
+// ping and at least one service must be healthy or degraded
+func (gp *GatewayProcessor) Ready(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, readinessRedisTimeout)
+	defer cancel()
+
+	if err := gp.redis.Ping(pingCtx).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisUnavailable, err)
+	}
+	if gp.countHealthyServices() == 0 {
+		return ErrNoHealthyServices
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package processors
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// transformPath rewrites an upstream path (with its query) per the service's
+// transform. StripPrefix only matches whole path segments.
+func transformPath(transform *config.RequestTransform, path string) string {
+	if transform == nil {
+		return path
+	}
+
+	if prefix := transform.StripPrefix; prefix != "" && strings.HasPrefix(path, prefix) {
+		rest := path[len(prefix):]
+		if rest == "" || rest[0] == '/' || rest[0] == '?' {
+			path = rest
+		}
+	}
+	path = transform.PathPrefix + path
+	if path == "" || path[0] == '?' {
+		path = "/" + path
+	}
+	return path
+}
+
+// transformHeaders renames and injects outbound headers per the service's transform
+func transformHeaders(transform *config.RequestTransform, header http.Header) {
+	if transform == nil {
+		return
+	}
+
+	for from, to := range transform.RenameHeaders {
+		if values, ok := header[from]; ok {
+			header.Del(from)
+			header[http.CanonicalHeaderKey(to)] = values
+		}
+	}
+	for key, value := range transform.SetHeaders {
+		header.Set(key, value)
+	}
+}
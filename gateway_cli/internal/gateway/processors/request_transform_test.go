@@ -0,0 +1,96 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// recordingUpstream keeps the URI and headers of the last request it received
+func recordingUpstream(t *testing.T) (*httptest.Server, func() (string, http.Header)) {
+	var mu sync.Mutex
+	var uri string
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		uri, header = r.URL.RequestURI(), r.Header.Clone()
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() (string, http.Header) {
+		mu.Lock()
+		defer mu.Unlock()
+		return uri, header
+	}
+}
+
+func TestRequestTransform(t *testing.T) {
+	upstream, last := recordingUpstream(t)
+
+	legacy := config.NewServiceInfo("legacy", upstream.URL, "", 5)
+	legacy.Transform = &config.RequestTransform{
+		StripPrefix:   "/v1",
+		PathPrefix:    "/legacy",
+		RenameHeaders: map[string]string{"X-Api-Token": "X-Legacy-Key"},
+		SetHeaders:    map[string]string{"X-Api-Key": "gateway-secret"},
+	}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"legacy":  legacy,
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 5),
+	}, nil)
+
+	tests := []struct {
+		service    string
+		path       string
+		wantURI    string
+		wantHeader map[string]string
+	}{
+		{
+			service: "legacy",
+			path:    "/v1/devices?room=kitchen",
+			wantURI: "/legacy/devices?room=kitchen",
+			wantHeader: map[string]string{
+				"X-Legacy-Key": "token-1",
+				"X-Api-Token":  "",
+				"X-Api-Key":    "gateway-secret",
+			},
+		},
+		{
+			service: "legacy",
+			path:    "/v10/devices",
+			wantURI: "/legacy/v10/devices",
+		},
+		{
+			service: "devices",
+			path:    "/v1/devices?room=kitchen",
+			wantURI: "/v1/devices?room=kitchen",
+			wantHeader: map[string]string{
+				"X-Legacy-Key": "",
+				"X-Api-Token":  "token-1",
+				"X-Api-Key":    "client-key",
+			},
+		},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{"X-Api-Token": "token-1", "X-Api-Key": "client-key"}
+		if _, err := gp.ProxyRequest(context.Background(), tt.service, tt.path, tt.path, http.MethodGet, nil, headers, "", nil); err != nil {
+			t.Fatalf("%s %s: %v", tt.service, tt.path, err)
+		}
+
+		uri, header := last()
+		if uri != tt.wantURI {
+			t.Errorf("%s %s reached the upstream as %s, want %s", tt.service, tt.path, uri, tt.wantURI)
+		}
+		for name, want := range tt.wantHeader {
+			if got := header.Get(name); got != want {
+				t.Errorf("%s %s: upstream %s = %q, want %q", tt.service, tt.path, name, got, want)
+			}
+		}
+	}
+}
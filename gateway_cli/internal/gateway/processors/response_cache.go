@@ -0,0 +1,300 @@
+package processors
+
+import (
+	"container/list"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// cachedResponse keeps the raw upstream body so every hit decodes a fresh copy
+type cachedResponse struct {
+	key        string
+	statusCode int
+	body       []byte
+	headers    http.Header
+	expires    time.Time
+	element    *list.Element
+}
+
+// ResponseCache caches upstream GET responses. Entries are keyed by the base key
+// plus the values of the request headers named in the upstream's Vary header,
+// so each variant (e.g. per Accept-Language) is cached separately. When full,
+// the least recently used entry is evicted. Expired entries with an ETag or
+// Last-Modified are kept so they can be revalidated with the upstream.
+type ResponseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	vary       map[string][]string
+	entries    map[string]*cachedResponse
+	// recency orders entries from most to least recently used
+	recency *list.List
+}
+
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		vary:       make(map[string][]string),
+		entries:    make(map[string]*cachedResponse),
+		recency:    list.New(),
+	}
+}
+
+// Get returns a cached response for the request, if a fresh one exists
+func (c *ResponseCache) Get(baseKey string, headers map[string]string) (*models.ProxyResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.lookup(baseKey, headers)
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		if !hasValidators(entry.headers) {
+			c.remove(entry)
+		}
+		return nil, false
+	}
+
+	c.recency.MoveToFront(entry.element)
+	return entry.response("HIT"), true
+}
+
+// Validators returns the ETag and Last-Modified of a cached variant, fresh or
+// not, so a miss can be sent upstream as a conditional request
+func (c *ResponseCache) Validators(baseKey string, headers map[string]string) (etag, lastModified string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.lookup(baseKey, headers)
+	if !exists || !hasValidators(entry.headers) {
+		return "", "", false
+	}
+	return entry.headers.Get("ETag"), entry.headers.Get("Last-Modified"), true
+}
+
+// Revalidate renews a cached variant after the upstream answered a conditional
+// request with 304, taking the caching headers from that response. The cached
+// copy is still returned if those headers no longer allow storing it.
+func (c *ResponseCache) Revalidate(baseKey string, headers map[string]string, respHeader http.Header, defaultTTL time.Duration) (*models.ProxyResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.lookup(baseKey, headers)
+	if !exists {
+		return nil, false
+	}
+
+	for _, name := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified"} {
+		if values := respHeader.Values(name); len(values) > 0 {
+			entry.headers[name] = values
+		}
+	}
+	ttl := cacheTTL(entry.headers, defaultTTL)
+	if !isCacheable(entry.headers) || (ttl <= 0 && !hasValidators(entry.headers)) {
+		c.remove(entry)
+		return entry.response("REVALIDATED"), true
+	}
+
+	entry.expires = time.Now().Add(ttl)
+	c.recency.MoveToFront(entry.element)
+	return entry.response("REVALIDATED"), true
+}
+
+// Put stores a response unless the upstream marked it uncacheable. Its lifetime
+// comes from Cache-Control or Expires, falling back to defaultTTL. Vary: * means
+// the response can't be matched to a request, so it is never cached.
+func (c *ResponseCache) Put(baseKey string, headers map[string]string, statusCode int, respHeader http.Header, body []byte, defaultTTL time.Duration) {
+	if !isCacheable(respHeader) {
+		return
+	}
+	ttl := cacheTTL(respHeader, defaultTTL)
+	if ttl <= 0 && !hasValidators(respHeader) {
+		return
+	}
+
+	varyHeaders, ok := parseVary(respHeader)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !ok {
+		c.dropVariants(baseKey)
+		return
+	}
+
+	// A changed Vary invalidates the variants cached under the old one
+	if previous, known := c.vary[baseKey]; known && strings.Join(previous, ",") != strings.Join(varyHeaders, ",") {
+		c.dropVariants(baseKey)
+	}
+
+	key := variantKey(baseKey, varyHeaders, headers)
+	if existing, exists := c.entries[key]; exists {
+		c.remove(existing)
+	}
+	if c.maxEntries <= 0 {
+		return
+	}
+	if len(c.entries) >= c.maxEntries {
+		c.evictExpired()
+	}
+	for len(c.entries) >= c.maxEntries {
+		c.remove(c.recency.Back().Value.(*cachedResponse))
+	}
+
+	responseHeaders := respHeader.Clone()
+	if responseHeaders == nil {
+		responseHeaders = make(http.Header)
+	}
+	RemoveHopByHopHeaders(responseHeaders)
+
+	entry := &cachedResponse{
+		key:        key,
+		statusCode: statusCode,
+		body:       body,
+		headers:    responseHeaders,
+		expires:    time.Now().Add(ttl),
+	}
+	entry.element = c.recency.PushFront(entry)
+	c.vary[baseKey] = varyHeaders
+	c.entries[key] = entry
+}
+
+func (c *ResponseCache) lookup(baseKey string, headers map[string]string) (*cachedResponse, bool) {
+	varyHeaders, known := c.vary[baseKey]
+	if !known {
+		return nil, false
+	}
+	entry, exists := c.entries[variantKey(baseKey, varyHeaders, headers)]
+	return entry, exists
+}
+
+func (c *ResponseCache) remove(entry *cachedResponse) {
+	c.recency.Remove(entry.element)
+	delete(c.entries, entry.key)
+}
+
+func (c *ResponseCache) dropVariants(baseKey string) {
+	delete(c.vary, baseKey)
+	for key, entry := range c.entries {
+		if strings.HasPrefix(key, baseKey+"\x00") {
+			c.remove(entry)
+		}
+	}
+}
+
+func (c *ResponseCache) evictExpired() {
+	now := time.Now()
+	for _, entry := range c.entries {
+		if now.After(entry.expires) {
+			c.remove(entry)
+		}
+	}
+}
+
+func (entry *cachedResponse) response(cacheStatus string) *models.ProxyResponse {
+	responseHeaders := entry.headers.Clone()
+	responseHeaders.Set("X-Gateway-Cache", cacheStatus)
+
+	return &models.ProxyResponse{
+		StatusCode: entry.statusCode,
+		Body:       entry.body,
+		Headers:    responseHeaders,
+	}
+}
+
+// parseVary returns the canonical, sorted header names from Vary. ok is false for Vary: *.
+func parseVary(respHeader http.Header) ([]string, bool) {
+	var names []string
+	for _, value := range respHeader.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+func variantKey(baseKey string, varyHeaders []string, headers map[string]string) string {
+	var b strings.Builder
+	b.WriteString(baseKey)
+	for _, name := range varyHeaders {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(headers[name])
+	}
+	if len(varyHeaders) == 0 {
+		b.WriteString("\x00")
+	}
+	return b.String()
+}
+
+func isCacheable(respHeader http.Header) bool {
+	cacheControl := strings.ToLower(respHeader.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if strings.Contains(cacheControl, directive) {
+			return false
+		}
+	}
+	return respHeader.Get("Set-Cookie") == ""
+}
+
+// isCacheableStatus reports whether a response status can be stored; partial
+// content depends on the request's Range, which isn't part of the key
+func isCacheableStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300 && statusCode != http.StatusPartialContent
+}
+
+func hasValidators(respHeader http.Header) bool {
+	return respHeader.Get("ETag") != "" || respHeader.Get("Last-Modified") != ""
+}
+
+// cacheTTL returns how long a response stays fresh: s-maxage or max-age from
+// Cache-Control, then Expires relative to Date, then the service default
+func cacheTTL(respHeader http.Header, defaultTTL time.Duration) time.Duration {
+	maxAge := -1
+	for _, directive := range strings.Split(respHeader.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "s-maxage":
+			return time.Duration(seconds) * time.Second
+		case "max-age":
+			maxAge = seconds
+		}
+	}
+	if maxAge >= 0 {
+		return time.Duration(maxAge) * time.Second
+	}
+
+	if expires := respHeader.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires means already expired
+			return 0
+		}
+		now := time.Now()
+		if date, err := http.ParseTime(respHeader.Get("Date")); err == nil {
+			now = date
+		}
+		return expiresAt.Sub(now)
+	}
+
+	return defaultTTL
+}
@@ -0,0 +1,115 @@
+package processors
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Headers kept ahead of all others when a response has to be truncated
+var essentialHeaders = map[string]bool{
+	"Content-Type":     true,
+	"Content-Length":   true,
+	"Content-Encoding": true,
+	"Cache-Control":    true,
+	"Etag":             true,
+	"Last-Modified":    true,
+	"Location":         true,
+	"Retry-After":      true,
+}
+
+// Hop-by-hop headers (RFC 7230 section 6.1) apply to a single connection and
+// are never relayed
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopByHopHeaders drops hop-by-hop headers, including any named in Connection.
+// Used for both upstream responses and client requests.
+func RemoveHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// responseHeaders converts upstream headers for the client, keeping every value
+// of end-to-end headers, within the configured count and size limits
+func (gp *GatewayProcessor) responseHeaders(service string, header http.Header) http.Header {
+	headers := header.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	RemoveHopByHopHeaders(headers)
+	return gp.limitResponseHeaders(service, headers)
+}
+
+// limitResponseHeaders drops header lines beyond the configured count or total size.
+// Essential headers are kept first, the rest in name order so the outcome is stable.
+func (gp *GatewayProcessor) limitResponseHeaders(service string, headers http.Header) http.Header {
+	maxCount, maxBytes := gp.config.Headers.MaxCount, gp.config.Headers.MaxBytes
+
+	count, size := 0, 0
+	for key, values := range headers {
+		for _, value := range values {
+			count++
+			size += len(key) + len(value) + 4
+		}
+	}
+	if count <= maxCount && size <= maxBytes {
+		return headers
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if essentialHeaders[keys[i]] != essentialHeaders[keys[j]] {
+			return essentialHeaders[keys[i]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	limited := make(http.Header, maxCount)
+	kept, used := 0, 0
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			headerSize := len(key) + len(value) + 4
+			if kept >= maxCount || used+headerSize > maxBytes {
+				continue
+			}
+			limited[key] = append(limited[key], value)
+			kept++
+			used += headerSize
+		}
+	}
+
+	dropped := count - kept
+	limited.Set("X-Gateway-Headers-Truncated", strconv.Itoa(dropped))
+
+	gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Dropped %d oversized response headers from %s", dropped, service), map[string]interface{}{
+		"service":       service,
+		"header_count":  count,
+		"header_bytes":  size,
+		"dropped_count": dropped,
+	})
+
+	return limited
+}
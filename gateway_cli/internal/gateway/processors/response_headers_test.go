@@ -0,0 +1,84 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestExcessResponseHeadersAreTruncated(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/many":
+			for i := 0; i < 50; i++ {
+				w.Header().Add("X-Trace", "hop-"+strconv.Itoa(i))
+			}
+		case "/large":
+			w.Header().Set("X-Blob-A", strings.Repeat("a", 600))
+			w.Header().Set("X-Blob-B", strings.Repeat("b", 600))
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	gp, mr := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream.URL, "", 5),
+	}, func(cfg *config.Config) {
+		cfg.Headers.MaxCount = 10
+		cfg.Headers.MaxBytes = 1024
+	})
+
+	proxy := func(path string) http.Header {
+		t.Helper()
+		resp, err := gp.ProxyRequest(context.Background(), "devices", path, path, http.MethodGet, nil, nil, "", nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: resp = %v, err = %v", path, resp, err)
+		}
+		return resp.Headers
+	}
+
+	if headers := proxy("/few"); headers.Get("X-Gateway-Headers-Truncated") != "" {
+		t.Fatalf("headers within the limits were marked truncated: %v", headers)
+	}
+
+	// Over the count limit: essential headers survive and the rest fill the cap
+	headers := proxy("/many")
+	count := 0
+	for key, values := range headers {
+		if key != "X-Gateway-Headers-Truncated" {
+			count += len(values)
+		}
+	}
+	if count != 10 || headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("kept %d header lines with Content-Type %q, want 10 including Content-Type", count, headers.Get("Content-Type"))
+	}
+	if dropped, _ := strconv.Atoi(headers.Get("X-Gateway-Headers-Truncated")); dropped < 40 {
+		t.Fatalf("X-Gateway-Headers-Truncated = %q, want the number of dropped lines", headers.Get("X-Gateway-Headers-Truncated"))
+	}
+
+	// Over the size limit: only one of the large headers fits
+	headers = proxy("/large")
+	if headers.Get("X-Blob-A") == "" || headers.Get("X-Blob-B") != "" {
+		t.Fatalf("X-Blob-A kept = %t, X-Blob-B kept = %t, want only the first", headers.Get("X-Blob-A") != "", headers.Get("X-Blob-B") != "")
+	}
+	if headers.Get("X-Gateway-Headers-Truncated") != "1" {
+		t.Fatalf("X-Gateway-Headers-Truncated = %q, want 1", headers.Get("X-Gateway-Headers-Truncated"))
+	}
+
+	entries, _ := mr.Stream(gp.config.Redis.LogsStream)
+	warned := false
+	for _, entry := range entries {
+		for _, value := range entry.Values {
+			warned = warned || strings.Contains(value, "oversized response headers from devices")
+		}
+	}
+	if !warned {
+		t.Fatal("truncation was not logged")
+	}
+}
@@ -0,0 +1,109 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// peekedBody replays bytes read for inspection ahead of the rest of a body
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// isIdempotent reports whether a request can be safely retried
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoffDelay returns the wait before retry number attempt (1-based): exponential
+// from the base delay, capped at the max delay, with jitter over the upper half
+func (gp *GatewayProcessor) backoffDelay(attempt int) time.Duration {
+	base := time.Duration(gp.config.Retry.BaseDelayMs) * time.Millisecond
+	maxDelay := time.Duration(gp.config.Retry.MaxDelayMs) * time.Millisecond
+
+	delay := base << (attempt - 1)
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	half := int64(delay) / 2
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// doWithRetry sends req, retrying idempotent requests on transport errors, 5xx
+// responses and, if the service sets a body trigger, 2xx responses flagged as
+// retryable, with exponential backoff. The body is rebuilt from bodyBytes for each
+// attempt and no retry is started that couldn't finish before deadline.
+// Returns the last response or error, the number of retries made and the last
+// attempt's round trip from dispatch to response headers.
+func (gp *GatewayProcessor) doWithRetry(ctx context.Context, deadline time.Time, client *http.Client, req *http.Request, bodyBytes []byte, trigger *config.RetryBodyTrigger) (*http.Response, int, time.Duration, error) {
+	attempts := 1
+	if isIdempotent(req.Method) {
+		attempts = max(gp.config.Retry.MaxAttempts, 1)
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		attemptReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		attemptReq.ContentLength = int64(len(bodyBytes))
+
+		dispatched := time.Now()
+		resp, err := client.Do(attemptReq)
+		roundTrip := time.Since(dispatched)
+		if err == nil {
+			decodeUpstreamBody(resp)
+		}
+		retries := attempt - 1
+		retryable := err != nil || resp.StatusCode >= 500 || gp.retryableBody(resp, trigger)
+		if !retryable || attempt >= attempts || ctx.Err() != nil {
+			return resp, retries, roundTrip, err
+		}
+
+		delay := gp.backoffDelay(attempt)
+		if time.Until(deadline) <= delay {
+			return resp, retries, roundTrip, err
+		}
+
+		// Discard the failed attempt's response before retrying
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, retries, roundTrip, ctx.Err()
+		}
+	}
+}
+
+// retryableBody reports whether a 2xx JSON response flags a transient error
+// through the service's body trigger. Bodies are inspected up to the buffer
+// threshold, and the bytes read are put back so the response stays intact.
+func (gp *GatewayProcessor) retryableBody(resp *http.Response, trigger *config.RetryBodyTrigger) bool {
+	if trigger == nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || !isJSONContentType(resp.Header.Get("Content-Type")) {
+		return false
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(resp.Body, int64(gp.config.Streaming.BufferThresholdBytes)))
+	resp.Body = peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), resp.Body), Closer: resp.Body}
+	if err != nil {
+		return false
+	}
+
+	value, ok := jsonField(peeked, trigger.Field)
+	return ok && fmt.Sprint(value) == trigger.Value
+}
@@ -0,0 +1,65 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// flaggingUpstream answers 200 with a body flagging the first failures calls
+// as retryable
+func flaggingUpstream(t *testing.T, failures int64) (*httptest.Server, *atomic.Int64) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"retryable":` + strconv.FormatBool(n <= failures) + `,"attempt":` + strconv.FormatInt(n, 10) + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestRetryOnFlaggedBody(t *testing.T) {
+	retrying := func(cfg *config.Config) {
+		cfg.Retry.MaxAttempts = 3
+		cfg.Retry.BaseDelayMs = 1
+		cfg.Retry.MaxDelayMs = 5
+	}
+	trigger := &config.RetryBodyTrigger{Field: "retryable", Value: "true"}
+
+	tests := []struct {
+		name      string
+		method    string
+		trigger   *config.RetryBodyTrigger
+		wantCalls int64
+	}{
+		{"flagged GET is retried", http.MethodGet, trigger, 3},
+		{"POST is not retried", http.MethodPost, trigger, 1},
+		{"no trigger configured", http.MethodGet, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, calls := flaggingUpstream(t, 2)
+			info := config.NewServiceInfo("devices", upstream.URL, "", 5)
+			info.RetryOnBody = tt.trigger
+			gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, retrying)
+
+			resp, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", tt.method, nil, nil, "", nil)
+			if err != nil {
+				t.Fatalf("proxy: %v", err)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Fatalf("upstream calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			want := `{"retryable":` + strconv.FormatBool(tt.wantCalls <= 2) + `,"attempt":` + strconv.FormatInt(tt.wantCalls, 10) + `}`
+			if resp.StatusCode != http.StatusOK || string(resp.Body) != want {
+				t.Fatalf("response = %d %s, want 200 %s", resp.StatusCode, resp.Body, want)
+			}
+		})
+	}
+}
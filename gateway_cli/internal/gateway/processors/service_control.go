@@ -0,0 +1,285 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+var (
+	// ErrRestartUnsupported is returned when no service control backend is configured
+	ErrRestartUnsupported = errors.New("service restarts are not configured")
+	// ErrRestartUnhealthy is returned when a restarted service didn't pass a
+	// health check within the wait period
+	ErrRestartUnhealthy = errors.New("service unhealthy after restart")
+)
+
+// ServiceController restarts the process behind a service
+type ServiceController interface {
+	Restart(ctx context.Context, service string, serviceInfo *config.ServiceInfo) error
+}
+
+// NewServiceController creates the configured backend, or nil when restarts are disabled
+func NewServiceController(cfg config.ServiceControlConfig) (ServiceController, error) {
+	switch cfg.Backend {
+	case config.ServiceControlDocker:
+		controller, err := NewDockerController(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return controller, nil
+	case config.ServiceControlSystemd:
+		return NewSystemdController(), nil
+	default:
+		return nil, nil
+	}
+}
+
+// DockerController restarts containers through the Docker Engine API. It
+// speaks the two REST calls it needs directly rather than through the Docker
+// SDK, whose module pulls in a large dependency tree for a restart endpoint.
+type DockerController struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewDockerController talks to the engine at the configured host, a unix://
+// socket or a tcp:// address, with calls pinned to the configured API version.
+// https:// hosts, and tcp:// ones with TLS configured, are reached over TLS
+// with the configured CA and client certificate.
+func NewDockerController(cfg config.ServiceControlConfig) (*DockerController, error) {
+	u, err := url.Parse(cfg.DockerHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host: %w", err)
+	}
+	version := "/v" + strings.TrimPrefix(cfg.DockerAPIVersion, "v")
+
+	transport := &http.Transport{}
+	if cfg.DockerTLS != nil {
+		tlsConfig, err := cfg.DockerTLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid docker TLS config: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	client := &http.Client{Transport: transport}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		return &DockerController{client: client, baseURL: "http://docker" + version}, nil
+	case "tcp":
+		if cfg.DockerTLS != nil {
+			return &DockerController{client: client, baseURL: "https://" + u.Host + version}, nil
+		}
+		return &DockerController{client: client, baseURL: "http://" + u.Host + version}, nil
+	case "http":
+		return &DockerController{client: client, baseURL: "http://" + u.Host + version}, nil
+	case "https":
+		return &DockerController{client: client, baseURL: "https://" + u.Host + version}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme %q", u.Scheme)
+	}
+}
+
+// Restart restarts the service's container, or every container matching its label
+func (c *DockerController) Restart(ctx context.Context, service string, serviceInfo *config.ServiceInfo) error {
+	containers := []string{serviceInfo.Container}
+	if serviceInfo.ContainerLabel != "" {
+		var err error
+		containers, err = c.containersByLabel(ctx, serviceInfo.ContainerLabel)
+		if err != nil {
+			return err
+		}
+		if len(containers) == 0 {
+			return fmt.Errorf("no container with label %s", serviceInfo.ContainerLabel)
+		}
+	} else if containers[0] == "" {
+		containers[0] = service
+	}
+
+	for _, container := range containers {
+		resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/restart")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNoContent:
+		case http.StatusNotFound:
+			return fmt.Errorf("container %s not found", container)
+		default:
+			return fmt.Errorf("restarting container %s: docker returned %d", container, resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+func (c *DockerController) containersByLabel(ctx context.Context, label string) ([]string, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/json?filters="+url.QueryEscape(string(filters)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing containers: docker returned %d", resp.StatusCode)
+	}
+
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.ID)
+	}
+	return ids, nil
+}
+
+func (c *DockerController) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// SystemdController restarts units with systemctl
+type SystemdController struct {
+	run func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+func NewSystemdController() *SystemdController {
+	return &SystemdController{run: runCommand}
+}
+
+// Restart restarts the service's unit, named after the service unless configured
+func (c *SystemdController) Restart(ctx context.Context, service string, serviceInfo *config.ServiceInfo) error {
+	unit := serviceInfo.SystemdUnit
+	if unit == "" {
+		unit = service
+	}
+
+	// "--" keeps a unit name starting with "-" from being read as an option
+	output, err := c.run(ctx, "systemctl", "restart", "--", unit)
+	if err != nil {
+		return fmt.Errorf("systemctl restart %s: %w: %s", unit, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// SetServiceController replaces the backend used by RestartService
+func (gp *GatewayProcessor) SetServiceController(controller ServiceController) {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	gp.controller = controller
+}
+
+// RestartService restarts a service through the configured backend and waits
+// for it to pass a health check. On ErrRestartUnhealthy the last health check
+// result is returned along with the error.
+func (gp *GatewayProcessor) RestartService(ctx context.Context, service string) (*models.HealthCheckResult, error) {
+	gp.mu.RLock()
+	serviceInfo, exists := gp.services[service]
+	controller := gp.controller
+	gp.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, service)
+	}
+	if controller == nil {
+		return nil, ErrRestartUnsupported
+	}
+
+	restartCtx, cancel := context.WithTimeout(ctx, time.Duration(gp.config.ServiceControl.TimeoutSeconds)*time.Second)
+	err := controller.Restart(restartCtx, service, serviceInfo)
+	cancel()
+	if err != nil {
+		gp.redis.PublishLog("error", "gateway", fmt.Sprintf("Restart of %s failed", service), map[string]interface{}{
+			"service": service,
+			"backend": gp.config.ServiceControl.Backend,
+			"error":   err.Error(),
+		})
+		return nil, fmt.Errorf("restart %s: %w", service, err)
+	}
+
+	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Restarted %s, waiting for health check", service), map[string]interface{}{
+		"service": service,
+		"backend": gp.config.ServiceControl.Backend,
+	})
+
+	result, err := gp.awaitHealthy(ctx, service, serviceInfo)
+	if err != nil {
+		gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("%s did not recover after restart", service), map[string]interface{}{
+			"service": service,
+			"error":   err.Error(),
+		})
+	}
+	return result, err
+}
+
+// awaitHealthy health checks a service every second until it serves traffic
+// again or the configured wait runs out
+func (gp *GatewayProcessor) awaitHealthy(ctx context.Context, service string, serviceInfo *config.ServiceInfo) (*models.HealthCheckResult, error) {
+	deadline := time.Now().Add(time.Duration(gp.config.ServiceControl.HealthWaitSeconds) * time.Second)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		result, err := gp.performHealthCheck(service, serviceInfo)
+		if err == nil && isServing(result.Status) {
+			return result, nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrRestartUnhealthy, err)
+			}
+			return result, fmt.Errorf("%w: %s", ErrRestartUnhealthy, result.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RestartDeadline is the longest RestartService may take
+func (gp *GatewayProcessor) RestartDeadline() time.Duration {
+	return time.Duration(gp.config.ServiceControl.TimeoutSeconds+gp.config.ServiceControl.HealthWaitSeconds) * time.Second
+}
@@ -0,0 +1,113 @@
+package processors
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// dockerEngine fakes the Engine API over TLS, recording the paths called
+func dockerEngine(t *testing.T) (*httptest.Server, *[]string) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte(`[{"Id":"abc"},{"Id":"def"}]`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/restart"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &paths
+}
+
+// writeCA saves the server's certificate as a CA bundle
+func writeCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, caPEM, 0o600); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+	return path
+}
+
+func TestDockerControllerUsesAPIVersionOverTLS(t *testing.T) {
+	server, paths := dockerEngine(t)
+	controller, err := NewDockerController(config.ServiceControlConfig{
+		DockerHost:       server.URL,
+		DockerAPIVersion: "1.41",
+		DockerTLS:        &config.TLSConfig{CAFile: writeCA(t, server)},
+	})
+	if err != nil {
+		t.Fatalf("new controller: %v", err)
+	}
+
+	if err := controller.Restart(context.Background(), "web", &config.ServiceInfo{}); err != nil {
+		t.Fatalf("restart by name: %v", err)
+	}
+	if err := controller.Restart(context.Background(), "web", &config.ServiceInfo{ContainerLabel: "app=web"}); err != nil {
+		t.Fatalf("restart by label: %v", err)
+	}
+
+	want := []string{
+		"POST /v1.41/containers/web/restart",
+		"GET /v1.41/containers/json",
+		"POST /v1.41/containers/abc/restart",
+		"POST /v1.41/containers/def/restart",
+	}
+	if !slices.Equal(*paths, want) {
+		t.Fatalf("engine calls = %v, want %v", *paths, want)
+	}
+}
+
+func TestDockerControllerVerifiesTLS(t *testing.T) {
+	server, paths := dockerEngine(t)
+	controller, err := NewDockerController(config.ServiceControlConfig{
+		DockerHost:       server.URL,
+		DockerAPIVersion: "v1.41",
+	})
+	if err != nil {
+		t.Fatalf("new controller: %v", err)
+	}
+
+	if err := controller.Restart(context.Background(), "web", &config.ServiceInfo{}); err == nil {
+		t.Fatal("restart through an untrusted certificate succeeded")
+	}
+	if len(*paths) != 0 {
+		t.Fatalf("engine reached without a trusted certificate: %v", *paths)
+	}
+}
+
+func TestSystemdControllerEndsOptionsBeforeUnit(t *testing.T) {
+	var args []string
+	controller := &SystemdController{run: func(ctx context.Context, name string, a ...string) ([]byte, error) {
+		args = append([]string{name}, a...)
+		return nil, nil
+	}}
+
+	if err := controller.Restart(context.Background(), "web", &config.ServiceInfo{SystemdUnit: "--force"}); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if want := []string{"systemctl", "restart", "--", "--force"}; !slices.Equal(args, want) {
+		t.Fatalf("command = %v, want %v", args, want)
+	}
+}
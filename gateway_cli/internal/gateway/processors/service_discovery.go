@@ -0,0 +1,205 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// ServiceDiscovery supplies the service registry
+type ServiceDiscovery interface {
+	Services(ctx context.Context) (map[string]config.ServiceInfo, error)
+	// Watch calls changed whenever the services may have changed, until stop
+	// is closed. Sources that never change return immediately.
+	Watch(stop <-chan struct{}, changed func())
+}
+
+// NewServiceDiscovery returns the discovery selected by SERVICE_DISCOVERY
+func NewServiceDiscovery(cfg *config.Config, redisClient *redis.Client) ServiceDiscovery {
+	if cfg.Services.Discovery == config.DiscoveryRedis {
+		return NewRedisDiscovery(redisClient, cfg.Services)
+	}
+	return NewStaticDiscovery(cfg.Services.Registry)
+}
+
+// StaticDiscovery serves the registry parsed from SERVICES
+type StaticDiscovery struct {
+	registry map[string]config.ServiceInfo
+}
+
+func NewStaticDiscovery(registry map[string]config.ServiceInfo) *StaticDiscovery {
+	return &StaticDiscovery{registry: registry}
+}
+
+func (d *StaticDiscovery) Services(ctx context.Context) (map[string]config.ServiceInfo, error) {
+	return d.registry, nil
+}
+
+func (d *StaticDiscovery) Watch(stop <-chan struct{}, changed func()) {}
+
+// RedisDiscovery builds the registry from heartbeat keys services keep alive
+// under a prefix, <prefix><service>:<instance-id>, each holding the instance's
+// registration. A key whose TTL lapses drops the instance.
+type RedisDiscovery struct {
+	redis  *redis.Client
+	prefix string
+	poll   time.Duration
+}
+
+func NewRedisDiscovery(redisClient *redis.Client, cfg config.ServicesConfig) *RedisDiscovery {
+	return &RedisDiscovery{
+		redis:  redisClient,
+		prefix: cfg.DiscoveryPrefix,
+		poll:   time.Duration(cfg.DiscoveryPollSeconds) * time.Second,
+	}
+}
+
+func (d *RedisDiscovery) Services(ctx context.Context) (map[string]config.ServiceInfo, error) {
+	var keys []string
+	iter := d.redis.Scan(ctx, 0, d.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan discovery keys: %w", err)
+	}
+	sort.Strings(keys)
+
+	registry := make(map[string]config.ServiceInfo)
+	if len(keys) == 0 {
+		return registry, nil
+	}
+
+	values, err := d.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read discovery keys: %w", err)
+	}
+
+	instances := make(map[string][]models.ServiceRegistration)
+	var names []string
+	for i, key := range keys {
+		// Keys may expire between SCAN and MGET
+		data, ok := values[i].(string)
+		if !ok {
+			continue
+		}
+		name, _, found := strings.Cut(strings.TrimPrefix(key, d.prefix), ":")
+		if !found {
+			continue
+		}
+
+		var reg models.ServiceRegistration
+		if err := json.Unmarshal([]byte(data), &reg); err != nil {
+			continue
+		}
+		reg.Name = name
+		if validateRegistration(reg) != nil {
+			continue
+		}
+
+		if _, seen := instances[name]; !seen {
+			names = append(names, name)
+		}
+		instances[name] = append(instances[name], reg)
+	}
+
+	for _, name := range names {
+		regs := instances[name]
+		info := config.NewServiceInfo(name, regs[0].URL, regs[0].HealthCheck, regs[0].Timeout)
+		info.Instances = nil
+		info.InstanceWeights = nil
+		for _, reg := range regs {
+			info.Instances = append(info.Instances, reg.URL)
+			info.InstanceWeights = append(info.InstanceWeights, 1)
+		}
+		registry[name] = info
+	}
+
+	return registry, nil
+}
+
+// Watch polls, and also reacts to keyspace notifications for the prefix when
+// Redis has them enabled
+func (d *RedisDiscovery) Watch(stop <-chan struct{}, changed func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pubsub := d.redis.PSubscribe(ctx, fmt.Sprintf("__keyspace@%d__:%s*", d.redis.Options().DB, d.prefix))
+	defer pubsub.Close()
+	notifications := pubsub.Channel()
+
+	ticker := time.NewTicker(d.poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			changed()
+		case <-notifications:
+			changed()
+		}
+	}
+}
+
+// WatchServiceDiscovery applies registry changes reported by the service
+// discovery until the processor stops
+func (gp *GatewayProcessor) WatchServiceDiscovery() {
+	gp.reloadMu.Lock()
+	discovery := gp.discovery
+	gp.reloadMu.Unlock()
+
+	discovery.Watch(gp.stopChan, gp.refreshDiscovery)
+}
+
+func (gp *GatewayProcessor) refreshDiscovery() {
+	gp.reloadMu.Lock()
+	defer gp.reloadMu.Unlock()
+
+	// Keep the running registry while discovery is unreachable
+	registry, err := gp.discovery.Services(context.Background())
+	if err != nil {
+		gp.redis.PublishLog("warn", "gateway", "Service discovery failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	registry = gp.withRegistered(registry)
+	if err := config.ValidateRegistry(registry); err != nil {
+		gp.redis.PublishLog("warn", "gateway", "Ignoring invalid registry from discovery", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	diff := gp.registryDiff(registry)
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 {
+		return
+	}
+
+	gp.swapServices(registry)
+
+	gp.redis.PublishLog("info", "gateway", "Service registry updated from discovery", map[string]interface{}{
+		"added":   diff.Added,
+		"removed": diff.Removed,
+		"changed": diff.Changed,
+	})
+}
+
+// discoveredRegistry returns the registry a reload to cfg applies: the new
+// SERVICES for static discovery, the current entries otherwise. Callers hold
+// reloadMu.
+func (gp *GatewayProcessor) discoveredRegistry(cfg *config.Config) (map[string]config.ServiceInfo, error) {
+	if _, static := gp.discovery.(*StaticDiscovery); static {
+		return cfg.Services.Registry, nil
+	}
+	return gp.discovery.Services(context.Background())
+}
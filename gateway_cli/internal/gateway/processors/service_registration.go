@@ -0,0 +1,171 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// registeredServicesKey is the Redis hash of runtime registrations, by name
+const registeredServicesKey = "gateway:services:registered"
+
+var (
+	// ErrServiceExists is returned when registering a name already in the registry
+	ErrServiceExists = errors.New("service already registered")
+	// ErrServiceNotRegistered is returned when deregistering a service from SERVICES
+	ErrServiceNotRegistered = errors.New("service is configured, not registered at runtime")
+	// ErrInvalidRegistration is returned for registrations with a bad name or URL,
+	// or that would leave the registry invalid
+	ErrInvalidRegistration = errors.New("invalid service registration")
+	// ErrServiceInUse is returned when deregistering a service others depend on
+	ErrServiceInUse = errors.New("service is a dependency of other services")
+)
+
+// RegisterService adds a backend to the registry at runtime and probes it right
+// away. The resulting registry is validated like the configured one before it
+// is applied. Registrations are kept in Redis and restored when the gateway restarts.
+func (gp *GatewayProcessor) RegisterService(reg models.ServiceRegistration) (*config.ServiceInfo, error) {
+	if err := validateRegistration(reg); err != nil {
+		return nil, err
+	}
+
+	gp.reloadMu.Lock()
+	defer gp.reloadMu.Unlock()
+
+	registry := gp.currentRegistry()
+	if _, exists := registry[reg.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrServiceExists, reg.Name)
+	}
+	info := config.NewServiceInfo(reg.Name, reg.URL, reg.HealthCheck, reg.Timeout)
+	registry[reg.Name] = info
+	if err := config.ValidateRegistry(registry); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRegistration, err)
+	}
+
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal registration: %w", err)
+	}
+	if err := gp.redis.HSet(context.Background(), registeredServicesKey, reg.Name, data).Err(); err != nil {
+		return nil, fmt.Errorf("failed to persist registration: %w", err)
+	}
+
+	gp.registered[reg.Name] = reg
+	gp.swapServices(registry)
+
+	go gp.CheckServiceHealth(reg.Name)
+
+	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Service %s registered", reg.Name), map[string]interface{}{
+		"service": reg.Name,
+		"url":     reg.URL,
+	})
+
+	return &info, nil
+}
+
+// DeregisterService removes a service added with RegisterService, unless other
+// services depend on it. Services configured through SERVICES can only be
+// removed by a config reload.
+func (gp *GatewayProcessor) DeregisterService(name string) error {
+	gp.reloadMu.Lock()
+	defer gp.reloadMu.Unlock()
+
+	registry := gp.currentRegistry()
+	if _, exists := registry[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+	}
+	if _, ok := gp.registered[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrServiceNotRegistered, name)
+	}
+	delete(registry, name)
+	if err := config.ValidateRegistry(registry); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrServiceInUse, name, err)
+	}
+
+	if err := gp.redis.HDel(context.Background(), registeredServicesKey, name).Err(); err != nil {
+		return fmt.Errorf("failed to remove registration: %w", err)
+	}
+
+	delete(gp.registered, name)
+	gp.swapServices(registry)
+
+	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Service %s deregistered", name), map[string]interface{}{
+		"service": name,
+	})
+
+	return nil
+}
+
+func validateRegistration(reg models.ServiceRegistration) error {
+	if reg.Name == "" || strings.ContainsAny(reg.Name, ":,|;/ ") {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidRegistration, reg.Name)
+	}
+	if reg.Timeout < 0 {
+		return fmt.Errorf("%w: timeout must not be negative", ErrInvalidRegistration)
+	}
+
+	urls := []string{reg.URL}
+	if reg.HealthCheck != "" {
+		urls = append(urls, reg.HealthCheck)
+	}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "grpc") {
+			return fmt.Errorf("%w: invalid URL %q", ErrInvalidRegistration, raw)
+		}
+	}
+
+	return nil
+}
+
+// loadRegistrations restores runtime registrations saved in Redis; callers
+// hold reloadMu
+func (gp *GatewayProcessor) loadRegistrations() {
+	entries, err := gp.redis.HGetAll(context.Background(), registeredServicesKey).Result()
+	if err != nil {
+		gp.redis.PublishLog("warn", "gateway", "Failed to load registered services", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for name, data := range entries {
+		var reg models.ServiceRegistration
+		if err := json.Unmarshal([]byte(data), &reg); err != nil || validateRegistration(reg) != nil {
+			gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Ignoring invalid registration for %s", name), nil)
+			continue
+		}
+		gp.registered[name] = reg
+	}
+}
+
+// withRegistered adds runtime registrations to a configured registry. A service
+// configured under the same name takes precedence. Callers hold reloadMu.
+func (gp *GatewayProcessor) withRegistered(registry map[string]config.ServiceInfo) map[string]config.ServiceInfo {
+	merged := make(map[string]config.ServiceInfo, len(registry)+len(gp.registered))
+	for name, reg := range gp.registered {
+		merged[name] = config.NewServiceInfo(name, reg.URL, reg.HealthCheck, reg.Timeout)
+	}
+	for name, info := range registry {
+		merged[name] = info
+	}
+	return merged
+}
+
+// currentRegistry copies the running registry
+func (gp *GatewayProcessor) currentRegistry() map[string]config.ServiceInfo {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+
+	registry := make(map[string]config.ServiceInfo, len(gp.services))
+	for name, info := range gp.services {
+		registry[name] = *info
+	}
+	return registry
+}
@@ -0,0 +1,76 @@
+package processors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+func TestRegisterServiceValidatesMergedRegistry(t *testing.T) {
+	// A registry discovered with a cycle, which the configured registry's
+	// validation never saw
+	scenes := config.NewServiceInfo("scenes", "http://scenes:8080", "", 5)
+	scenes.DependsOn = []string{"automation"}
+	automation := config.NewServiceInfo("automation", "http://automation:8080", "", 5)
+	automation.DependsOn = []string{"scenes"}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"scenes": scenes, "automation": automation}, nil)
+
+	_, err := gp.RegisterService(models.ServiceRegistration{Name: "devices", URL: "http://devices:8080"})
+	if !errors.Is(err, ErrInvalidRegistration) {
+		t.Fatalf("register into a cyclic registry: err = %v, want ErrInvalidRegistration", err)
+	}
+	if gp.ServiceCount() != 2 {
+		t.Fatalf("service count = %d after a rejected registration, want 2", gp.ServiceCount())
+	}
+	if _, ok := gp.registered["devices"]; ok {
+		t.Fatal("rejected registration was kept")
+	}
+}
+
+func TestDeregisterServiceKeepsDependencies(t *testing.T) {
+	automation := config.NewServiceInfo("automation", "http://automation:8080", "", 5)
+	automation.DependsOn = []string{"devices"}
+	gp, mr := newTestProcessor(t, map[string]config.ServiceInfo{"automation": automation}, nil)
+
+	if _, err := gp.RegisterService(models.ServiceRegistration{Name: "devices", URL: "http://devices:8080"}); err != nil {
+		t.Fatalf("register the missing dependency: %v", err)
+	}
+	if gp.ServiceCount() != 2 {
+		t.Fatalf("service count = %d, want 2", gp.ServiceCount())
+	}
+
+	err := gp.DeregisterService("devices")
+	if !errors.Is(err, ErrServiceInUse) {
+		t.Fatalf("deregister a dependency: err = %v, want ErrServiceInUse", err)
+	}
+	if gp.ServiceCount() != 2 {
+		t.Fatalf("service count = %d after a rejected deregistration, want 2", gp.ServiceCount())
+	}
+	if !mr.Exists(registeredServicesKey) || mr.HGet(registeredServicesKey, "devices") == "" {
+		t.Fatal("registration removed from Redis")
+	}
+}
+
+func TestRegisterAndDeregisterService(t *testing.T) {
+	gp, mr := newTestProcessor(t, map[string]config.ServiceInfo{}, nil)
+
+	info, err := gp.RegisterService(models.ServiceRegistration{Name: "devices", URL: "http://devices:8080"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if info.Timeout <= 0 {
+		t.Fatalf("registered timeout = %d, want the default", info.Timeout)
+	}
+	if _, err := gp.RegisterService(models.ServiceRegistration{Name: "devices", URL: "http://other:8080"}); !errors.Is(err, ErrServiceExists) {
+		t.Fatalf("register twice: err = %v, want ErrServiceExists", err)
+	}
+
+	if err := gp.DeregisterService("devices"); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+	if gp.ServiceCount() != 0 || mr.HGet(registeredServicesKey, "devices") != "" {
+		t.Fatal("service still registered after deregistration")
+	}
+}
@@ -0,0 +1,77 @@
+package processors
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// ReloadServices re-reads the environment and applies the service registry the
+// same way a SIGHUP reload does, returning what changed. Unchanged services
+// keep their balancer, breaker and health state.
+func (gp *GatewayProcessor) ReloadServices() (*models.ServiceRegistryDiff, error) {
+	cfg, err := config.Reload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	gp.reloadMu.Lock()
+	defer gp.reloadMu.Unlock()
+
+	registry, err := gp.discoveredRegistry(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("service discovery failed: %w", err)
+	}
+
+	diff := gp.registryDiff(gp.withRegistered(registry))
+	if err := gp.reloadConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	gp.redis.PublishLog("info", "gateway", "Service registry reloaded", map[string]interface{}{
+		"added":   diff.Added,
+		"removed": diff.Removed,
+		"changed": diff.Changed,
+	})
+
+	return diff, nil
+}
+
+// registryDiff compares a registry with the running one
+func (gp *GatewayProcessor) registryDiff(registry map[string]config.ServiceInfo) *models.ServiceRegistryDiff {
+	diff := &models.ServiceRegistryDiff{
+		Added:     []string{},
+		Removed:   []string{},
+		Changed:   []string{},
+		Unchanged: []string{},
+	}
+
+	gp.mu.RLock()
+	for name, serviceInfo := range registry {
+		existing, ok := gp.services[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case reflect.DeepEqual(*existing, serviceInfo):
+			diff.Unchanged = append(diff.Unchanged, name)
+		default:
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range gp.services {
+		if _, ok := registry[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	gp.mu.RUnlock()
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Unchanged)
+
+	return diff
+}
@@ -0,0 +1,195 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// reloadedConfig loads a fresh config serving the given static registry, the
+// way a SIGHUP reload builds one
+func reloadedConfig(t *testing.T, registry map[string]config.ServiceInfo, setup func(*config.Config)) *config.Config {
+	t.Helper()
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.Services.Discovery = config.DiscoveryStatic
+	cfg.Services.Registry = registry
+	if setup != nil {
+		setup(cfg)
+	}
+	return cfg
+}
+
+func TestRejectedReloadKeepsRegistry(t *testing.T) {
+	upstream, hits := countingUpstream(t)
+	closed, _ := countingUpstream(t)
+	closed.Close()
+
+	devices := config.NewServiceInfo("devices", upstream.URL, "", 5)
+
+	badURL := config.NewServiceInfo("devices", "not-a-url", "", 5)
+	unknownDependency := config.NewServiceInfo("automation", upstream.URL, "", 5)
+	unknownDependency.DependsOn = []string{"scenes"}
+	downCritical := config.NewServiceInfo("automation", closed.URL, "", 1)
+	downCritical.Critical = true
+
+	tests := []struct {
+		name     string
+		registry map[string]config.ServiceInfo
+		setup    func(*config.Config)
+	}{
+		{
+			name:     "invalid url",
+			registry: map[string]config.ServiceInfo{"devices": badURL},
+		},
+		{
+			name:     "unknown dependency",
+			registry: map[string]config.ServiceInfo{"devices": devices, "automation": unknownDependency},
+		},
+		{
+			name:     "critical service down",
+			registry: map[string]config.ServiceInfo{"devices": devices, "automation": downCritical},
+			setup:    func(cfg *config.Config) { cfg.Reload.ProbeCritical = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": devices}, nil)
+
+			if err := gp.ReloadConfig(reloadedConfig(t, tt.registry, tt.setup)); err == nil {
+				t.Fatal("reload was accepted, want it rejected")
+			}
+
+			if gp.ServiceCount() != 1 {
+				t.Fatalf("service count = %d after a rejected reload, want 1", gp.ServiceCount())
+			}
+			gp.mu.RLock()
+			running := gp.services["devices"]
+			gp.mu.RUnlock()
+			if running == nil || running.URL != upstream.URL {
+				t.Fatalf("devices = %+v after a rejected reload, want it still at %s", running, upstream.URL)
+			}
+
+			before := hits.Load()
+			resp, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("proxy after a rejected reload: resp = %v, err = %v", resp, err)
+			}
+			if hits.Load() != before+1 {
+				t.Fatal("request did not reach the original upstream")
+			}
+		})
+	}
+}
+
+func TestReloadAppliesRegistry(t *testing.T) {
+	devicesUpstream, _ := countingUpstream(t)
+	automationUpstream, automationHits := countingUpstream(t)
+
+	devices := config.NewServiceInfo("devices", devicesUpstream.URL, "", 5)
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": devices}, nil)
+
+	gp.mu.RLock()
+	balancer := gp.balancers["devices"]
+	gp.mu.RUnlock()
+
+	automation := config.NewServiceInfo("automation", automationUpstream.URL, "", 5)
+	registry := map[string]config.ServiceInfo{"devices": devices, "automation": automation}
+	if err := gp.ReloadConfig(reloadedConfig(t, registry, nil)); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if gp.ServiceCount() != 2 {
+		t.Fatalf("service count = %d after reload, want 2", gp.ServiceCount())
+	}
+	gp.mu.RLock()
+	kept := gp.balancers["devices"] == balancer
+	gp.mu.RUnlock()
+	if !kept {
+		t.Fatal("unchanged service lost its balancer on reload")
+	}
+
+	resp, err := gp.ProxyRequest(context.Background(), "automation", "/api/automation", "/api/automation", http.MethodGet, nil, nil, "", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("proxy to the added service: resp = %v, err = %v", resp, err)
+	}
+	if automationHits.Load() != 1 {
+		t.Fatalf("added service upstream saw %d requests, want 1", automationHits.Load())
+	}
+}
+
+func TestReloadServicesDuringHealthChecks(t *testing.T) {
+	devicesUpstream, _ := countingUpstream(t)
+	automationUpstream, _ := countingUpstream(t)
+
+	devices := config.NewServiceInfo("devices", devicesUpstream.URL, "", 5)
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": devices}, nil)
+	go gp.StartHealthChecker()
+	t.Cleanup(gp.Stop)
+
+	// Reloads alternate between adding and removing a service while health
+	// checks, status reads and proxied requests run against the registry
+	registries := []string{
+		"devices:" + devicesUpstream.URL + ",automation:" + automationUpstream.URL,
+		"devices:" + devicesUpstream.URL,
+	}
+	t.Setenv("SERVICES", registries[0])
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, work := range []func(){
+		func() { gp.CheckServiceHealth("devices") },
+		func() { gp.CheckServiceHealth("automation") },
+		func() { gp.GetServicesStatus() },
+		func() {
+			gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+		},
+	} {
+		wg.Add(1)
+		go func(work func()) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					work()
+				}
+			}
+		}(work)
+	}
+
+	for i := 0; i < 20; i++ {
+		os.Setenv("SERVICES", registries[i%2])
+		diff, err := gp.ReloadServices()
+		if err != nil {
+			close(done)
+			wg.Wait()
+			t.Fatalf("reload %d: %v", i, err)
+		}
+		if !slices.Contains(diff.Unchanged, "devices") {
+			close(done)
+			wg.Wait()
+			t.Fatalf("reload %d: devices reported %+v, want it unchanged", i, diff)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	status := gp.GetServicesStatus()
+	if _, ok := status["automation"]; ok {
+		t.Fatal("removed service still reported after the last reload")
+	}
+	if status["devices"] == nil || status["devices"].Status != "healthy" {
+		t.Fatalf("devices status = %+v, want healthy", status["devices"])
+	}
+}
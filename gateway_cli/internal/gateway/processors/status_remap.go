@@ -0,0 +1,54 @@
+package processors
+
+import (
+	"encoding/json"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// remapStatus returns the error status a JSON body reports through the
+// service's configured field, or false if the body doesn't report an error
+func remapStatus(remap *config.StatusRemap, contentType string, body []byte) (int, bool) {
+	if !isJSONContentType(contentType) {
+		return 0, false
+	}
+
+	value, ok := jsonField(body, remap.Field)
+	if !ok {
+		return 0, false
+	}
+
+	var key string
+	switch v := value.(type) {
+	case nil:
+		return 0, false
+	case bool:
+		if !v {
+			return 0, false
+		}
+		key = "true"
+	case json.Number:
+		if code, ok := remap.Codes[v.String()]; ok {
+			return code, true
+		}
+		if n, err := v.Int64(); err == nil && n >= 400 && n <= 599 {
+			return int(n), true
+		}
+		key = v.String()
+	case string:
+		if v == "" {
+			return 0, false
+		}
+		key = v
+	default:
+		key = "*"
+	}
+
+	if code, ok := remap.Codes[key]; ok {
+		return code, true
+	}
+	if code, ok := remap.Codes["*"]; ok {
+		return code, true
+	}
+	return 0, false
+}
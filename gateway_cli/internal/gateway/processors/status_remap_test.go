@@ -0,0 +1,71 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestStatusRemap(t *testing.T) {
+	bodies := map[string]string{
+		"/named":   `{"error":{"code":"NOT_FOUND"}}`,
+		"/numeric": `{"error":{"code":503}}`,
+		"/other":   `{"error":{"code":"WEIRD"}}`,
+		"/null":    `{"error":{"code":null}}`,
+		"/ok":      `{"data":{"id":1}}`,
+		"/text":    `{"error":{"code":"NOT_FOUND"}}`,
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/text" {
+			w.Header().Set("Content-Type", "text/plain")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write([]byte(bodies[r.URL.Path]))
+	}))
+	defer upstream.Close()
+
+	info := config.NewServiceInfo("devices", upstream.URL, "", 5)
+	info.StatusRemap = &config.StatusRemap{
+		Field: "error.code",
+		Codes: map[string]int{"NOT_FOUND": http.StatusNotFound, "*": http.StatusBadGateway},
+	}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, nil)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/named", http.StatusNotFound},
+		{"/numeric", http.StatusServiceUnavailable},
+		{"/other", http.StatusBadGateway},
+		{"/null", http.StatusOK},
+		{"/ok", http.StatusOK},
+		{"/text", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := gp.ProxyRequest(context.Background(), "devices", tt.path, tt.path, http.MethodGet, nil, nil, "", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+
+		original := resp.Headers.Get("X-Gateway-Original-Status")
+		if remapped := tt.want != http.StatusOK; remapped != (original == "200") {
+			t.Errorf("%s: X-Gateway-Original-Status = %q", tt.path, original)
+		}
+		if string(resp.Body) != bodies[tt.path] {
+			t.Errorf("%s: body = %s, want it unchanged", tt.path, resp.Body)
+		}
+	}
+
+	// Remapped responses count as errors
+	if metrics := gp.GetMetrics(); metrics.ErrorRequests != 3 || metrics.SuccessRequests != 3 {
+		t.Fatalf("success/error = %d/%d, want 3/3", metrics.SuccessRequests, metrics.ErrorRequests)
+	}
+}
@@ -0,0 +1,52 @@
+package processors
+
+import (
+	"fmt"
+	"sync"
+)
+
+// streamRegistry tracks streamed responses still being relayed to clients, so
+// shutdown can end them instead of waiting for long-lived streams to finish
+type streamRegistry struct {
+	mu      sync.Mutex
+	streams map[*countingStream]struct{}
+}
+
+// trackStream registers a stream until it is closed
+func (gp *GatewayProcessor) trackStream(stream *countingStream) *countingStream {
+	gp.activeStreams.mu.Lock()
+	gp.activeStreams.streams[stream] = struct{}{}
+	gp.activeStreams.mu.Unlock()
+
+	onClose := stream.onClose
+	stream.onClose = func(objects, bytes int64) {
+		gp.activeStreams.mu.Lock()
+		delete(gp.activeStreams.streams, stream)
+		gp.activeStreams.mu.Unlock()
+		onClose(objects, bytes)
+	}
+	return stream
+}
+
+// CloseStreams ends every active streamed response by cancelling its upstream
+// request. The handlers relaying them see the body end and finish the response
+// (e.g. an SSE stream ends), which lets the HTTP server shut down promptly.
+func (gp *GatewayProcessor) CloseStreams() {
+	gp.activeStreams.mu.Lock()
+	streams := make([]*countingStream, 0, len(gp.activeStreams.streams))
+	for stream := range gp.activeStreams.streams {
+		streams = append(streams, stream)
+	}
+	gp.activeStreams.mu.Unlock()
+
+	if len(streams) == 0 {
+		return
+	}
+
+	gp.redis.PublishLog("info", "gateway", fmt.Sprintf("Closing %d active streams for shutdown", len(streams)), map[string]interface{}{
+		"streams": len(streams),
+	})
+	for _, stream := range streams {
+		stream.cancel()
+	}
+}
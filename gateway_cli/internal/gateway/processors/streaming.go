@@ -0,0 +1,135 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// countingStream relays a streamed upstream body, counting the bytes and
+// newline-delimited objects that pass through and reporting them once closed
+type countingStream struct {
+	reader  io.Reader
+	body    io.Closer
+	cancel  context.CancelFunc
+	objects int64
+	bytes   int64
+	onClose func(objects, bytes int64)
+	once    sync.Once
+}
+
+func (s *countingStream) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.bytes += int64(n)
+	s.objects += int64(bytes.Count(p[:n], []byte{'\n'}))
+	return n, err
+}
+
+func (s *countingStream) Close() error {
+	err := s.body.Close()
+	s.cancel()
+	s.once.Do(func() {
+		s.onClose(s.objects, s.bytes)
+	})
+	return err
+}
+
+// proxyNDJSON executes a request to an NDJSON service and returns the response
+// with an open Stream instead of a buffered body. The service timeout bounds
+// the wait for response headers only, so long-running streams aren't cut off.
+func (gp *GatewayProcessor) proxyNDJSON(ctx context.Context, req *http.Request, breaker *CircuitBreaker, service, route, path string, timeout time.Duration, startTime time.Time, userID, requestID string, metricLabels map[string]string) (*models.ProxyResponse, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	headerTimer := time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+
+	resp, err := gp.clientsFor(service).stream.Do(req.WithContext(ctx))
+	headerTimer.Stop()
+	if err == nil {
+		decodeUpstreamBody(resp)
+	}
+	duration := time.Since(startTime)
+
+	if err != nil && isClientDisconnect(ctx) {
+		cancel(nil)
+		if breaker != nil {
+			breaker.Cancel()
+		}
+		gp.recordClientDisconnect(service, req.Method, path, duration, userID, requestID, withLabels(map[string]interface{}{
+			"phase": "upstream",
+			"route": route,
+		}, metricLabels))
+		return nil, ErrClientDisconnected
+	}
+	gp.recordCircuitOutcome(service, breaker, err == nil && resp.StatusCode < 500)
+
+	if err != nil {
+		cancel(nil)
+		gp.updateRequestMetrics(service, false)
+		gp.updateLatencyMetrics(service, duration, false)
+		gp.logMetrics("request", service, req.Method, path, duration, 0, userID, requestID, withLabels(map[string]interface{}{
+			"error": err.Error(),
+			"route": route,
+		}, metricLabels))
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	success := resp.StatusCode >= 200 && resp.StatusCode < 400
+	gp.updateRequestMetrics(service, success)
+	gp.updateLatencyMetrics(service, duration, success)
+
+	stream := gp.trackStream(&countingStream{
+		reader: resp.Body,
+		body:   resp.Body,
+		cancel: func() { cancel(nil) },
+		onClose: func(objects, bytes int64) {
+			gp.logMetrics("request", service, req.Method, path, time.Since(startTime), resp.StatusCode, userID, requestID, withLabels(map[string]interface{}{
+				"response_size":   bytes,
+				"success":         success,
+				"streamed":        true,
+				"ndjson_objects":  objects,
+				"time_to_headers": duration.Milliseconds(),
+				"route":           route,
+			}, metricLabels))
+		},
+	})
+
+	responseHeaders := gp.responseHeaders(service, resp.Header)
+
+	return &models.ProxyResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    responseHeaders,
+		Stream:     stream,
+		Duration:   duration,
+	}, nil
+}
+
+// isStreamingContentType reports whether responses of a content type are always
+// relayed as a stream rather than buffered
+func isStreamingContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "text/event-stream", "application/octet-stream", "application/x-ndjson":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/")
+}
+
+// StreamAborted logs a stream the gateway cut off, e.g. because the client was too slow
+func (gp *GatewayProcessor) StreamAborted(service, reason string, written int64) {
+	gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Stream from %s aborted: %s", service, reason), map[string]interface{}{
+		"service":       service,
+		"reason":        reason,
+		"bytes_written": written,
+	})
+}
@@ -0,0 +1,28 @@
+package processors
+
+import "time"
+
+// TagMetrics aggregates requests carrying one request tag
+type TagMetrics struct {
+	TotalRequests  int64   `json:"total_requests"`
+	ErrorRequests  int64   `json:"error_requests"`
+	AverageLatency float64 `json:"average_latency_ms"`
+}
+
+func (gp *GatewayProcessor) recordTagMetrics(tag string, duration time.Duration, success bool) {
+	gp.metrics.mu.Lock()
+	defer gp.metrics.mu.Unlock()
+
+	tagMetrics, exists := gp.metrics.TagMetrics[tag]
+	if !exists {
+		tagMetrics = &TagMetrics{}
+		gp.metrics.TagMetrics[tag] = tagMetrics
+	}
+
+	tagMetrics.TotalRequests++
+	if !success {
+		tagMetrics.ErrorRequests++
+	}
+	latencyMs := float64(duration.Milliseconds())
+	tagMetrics.AverageLatency += (latencyMs - tagMetrics.AverageLatency) / float64(tagMetrics.TotalRequests)
+}
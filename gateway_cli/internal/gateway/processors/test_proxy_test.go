@@ -0,0 +1,70 @@
+package processors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// countingUpstream answers 200 and counts the requests it received
+func countingUpstream(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestTestProxyLeavesMetricsAndRotationUntouched(t *testing.T) {
+	first, firstHits := countingUpstream(t)
+	second, secondHits := countingUpstream(t)
+
+	info := config.NewServiceInfo("devices", first.URL, "", 5)
+	info.Instances = []string{first.URL, second.URL}
+	info.InstanceWeights = []int{1, 1}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, nil)
+
+	before := gp.GetMetrics()
+	for i := 0; i < 3; i++ {
+		result, err := gp.TestProxy(context.Background(), "devices", models.TestProxyRequest{Path: "/api/devices"}, "admin")
+		if err != nil || result.StatusCode != http.StatusOK {
+			t.Fatalf("test request %d: result = %v, err = %v", i, result, err)
+		}
+		if result.Instance != first.URL {
+			t.Fatalf("test request %d went to %s, want the next instance in rotation %s", i, result.Instance, first.URL)
+		}
+	}
+
+	after := gp.GetMetrics()
+	if after.TotalRequests != before.TotalRequests || after.SuccessRequests != before.SuccessRequests || after.ErrorRequests != before.ErrorRequests {
+		t.Fatalf("metrics changed by test requests: before %d/%d/%d, after %d/%d/%d",
+			before.TotalRequests, before.SuccessRequests, before.ErrorRequests,
+			after.TotalRequests, after.SuccessRequests, after.ErrorRequests)
+	}
+	if service := after.ServiceMetrics["devices"]; service != nil && service.TotalRequests != 0 {
+		t.Fatalf("service metrics counted %d test requests", service.TotalRequests)
+	}
+
+	// Production traffic still alternates starting from the first instance
+	firstHits.Store(0)
+	secondHits.Store(0)
+	for i := 0; i < 2; i++ {
+		if _, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil); err != nil {
+			t.Fatalf("proxy request %d: %v", i, err)
+		}
+	}
+	if firstHits.Load() != 1 || secondHits.Load() != 1 {
+		t.Fatalf("production requests split %d/%d after test requests, want 1/1", firstHits.Load(), secondHits.Load())
+	}
+	if got := gp.GetMetrics().TotalRequests; got != before.TotalRequests+2 {
+		t.Fatalf("total requests = %d, want %d", got, before.TotalRequests+2)
+	}
+}
@@ -0,0 +1,76 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+// tombstone is the stored outcome of a successful DELETE
+type tombstone struct {
+	StatusCode int         `json:"status_code"`
+	Body       []byte      `json:"body,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+}
+
+// tombstoneKey identifies a deleted resource. The authenticated user is part of
+// the key so a tombstone never answers for someone the upstream didn't authorize.
+func tombstoneKey(service, path, userID string) string {
+	return fmt.Sprintf("gateway:tombstone:%s:%s:%s", service, userID, path)
+}
+
+// LookupTombstone returns the original response of an earlier successful DELETE
+// of the same resource, if it hasn't expired
+func (gp *GatewayProcessor) LookupTombstone(service, path, userID string) (*models.ProxyResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	data, err := gp.redis.Get(ctx, tombstoneKey(service, path, userID)).Result()
+	if err != nil {
+		return nil, false
+	}
+
+	var stored tombstone
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, false
+	}
+
+	headers := stored.Headers
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("X-Gateway-Tombstone", "true")
+
+	return &models.ProxyResponse{
+		StatusCode: stored.StatusCode,
+		Body:       stored.Body,
+		Headers:    headers,
+	}, true
+}
+
+// RecordTombstone stores a successful DELETE response for ttl
+func (gp *GatewayProcessor) RecordTombstone(service, path, userID string, resp *models.ProxyResponse, ttl time.Duration) {
+	data, err := json.Marshal(tombstone{
+		StatusCode: resp.StatusCode,
+		Body:       resp.Body,
+		Headers:    resp.Headers,
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := gp.redis.Set(ctx, tombstoneKey(service, path, userID), data, ttl).Err(); err != nil {
+		gp.redis.PublishLog("warn", "gateway", fmt.Sprintf("Failed to record DELETE tombstone for %s", service), map[string]interface{}{
+			"service": service,
+			"path":    path,
+			"error":   err.Error(),
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package processors
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// upstreamClients holds the HTTP clients used to reach a service
+type upstreamClients struct {
+	http *http.Client
+	// stream has no overall timeout so long-lived responses aren't cut off
+	stream *http.Client
+}
+
+// openUpstreamConns counts the upstream connections currently open across all transports
+var openUpstreamConns atomic.Int64
+
+// countedConn decrements openUpstreamConns once when closed
+type countedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { openUpstreamConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// countingDial wraps dial so its connections are counted while open
+func countingDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		openUpstreamConns.Add(1)
+		return &countedConn{Conn: conn}, nil
+	}
+}
+
+func newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		DialContext:         countingDial(dialer.DialContext),
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+func newUpstreamClients(transport *http.Transport, timeout time.Duration) *upstreamClients {
+	return &upstreamClients{
+		http: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		stream: &http.Client{
+			Transport: transport,
+		},
+	}
+}
+
+// closeIdle drops the pooled connections of clients that are no longer used
+func (c *upstreamClients) closeIdle() {
+	c.http.CloseIdleConnections()
+}
+
+// newServiceClients builds the dedicated clients of a service, with its own
+// connection pool so a slow service can't starve the others, and its TLS and
+// keep-alive settings. Unset pool settings keep the transport defaults.
+func newServiceClients(serviceInfo *config.ServiceInfo) (*upstreamClients, error) {
+	transport := newTransport()
+	if serviceInfo.MaxIdleConns > 0 {
+		transport.MaxIdleConns = serviceInfo.MaxIdleConns
+	}
+	if serviceInfo.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = serviceInfo.MaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = serviceInfo.MaxConnsPerHost
+	if serviceInfo.IdleConnTimeoutSeconds > 0 {
+		transport.IdleConnTimeout = time.Duration(serviceInfo.IdleConnTimeoutSeconds) * time.Second
+	}
+	if serviceInfo.DialTimeoutMs > 0 {
+		dialer := &net.Dialer{
+			Timeout:   time.Duration(serviceInfo.DialTimeoutMs) * time.Millisecond,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = countingDial(dialer.DialContext)
+	}
+	// Escape hatch for upstreams that misbehave on reused connections
+	transport.DisableKeepAlives = serviceInfo.DisableKeepAlive
+
+	if serviceInfo.TLS != nil {
+		tlsConfig, err := serviceInfo.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	// The request context enforces the service timeout; the client timeout
+	// only has to allow for it
+	timeout := 30 * time.Second
+	if serviceTimeout := time.Duration(serviceInfo.Timeout) * time.Second; serviceTimeout > timeout {
+		timeout = serviceTimeout
+	}
+
+	return newUpstreamClients(transport, timeout), nil
+}
+
+// clientsFor returns the clients to use for a service
+func (gp *GatewayProcessor) clientsFor(service string) *upstreamClients {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+
+	if clients, exists := gp.serviceClients[service]; exists {
+		return clients
+	}
+	return gp.defaultClients
+}
@@ -0,0 +1,143 @@
+package processors
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// writeClientCert writes a self-signed client certificate and its key,
+// returning their paths and the parsed certificate
+func writeClientCert(t *testing.T, commonName string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "client.pem")
+	keyFile = filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestMutualTLSPresentsClientCertificate(t *testing.T) {
+	certFile, keyFile, clientCert := writeClientCert(t, "gateway")
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"client":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	withCert := config.NewServiceInfo("devices", upstream.URL, "", 5)
+	withCert.TLS = &config.TLSConfig{CAFile: writeCA(t, upstream), CertFile: certFile, KeyFile: keyFile}
+	withoutCert := config.NewServiceInfo("automation", upstream.URL, "", 5)
+	withoutCert.TLS = &config.TLSConfig{CAFile: writeCA(t, upstream)}
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": withCert, "automation": withoutCert}, func(cfg *config.Config) {
+		cfg.Retry.MaxAttempts = 1
+	})
+
+	resp, err := gp.ProxyRequest(context.Background(), "devices", "/api/devices", "/api/devices", http.MethodGet, nil, nil, "", nil)
+	if err != nil {
+		t.Fatalf("proxy with client certificate: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != `{"client":"gateway"}` {
+		t.Fatalf("upstream answered %d %s, want it to see the gateway's certificate", resp.StatusCode, resp.Body)
+	}
+
+	if _, err := gp.ProxyRequest(context.Background(), "automation", "/api/automation", "/api/automation", http.MethodGet, nil, nil, "", nil); err == nil {
+		t.Fatal("proxy without a client certificate succeeded, want the handshake rejected")
+	}
+}
+
+func TestServicesGetTheirOwnClients(t *testing.T) {
+	tuned := config.NewServiceInfo("devices", "http://devices.test", "", 45)
+	tuned.MaxIdleConns = 7
+	tuned.MaxIdleConnsPerHost = 3
+	tuned.MaxConnsPerHost = 5
+	tuned.IdleConnTimeoutSeconds = 12
+	tuned.DisableKeepAlive = true
+	plain := config.NewServiceInfo("automation", "http://automation.test", "", 5)
+	badTLS := config.NewServiceInfo("scenes", "https://scenes.test", "", 5)
+	badTLS.TLS = &config.TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}
+
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{
+		"devices":    tuned,
+		"automation": plain,
+	}, nil)
+	// Validation rejects unreadable TLS files, so swap them in directly
+	gp.swapServices(map[string]config.ServiceInfo{"devices": tuned, "automation": plain, "scenes": badTLS})
+
+	devices, automation := gp.clientsFor("devices"), gp.clientsFor("automation")
+	if devices == automation || devices == gp.defaultClients || automation == gp.defaultClients {
+		t.Fatal("services share a client, want a dedicated pool each")
+	}
+
+	transport := devices.http.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 7 || transport.MaxIdleConnsPerHost != 3 || transport.MaxConnsPerHost != 5 ||
+		transport.IdleConnTimeout != 12*time.Second || !transport.DisableKeepAlives {
+		t.Fatalf("devices transport = idle %d, idle/host %d, conns/host %d, idle timeout %v, no keep-alive %v; want the service settings",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost, transport.IdleConnTimeout, transport.DisableKeepAlives)
+	}
+	if devices.http.Timeout != 45*time.Second || devices.stream.Timeout != 0 || devices.stream.Transport != transport {
+		t.Fatalf("devices timeouts = %v/%v, want the service timeout and an unbounded stream client on the same pool", devices.http.Timeout, devices.stream.Timeout)
+	}
+	if defaults := automation.http.Transport.(*http.Transport); defaults.MaxIdleConns != 100 || defaults.DisableKeepAlives {
+		t.Fatalf("automation transport = idle %d, no keep-alive %v; want the defaults", defaults.MaxIdleConns, defaults.DisableKeepAlives)
+	}
+
+	if gp.clientsFor("scenes") != gp.defaultClients || gp.clientsFor("unknown") != gp.defaultClients {
+		t.Fatal("services without usable settings should fall back to the default clients")
+	}
+
+	// Unchanged services keep their pool across a reload
+	gp.swapServices(map[string]config.ServiceInfo{"devices": tuned, "automation": plain})
+	if gp.clientsFor("devices") != devices || gp.clientsFor("automation") != automation {
+		t.Fatal("unchanged services got new clients on reload")
+	}
+}
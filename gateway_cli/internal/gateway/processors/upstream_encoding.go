@@ -0,0 +1,53 @@
+package processors
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+// setUpstreamEncoding asks the upstream for the service's configured encoding.
+// An explicit Accept-Encoding turns off the transport's transparent gzip, so
+// decodeUpstreamBody takes care of decompression.
+func setUpstreamEncoding(req *http.Request, serviceInfo *config.ServiceInfo) {
+	req.Header.Set("Accept-Encoding", serviceInfo.UpstreamEncoding)
+}
+
+// decodeUpstreamBody decompresses gzip responses as they are read, so status
+// remapping, retries and clients all see the plain body
+func decodeUpstreamBody(resp *http.Response) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), config.EncodingGzip) {
+		return
+	}
+
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// gzipBody opens the gzip stream on first read, so empty bodies (e.g. 204s)
+// read as empty instead of failing on a missing gzip header
+type gzipBody struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+	err    error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
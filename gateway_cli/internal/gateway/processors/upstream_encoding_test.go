@@ -0,0 +1,62 @@
+package processors
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+func TestUpstreamGetsGatewayEncoding(t *testing.T) {
+	var received atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/empty" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(`{"id":1}`))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(`{"id":1}`))
+		zw.Close()
+	}))
+	defer upstream.Close()
+
+	// The client's own Accept-Encoding is not what the upstream sees
+	clientHeaders := map[string]string{"Accept-Encoding": "br"}
+
+	for _, encoding := range []string{config.EncodingGzip, config.EncodingIdentity} {
+		info := config.NewServiceInfo("devices", upstream.URL, "", 5)
+		info.UpstreamEncoding = encoding
+		gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": info}, nil)
+
+		resp, err := gp.ProxyRequest(context.Background(), "devices", "/item", "/item", http.MethodGet, nil, clientHeaders, "", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if got, _ := received.Load().(string); got != encoding {
+			t.Errorf("%s: upstream got Accept-Encoding %q, want %q", encoding, got, encoding)
+		}
+		if string(resp.Body) != `{"id":1}` || resp.Headers.Get("Content-Encoding") != "" {
+			t.Errorf("%s: body = %q with Content-Encoding %q, want it decoded", encoding, resp.Body, resp.Headers.Get("Content-Encoding"))
+		}
+	}
+
+	// An empty response labelled gzip reads as empty
+	gp, _ := newTestProcessor(t, map[string]config.ServiceInfo{"devices": config.NewServiceInfo("devices", upstream.URL, "", 5)}, nil)
+	resp, err := gp.ProxyRequest(context.Background(), "devices", "/empty", "/empty", http.MethodGet, nil, clientHeaders, "", nil)
+	if err != nil || resp.StatusCode != http.StatusNoContent || len(resp.Body) != 0 {
+		t.Fatalf("empty gzip response: resp = %+v, err = %v, want an empty 204", resp, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package reqctx holds the request-scoped values middleware attaches to the
+// request context, under keys no other package can collide with.
+package reqctx
+
+import (
+	"context"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	clientIPKey
+	phaseTimingsKey
+	requestTagKey
+	rateLimitedKey
+	rateLimitDeferredKey
+	userKey
+	cachePrivateKey
+)
+
+// WithRequestID attaches the request's ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request's ID, if one was attached
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey).(string)
+	return requestID, ok
+}
+
+// WithClientIP attaches the client's IP address
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIPFromContext returns the client's IP address, if one was attached
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey).(string)
+	return ip, ok
+}
+
+// WithPhaseTimings attaches the timings later phases record into
+func WithPhaseTimings(ctx context.Context, timings *models.PhaseTimings) context.Context {
+	return context.WithValue(ctx, phaseTimingsKey, timings)
+}
+
+// PhaseTimingsFromContext returns the request's phase timings, or nil
+func PhaseTimingsFromContext(ctx context.Context) *models.PhaseTimings {
+	timings, _ := ctx.Value(phaseTimingsKey).(*models.PhaseTimings)
+	return timings
+}
+
+// WithRequestTag attaches the metrics tag of the request
+func WithRequestTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, requestTagKey, tag)
+}
+
+// RequestTagFromContext returns the request's metrics tag, if it has one
+func RequestTagFromContext(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(requestTagKey).(string)
+	return tag, ok
+}
+
+// WithRateLimited marks the request as already counted by the rate limiter
+func WithRateLimited(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateLimitedKey, true)
+}
+
+// RateLimited reports whether the rate limiter already counted the request
+func RateLimited(ctx context.Context) bool {
+	limited, _ := ctx.Value(rateLimitedKey).(bool)
+	return limited
+}
+
+// WithRateLimitDeferred marks the request as deferred by the rate limiter
+// until its credentials are checked
+func WithRateLimitDeferred(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateLimitDeferredKey, true)
+}
+
+// RateLimitDeferred reports whether the rate limiter deferred the request
+func RateLimitDeferred(ctx context.Context) bool {
+	deferred, _ := ctx.Value(rateLimitDeferredKey).(bool)
+	return deferred
+}
+
+// WithUser marks the request as authenticated as user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+func userFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// Authenticated reports whether a token was validated for the request, even
+// if it resolved to no user ID
+func Authenticated(ctx context.Context) bool {
+	_, ok := userFromContext(ctx)
+	return ok
+}
+
+// UserIDFromContext returns the authenticated user's ID
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	user, ok := userFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return user.ID, true
+}
+
+// RoleFromContext returns the authenticated user's role
+func RoleFromContext(ctx context.Context) (string, bool) {
+	user, ok := userFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return user.Role, true
+}
+
+// EmailFromContext returns the authenticated user's email
+func EmailFromContext(ctx context.Context) (string, bool) {
+	user, ok := userFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return user.Email, true
+}
+
+// FeatureFlagsFromContext returns the feature flags claimed for the authenticated user
+func FeatureFlagsFromContext(ctx context.Context) []string {
+	user, ok := userFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return user.Flags
+}
+
+// WithCachePrivate marks the request as carrying user-specific headers, so
+// its response must not come from or go to a shared cache
+func WithCachePrivate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cachePrivateKey, true)
+}
+
+// CachePrivate reports whether the request was marked with WithCachePrivate
+func CachePrivate(ctx context.Context) bool {
+	private, _ := ctx.Value(cachePrivateKey).(bool)
+	return private
+}
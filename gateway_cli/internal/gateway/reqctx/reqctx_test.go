@@ -0,0 +1,119 @@
+package reqctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/models"
+)
+
+func TestAccessorsWithoutValues(t *testing.T) {
+	ctx := context.Background()
+
+	if _, ok := RequestIDFromContext(ctx); ok {
+		t.Error("request ID found in an empty context")
+	}
+	if _, ok := ClientIPFromContext(ctx); ok {
+		t.Error("client IP found in an empty context")
+	}
+	if PhaseTimingsFromContext(ctx) != nil {
+		t.Error("phase timings found in an empty context")
+	}
+	if _, ok := RequestTagFromContext(ctx); ok {
+		t.Error("request tag found in an empty context")
+	}
+	if RateLimited(ctx) || RateLimitDeferred(ctx) || CachePrivate(ctx) {
+		t.Error("flag set in an empty context")
+	}
+	if Authenticated(ctx) {
+		t.Error("empty context authenticated")
+	}
+	if _, ok := UserIDFromContext(ctx); ok {
+		t.Error("user ID found in an empty context")
+	}
+	if _, ok := RoleFromContext(ctx); ok {
+		t.Error("role found in an empty context")
+	}
+	if _, ok := EmailFromContext(ctx); ok {
+		t.Error("email found in an empty context")
+	}
+	if FeatureFlagsFromContext(ctx) != nil {
+		t.Error("feature flags found in an empty context")
+	}
+}
+
+func TestAccessorsWithWrongTypedValues(t *testing.T) {
+	ctx := context.Background()
+	for _, key := range []ctxKey{requestIDKey, clientIPKey, phaseTimingsKey, requestTagKey, rateLimitedKey, rateLimitDeferredKey, userKey, cachePrivateKey} {
+		ctx = context.WithValue(ctx, key, 42)
+	}
+
+	if _, ok := RequestIDFromContext(ctx); ok {
+		t.Error("request ID read from a non-string value")
+	}
+	if _, ok := ClientIPFromContext(ctx); ok {
+		t.Error("client IP read from a non-string value")
+	}
+	if PhaseTimingsFromContext(ctx) != nil {
+		t.Error("phase timings read from a wrong-typed value")
+	}
+	if _, ok := RequestTagFromContext(ctx); ok {
+		t.Error("request tag read from a non-string value")
+	}
+	if RateLimited(ctx) || RateLimitDeferred(ctx) || CachePrivate(ctx) {
+		t.Error("flag read from a non-bool value")
+	}
+	if Authenticated(ctx) {
+		t.Error("authenticated by a wrong-typed user")
+	}
+	if _, ok := UserIDFromContext(ctx); ok {
+		t.Error("user ID read from a wrong-typed user")
+	}
+}
+
+func TestAccessorsWithNilUser(t *testing.T) {
+	ctx := WithUser(context.Background(), nil)
+
+	if Authenticated(ctx) {
+		t.Error("authenticated by a nil user")
+	}
+	if _, ok := RoleFromContext(ctx); ok {
+		t.Error("role read from a nil user")
+	}
+}
+
+func TestAccessorsIgnoreForeignKeys(t *testing.T) {
+	// Another package's string key with the same name doesn't collide
+	ctx := context.WithValue(context.Background(), "user", &models.User{ID: "intruder"})
+	if _, ok := UserIDFromContext(ctx); ok {
+		t.Error("user read from a foreign key")
+	}
+}
+
+func TestAccessorsRoundTrip(t *testing.T) {
+	user := &models.User{ID: "user-1", Email: "a@example.com", Role: "admin", Flags: []string{"beta"}}
+	ctx := WithUser(WithRequestID(WithClientIP(context.Background(), "10.0.0.1"), "req-1"), user)
+	ctx = WithRateLimited(WithCachePrivate(ctx))
+
+	if id, _ := RequestIDFromContext(ctx); id != "req-1" {
+		t.Errorf("request ID = %q", id)
+	}
+	if ip, _ := ClientIPFromContext(ctx); ip != "10.0.0.1" {
+		t.Errorf("client IP = %q", ip)
+	}
+	if id, ok := UserIDFromContext(ctx); !ok || id != "user-1" {
+		t.Errorf("user ID = %q, %v", id, ok)
+	}
+	if role, _ := RoleFromContext(ctx); role != "admin" {
+		t.Errorf("role = %q", role)
+	}
+	if email, _ := EmailFromContext(ctx); email != "a@example.com" {
+		t.Errorf("email = %q", email)
+	}
+	if flags := FeatureFlagsFromContext(ctx); len(flags) != 1 || flags[0] != "beta" {
+		t.Errorf("flags = %v", flags)
+	}
+	if !RateLimited(ctx) || !CachePrivate(ctx) || RateLimitDeferred(ctx) {
+		t.Error("flags not attached as set")
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+)
+
+var consoleLogLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// newConsoleLogger builds the structured logger for access logs. level starts at
+// the configured console level and is shared with runtime log level changes.
+func newConsoleLogger(cfg config.LoggingConfig, level *slog.LevelVar) *slog.Logger {
+	var output io.Writer = os.Stdout
+	if cfg.Output == "stderr" {
+		output = os.Stderr
+	}
+
+	level.Set(consoleLogLevels[cfg.Level])
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == config.LogFormatText {
+		return slog.New(slog.NewTextHandler(output, opts))
+	}
+	return slog.New(slog.NewJSONHandler(output, opts))
+}
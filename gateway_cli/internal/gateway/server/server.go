@@ -19,84 +19,186 @@ type Server struct {
 	router     *mux.Router
 	httpServer *http.Server
 	processor  *processors.GatewayProcessor
+	limiter    *middleware.RateLimiter
+	redis      *redis.Client
 }
 
 func New(cfg *config.Config, redisClient *redis.Client) *Server {
 	// Initialize processor with dependencies
 	processor := processors.NewGatewayProcessor(cfg, redisClient)
 
+	// Rate limit buckets survive restarts when persistence is on
+	limiter := middleware.NewRateLimiter(cfg.RateLimit)
+	if cfg.RateLimit.Persist {
+		restored, err := limiter.Restore(redisClient)
+		if err != nil {
+			redisClient.PublishLog("warn", "gateway", "Failed to restore rate limit state", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			redisClient.PublishLog("info", "gateway", "Rate limit state restored", map[string]interface{}{
+				"buckets": restored,
+			})
+		}
+	}
+
 	// Setup router
-	router := setupRouter(cfg, processor, redisClient)
+	router := setupRouter(cfg, processor, redisClient, limiter)
+
+	httpServer := &http.Server{
+		Addr:         ":" + cfg.Server.Port,
+		Handler:      router,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	// Shutdown waits for active requests, so end long-lived streams once it starts
+	httpServer.RegisterOnShutdown(processor.CloseStreams)
 
 	return &Server{
-		config:    cfg,
-		router:    router,
-		processor: processor,
-		httpServer: &http.Server{
-			Addr:         ":" + cfg.Server.Port,
-			Handler:      router,
-			ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
-			WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
-			IdleTimeout:  120 * time.Second,
-		},
+		config:     cfg,
+		router:     router,
+		processor:  processor,
+		limiter:    limiter,
+		redis:      redisClient,
+		httpServer: httpServer,
 	}
 }
 
 func (s *Server) Start() error {
+	// Register services before the background checkers read the registry
+	s.processor.Start()
+
 	// Start background services
 	go s.processor.StartHealthChecker()
 	go s.processor.StartMetricsCollector()
+	go s.processor.WatchServiceDiscovery()
 
 	return s.httpServer.ListenAndServe()
 }
 
+// Reload applies a new configuration to the running gateway, keeping the
+// current one if the new config fails validation
+func (s *Server) Reload(cfg *config.Config) error {
+	return s.processor.ReloadConfig(cfg)
+}
+
+// Shutdown stops accepting connections, drains in-flight proxy requests and
+// then stops the background workers
 func (s *Server) Shutdown(ctx context.Context) error {
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.httpServer.Shutdown(ctx)
+	}()
+
+	drainErr := s.processor.Drain(ctx)
+	err := <-shutdownErr
+	if err == nil {
+		err = drainErr
+	}
 	s.processor.Stop()
-	return s.httpServer.Shutdown(ctx)
+
+	if s.config.RateLimit.Persist {
+		if snapErr := s.limiter.Snapshot(s.redis); snapErr != nil {
+			s.redis.PublishLog("warn", "gateway", "Failed to save rate limit state", map[string]interface{}{
+				"error": snapErr.Error(),
+			})
+		}
+	}
+
+	return err
 }
 
-func setupRouter(cfg *config.Config, processor *processors.GatewayProcessor, redisClient *redis.Client) *mux.Router {
+func setupRouter(cfg *config.Config, processor *processors.GatewayProcessor, redisClient *redis.Client, limiter *middleware.RateLimiter) *mux.Router {
 	r := mux.NewRouter()
 
 	// Global middleware chain
-	r.Use(middleware.Logger(redisClient))
-	r.Use(middleware.Recovery())
-	r.Use(middleware.CORS())
-	r.Use(middleware.RequestID())
-	r.Use(middleware.RateLimit(cfg.RateLimit))
+	r.Use(middleware.Timing())
+	r.Use(middleware.Logger(redisClient, newConsoleLogger(cfg.Logging, redisClient.ConsoleLevel())))
+	r.Use(middleware.Recovery(redisClient))
+	r.Use(middleware.CORS(cfg.CORS))
+	r.Use(middleware.RequestID(cfg.Server.RequestIDMode))
+	r.Use(middleware.UpstreamOverride(cfg.Server.UpstreamOverrideCIDRs))
+	r.Use(middleware.RateLimit(limiter))
+	r.Use(middleware.RequestTag(cfg.Metrics))
 
 	// Initialize handlers
-	gatewayHandler := handlers.NewGatewayHandler(processor)
-	healthHandler := handlers.NewHealthHandler(processor)
+	gatewayHandler := handlers.NewGatewayHandler(cfg, processor)
+	authResponses := middleware.NewAuthResponses(redisClient, cfg.Auth)
+	healthHandler := handlers.NewHealthHandler(processor, authResponses.Stats)
 	metricsHandler := handlers.NewMetricsHandler(processor)
+	logLevelHandler := handlers.NewLogLevelHandler(processor)
+
+	// Preflights match here before method-restricted routes would answer 405,
+	// so the CORS middleware handles them. Other OPTIONS requests are proxied.
+	r.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		return middleware.IsPreflight(r)
+	}).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Kubernetes probes, outside the authenticated API
+	r.HandleFunc("/livez", healthHandler.Livez).Methods("GET", "HEAD")
+	r.HandleFunc("/readyz", healthHandler.Readyz).Methods("GET", "HEAD")
 
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
 
-	// Public endpoints
-	api.HandleFunc("/health", healthHandler.Health).Methods("GET")
-	api.HandleFunc("/health/{service}", healthHandler.ServiceHealth).Methods("GET")
-	api.HandleFunc("/services", gatewayHandler.ListServices).Methods("GET")
+	// Public endpoints. Requests deferred by the global rate limit pass for
+	// carrying credentials are counted per IP here, as nothing authenticates them.
+	public := api.NewRoute().Subrouter()
+	public.Use(middleware.RateLimit(limiter))
+	public.HandleFunc("/health", healthHandler.Health).Methods("GET")
+	public.HandleFunc("/health/{service}", healthHandler.ServiceHealth).Methods("GET")
+	public.HandleFunc("/health/{service}/history", healthHandler.ServiceHealthHistory).Methods("GET")
+	public.HandleFunc("/services", gatewayHandler.ListServices).Methods("GET")
+
+	// Public direct service routes, registered before the protected subrouter matches
+	for _, route := range cfg.Routes.Direct {
+		if route.Public {
+			public.HandleFunc(route.Path, gatewayHandler.ProxyRoute(route)).Methods(route.Methods...)
+		}
+	}
 
 	// Protected endpoints
 	protected := api.PathPrefix("").Subrouter()
-	protected.Use(middleware.Auth(cfg.Auth))
+	protected.Use(middleware.Auth(redisClient, authResponses, cfg.Auth))
+	protected.Use(middleware.RateLimit(limiter))
 
-	// Proxy routes - catch all for service forwarding
-	protected.PathPrefix("/proxy/{service}").HandlerFunc(gatewayHandler.Proxy)
+	// Proxied services and paths may be limited to certain roles
+	serviceAccess := func(service string) func(http.Handler) http.Handler {
+		return middleware.ServiceAccess(cfg.Auth, processor.RequiredRoles, service)
+	}
+
+	// Proxy routes - catch all for service forwarding, any method
+	protected.PathPrefix("/proxy/{service}").Handler(serviceAccess("")(http.HandlerFunc(gatewayHandler.Proxy)))
 
 	// Direct service routes (more RESTful)
-	protected.HandleFunc("/devices", gatewayHandler.ProxyToService("device-registry")).Methods("GET", "POST")
-	protected.HandleFunc("/devices/{id}", gatewayHandler.ProxyToService("device-registry")).Methods("GET", "PUT", "DELETE")
-	protected.HandleFunc("/auth/login", gatewayHandler.ProxyToService("auth")).Methods("POST")
-	protected.HandleFunc("/auth/refresh", gatewayHandler.ProxyToService("auth")).Methods("POST")
+	for _, route := range cfg.Routes.Direct {
+		if !route.Public {
+			protected.Handle(route.Path, serviceAccess(route.Service)(gatewayHandler.ProxyRoute(route))).Methods(route.Methods...)
+		}
+	}
+
+	// Aggregate fan-out routes
+	for _, route := range cfg.Routes.Aggregates {
+		protected.HandleFunc(route.Path, gatewayHandler.Aggregate(route)).Methods("GET")
+	}
 
 	// Admin endpoints
 	admin := protected.PathPrefix("/admin").Subrouter()
 	admin.Use(middleware.RequireRole("admin"))
 	admin.HandleFunc("/metrics", metricsHandler.GetMetrics).Methods("GET")
+	admin.HandleFunc("/metrics/reset", metricsHandler.ResetMetrics).Methods("POST")
+	admin.HandleFunc("/metrics/{service}", metricsHandler.ServiceMetric).Methods("GET")
+	admin.HandleFunc("/loglevel", logLevelHandler.GetLogLevel).Methods("GET")
+	admin.HandleFunc("/loglevel", logLevelHandler.SetLogLevel).Methods("POST")
+	admin.HandleFunc("/services", gatewayHandler.RegisterService).Methods("POST")
+	admin.HandleFunc("/services/reload", gatewayHandler.ReloadServices).Methods("POST")
+	admin.HandleFunc("/services/{service}", gatewayHandler.DeregisterService).Methods("DELETE")
 	admin.HandleFunc("/services/{service}/health", gatewayHandler.CheckServiceHealth).Methods("POST")
 	admin.HandleFunc("/services/{service}/restart", gatewayHandler.RestartService).Methods("POST")
+	admin.HandleFunc("/services/{service}/test", gatewayHandler.TestService).Methods("POST")
 
 	return r
 }
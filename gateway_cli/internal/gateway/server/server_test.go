@@ -0,0 +1,309 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/config"
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/redis"
+)
+
+// newTestServer serves the full router on a local port, with the "devices"
+// service at upstream behind a public GET /api/events route and a protected
+// /api/devices route. setup, if set, adjusts the default config first.
+// Returns the gateway's base URL.
+func newTestServer(t *testing.T, upstream string, setup func(*config.Config)) (*Server, string) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.Redis.URL = "redis://" + mr.Addr()
+	cfg.Services.Discovery = config.DiscoveryStatic
+	cfg.Services.Registry = map[string]config.ServiceInfo{
+		"devices": config.NewServiceInfo("devices", upstream, "", 5),
+	}
+	cfg.Routes.Direct = []config.DirectRoute{
+		{Methods: []string{http.MethodGet}, Path: "/events", Service: "devices", Public: true},
+		{Methods: []string{http.MethodGet, http.MethodPost}, Path: "/devices", Service: "devices"},
+	}
+	if setup != nil {
+		setup(cfg)
+	}
+
+	redisClient, err := redis.NewClient(cfg.Redis)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { redisClient.Close() })
+
+	s := New(cfg, redisClient)
+	s.processor.Start()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go s.httpServer.Serve(listener)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+
+	return s, "http://" + listener.Addr().String()
+}
+
+func TestShutdownClosesActiveStreams(t *testing.T) {
+	cancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: connected\n\n"))
+		w.(http.Flusher).Flush()
+
+		// The stream stays open until the gateway goes away
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer upstream.Close()
+
+	s, gateway := newTestServer(t, upstream.URL, nil)
+	resp, err := http.Get(gateway + "/api/events")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "data: connected\n" {
+		t.Fatalf("first event = %q, err = %v", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("shutdown took %v with an open stream, want it closed promptly", elapsed)
+	}
+
+	// The client sees the stream end, and the upstream request was cancelled
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("stream did not end cleanly: %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream stream was not cancelled")
+	}
+}
+
+func TestPreflightToProtectedRouteSkipsAuth(t *testing.T) {
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	_, gateway := newTestServer(t, upstream.URL, nil)
+
+	for _, path := range []string{"/api/devices", "/api/proxy/devices/devices"} {
+		req, _ := http.NewRequest(http.MethodOptions, gateway+path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("preflight %s: %v", path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode >= 300 {
+			t.Fatalf("preflight %s status = %d, want it answered without credentials", path, resp.StatusCode)
+		}
+		if resp.Header.Get("Access-Control-Allow-Origin") == "" || resp.Header.Get("Access-Control-Allow-Methods") == "" {
+			t.Fatalf("preflight %s lacks CORS headers: %v", path, resp.Header)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("upstream received %d preflights, want the gateway to answer them", calls.Load())
+	}
+
+	// The route itself still requires credentials
+	resp, err := http.Post(gateway+"/api/devices", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated POST status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestBackendReceivesMiddlewareRequestID(t *testing.T) {
+	var received atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Get("X-Request-ID"))
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	_, gateway := newTestServer(t, upstream.URL, nil)
+
+	for name, clientID := range map[string]string{"generated": "", "client supplied": "trace-42"} {
+		req, _ := http.NewRequest(http.MethodGet, gateway+"/api/events", nil)
+		if clientID != "" {
+			req.Header.Set("X-Request-ID", clientID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request: %v", name, err)
+		}
+		resp.Body.Close()
+
+		responseID := resp.Header.Get("X-Request-ID")
+		if responseID == "" || (clientID != "" && responseID != clientID) {
+			t.Fatalf("%s: response X-Request-ID = %q", name, responseID)
+		}
+		if got, _ := received.Load().(string); got != responseID {
+			t.Fatalf("%s: backend got X-Request-ID %q, want the middleware's %q", name, got, responseID)
+		}
+	}
+}
+
+// echoUpstream answers with the method, path, query and body it received
+func echoUpstream(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"path":   r.URL.EscapedPath(),
+			"query":  r.URL.RawQuery,
+			"body":   string(body),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// doJSON sends a request and decodes an echoUpstream answer
+func doJSON(t *testing.T, method, url, body string) (int, map[string]string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	var echoed map[string]string
+	json.NewDecoder(resp.Body).Decode(&echoed)
+	return resp.StatusCode, echoed
+}
+
+func TestPatchIsProxiedEndToEnd(t *testing.T) {
+	upstream := echoUpstream(t)
+	_, gateway := newTestServer(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Routes.Direct = []config.DirectRoute{
+			{Methods: []string{http.MethodPatch}, Path: "/devices/{id}", Service: "devices", Public: true},
+		}
+	})
+
+	status, echoed := doJSON(t, http.MethodPatch, gateway+"/api/devices/lamp-1", `{"brightness":40}`)
+	if status != http.StatusOK {
+		t.Fatalf("PATCH status = %d, want 200", status)
+	}
+	if echoed["method"] != http.MethodPatch || echoed["path"] != "/devices/lamp-1" || echoed["body"] != `{"brightness":40}` {
+		t.Fatalf("upstream got %v, want the PATCH with its body", echoed)
+	}
+}
+
+func TestDirectRouteRewritesUpstreamPath(t *testing.T) {
+	upstream := echoUpstream(t)
+	_, gateway := newTestServer(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Routes.Direct = []config.DirectRoute{
+			{Methods: []string{http.MethodPost}, Path: "/auth/login", Service: "devices", TargetPath: "/login", Public: true},
+			{Methods: []string{http.MethodGet}, Path: "/homes/{home}/devices/{id}", Service: "devices", TargetPath: "/v2/devices/{id}/home/{home}", Public: true},
+		}
+	})
+
+	status, echoed := doJSON(t, http.MethodPost, gateway+"/api/auth/login", `{"user":"a"}`)
+	if status != http.StatusOK || echoed["method"] != http.MethodPost || echoed["path"] != "/login" || echoed["body"] != `{"user":"a"}` {
+		t.Fatalf("login: status %d, upstream got %v, want POST /login", status, echoed)
+	}
+
+	status, echoed = doJSON(t, http.MethodGet, gateway+"/api/homes/main/devices/lamp%201?fields=state", "")
+	if status != http.StatusOK || echoed["method"] != http.MethodGet || echoed["path"] != "/v2/devices/lamp%201/home/main" || echoed["query"] != "fields=state" {
+		t.Fatalf("device: status %d, upstream got %v, want GET /v2/devices/lamp%%201/home/main?fields=state", status, echoed)
+	}
+
+	// Only the route's methods are proxied
+	if status, echoed := doJSON(t, http.MethodGet, gateway+"/api/auth/login", ""); status == http.StatusOK || echoed["path"] != "" {
+		t.Fatalf("GET on a POST route: status %d, upstream got %v, want it not proxied", status, echoed)
+	}
+}
+
+func TestRequestTagMetrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	s, gateway := newTestServer(t, upstream.URL, func(cfg *config.Config) {
+		cfg.Metrics.TagHeader = "X-Client-Kind"
+		cfg.Metrics.Tags = map[string]string{"ios": "mobile", "android": "mobile", "browser": "web"}
+	})
+
+	for _, request := range []struct{ kind, query string }{
+		{"ios", ""},
+		{"android", "?fail=1"},
+		{"browser", ""},
+		{"fridge", ""},
+		{"toaster", "?fail=1"},
+		{"", ""},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, gateway+"/api/events"+request.query, nil)
+		if request.kind != "" {
+			req.Header.Set("X-Client-Kind", request.kind)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request tagged %q: %v", request.kind, err)
+		}
+		resp.Body.Close()
+	}
+
+	tags := s.processor.GetMetrics().TagMetrics
+	want := map[string][2]int64{"mobile": {2, 1}, "web": {1, 0}, "other": {2, 1}}
+	if len(tags) != len(want) {
+		t.Fatalf("tag metrics = %v, want only %v", tags, want)
+	}
+	for tag, counts := range want {
+		got := tags[tag]
+		if got == nil || got.TotalRequests != counts[0] || got.ErrorRequests != counts[1] {
+			t.Errorf("tag %s = %+v, want %d requests with %d errors", tag, got, counts[0], counts[1])
+		}
+	}
+}
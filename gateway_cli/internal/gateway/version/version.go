@@ -0,0 +1,22 @@
+// Package version holds build information set at link time, e.g.
+//
+//	go build -ldflags "-X github.com/quirck3n/smart-home/gateway_cli/internal/gateway/version.Version=v1.2.0"
+package version
+
+var (
+	// Version is the release the gateway was built from
+	Version = "dev"
+	// Commit is the git commit the gateway was built from
+	Commit = "unknown"
+	// BuildTime is when the gateway was built, in RFC 3339
+	BuildTime = "unknown"
+)
+
+// Info returns the build information for status responses
+func Info() map[string]string {
+	return map[string]string{
+		"version":    Version,
+		"commit":     Commit,
+		"build_time": BuildTime,
+	}
+}
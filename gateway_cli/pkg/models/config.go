@@ -4,4 +4,20 @@ type RedisConfig struct {
 	URL      string
 	Password string
 	DB       int
+
+	// Stream names
+	LogsStream          string
+	AccessLogStream     string
+	MetricsStream       string
+	AuthRequestsStream  string
+	AuthResponsesStream string
+	// StreamMaxLen caps the streams the gateway writes to, trimmed approximately; 0 = unbounded
+	StreamMaxLen int64
+
+	// Minimum level published to the logs stream: debug, info, warn, error
+	LogLevel string
+
+	// Secondary Redis for logs and metrics while the primary is down
+	FallbackURL          string
+	FallbackRetrySeconds int
 }
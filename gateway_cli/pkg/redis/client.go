@@ -13,6 +13,15 @@ import (
 
 type Client struct {
 	*redis.Client
+	logsStream      string
+	accessLogStream string
+	metricsStream   string
+	authRequests    string
+	authResponses   string
+	maxLen          int64
+	levels          *logLevelState
+	// fallback receives telemetry while the primary is down; auth stays on the primary
+	fallback *telemetryFallback
 }
 
 func NewClient(cfg models.RedisConfig) (*Client, error) {
@@ -40,21 +49,105 @@ func NewClient(cfg models.RedisConfig) (*Client, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &Client{Client: client}, nil
+	var fallback *telemetryFallback
+	if cfg.FallbackURL != "" {
+		fallback, err = newTelemetryFallback(cfg.FallbackURL, time.Duration(cfg.FallbackRetrySeconds)*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fallback Redis URL: %w", err)
+		}
+	}
+
+	return &Client{
+		Client:          client,
+		logsStream:      streamName(cfg.LogsStream, "logs-stream"),
+		accessLogStream: streamName(cfg.AccessLogStream, "access-log-stream"),
+		metricsStream:   streamName(cfg.MetricsStream, "metrics-stream"),
+		authRequests:    streamName(cfg.AuthRequestsStream, "auth-requests"),
+		authResponses:   streamName(cfg.AuthResponsesStream, "auth-responses"),
+		maxLen:          cfg.StreamMaxLen,
+		levels:          newLogLevelState(cfg.LogLevel),
+		fallback:        fallback,
+	}, nil
+}
+
+func streamName(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// AuthRequestsStream is the stream token validation requests are sent to
+func (c *Client) AuthRequestsStream() string {
+	return c.authRequests
+}
+
+// AuthResponsesStream is the stream the auth service answers on
+func (c *Client) AuthResponsesStream() string {
+	return c.authResponses
+}
+
+// StreamEntry builds the XAdd arguments for an entry, trimming the stream to
+// about the configured max length
+func (c *Client) StreamEntry(stream string, values map[string]interface{}) *redis.XAddArgs {
+	args := &redis.XAddArgs{
+		Stream: stream,
+		Values: values,
+	}
+	if c.maxLen > 0 {
+		args.MaxLen = c.maxLen
+		args.Approx = true
+	}
+	return args
 }
 
 func (c *Client) PublishEvent(stream string, data map[string]interface{}) error {
 	ctx := context.Background()
+	args := c.StreamEntry(stream, data)
 
-	_, err := c.XAdd(ctx, &redis.XAddArgs{
-		Stream: stream,
-		Values: data,
-	}).Result()
+	if c.fallback == nil {
+		return c.XAdd(ctx, args).Err()
+	}
+
+	if !c.fallback.usePrimary() {
+		return c.publishFallback(ctx, args)
+	}
 
-	return err
+	err := c.XAdd(ctx, args).Err()
+	if c.fallback.primaryResult(err) {
+		// Announce the switch on whichever Redis is taking the telemetry
+		state := map[string]interface{}{
+			"level":     "warn",
+			"service":   "gateway",
+			"message":   "Primary Redis unavailable, publishing telemetry to fallback",
+			"timestamp": time.Now().Unix(),
+		}
+		if err == nil {
+			state["level"] = "info"
+			state["message"] = "Primary Redis recovered, publishing telemetry to primary"
+			c.XAdd(ctx, c.StreamEntry(c.logsStream, state))
+		} else {
+			state["error"] = err.Error()
+			c.publishFallback(ctx, c.StreamEntry(c.logsStream, state))
+		}
+	}
+	if err != nil {
+		return c.publishFallback(ctx, args)
+	}
+	return nil
 }
 
+// PublishLog writes to the logs stream, dropping messages below the effective
+// log level. A "service" field in extra selects that service's level override.
 func (c *Client) PublishLog(level, service, message string, extra map[string]interface{}) error {
+	levelScope := service
+	if target, ok := extra["service"].(string); ok {
+		levelScope = target
+	}
+	if !c.levels.enabled(level, levelScope) {
+		return nil
+	}
+
 	logData := map[string]interface{}{
 		"level":     level,
 		"service":   service,
@@ -67,7 +160,25 @@ func (c *Client) PublishLog(level, service, message string, extra map[string]int
 		logData[k] = v
 	}
 
-	return c.PublishEvent("logs-stream", logData)
+	return c.PublishEvent(c.logsStream, logData)
+}
+
+// PublishAccessLog writes a per-request access entry to the access-log stream,
+// keeping the application log stream free of request noise
+func (c *Client) PublishAccessLog(message string, extra map[string]interface{}) error {
+	logData := map[string]interface{}{
+		"level":     "info",
+		"service":   "gateway",
+		"message":   message,
+		"timestamp": time.Now().Unix(),
+	}
+
+	// Add extra fields
+	for k, v := range extra {
+		logData[k] = v
+	}
+
+	return c.PublishEvent(c.accessLogStream, logData)
 }
 
 func (c *Client) PublishMetrics(eventType, service string, metrics map[string]interface{}) error {
@@ -82,7 +193,7 @@ func (c *Client) PublishMetrics(eventType, service string, metrics map[string]in
 		metricsData[k] = v
 	}
 
-	return c.PublishEvent("metrics-stream", metricsData)
+	return c.PublishEvent(c.metricsStream, metricsData)
 }
 
 func parseRedisURL(redisURL string) (*redis.Options, error) {
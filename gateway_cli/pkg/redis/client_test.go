@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/models"
+)
+
+// newTestClient connects a client to a fresh miniredis
+func newTestClient(t *testing.T, cfg models.RedisConfig) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cfg.URL = "redis://" + mr.Addr()
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+func TestStreamEntryCapsStreams(t *testing.T) {
+	client, mr := newTestClient(t, models.RedisConfig{StreamMaxLen: 10})
+
+	args := client.StreamEntry("metrics-stream", map[string]interface{}{"type": "test"})
+	if args.MaxLen != 10 || !args.Approx {
+		t.Fatalf("XAdd args MaxLen = %d, Approx = %v, want 10 and approximate", args.MaxLen, args.Approx)
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := client.PublishMetrics("test", "gateway", map[string]interface{}{"i": i}); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+	entries, err := mr.Stream("metrics-stream")
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if len(entries) > 10 {
+		t.Fatalf("metrics stream holds %d entries, want at most 10", len(entries))
+	}
+}
+
+func TestStreamEntryUnboundedWithoutMaxLen(t *testing.T) {
+	client, _ := newTestClient(t, models.RedisConfig{})
+
+	args := client.StreamEntry("metrics-stream", map[string]interface{}{"type": "test"})
+	if args.MaxLen != 0 || args.Approx {
+		t.Fatalf("XAdd args MaxLen = %d, Approx = %v, want no trimming", args.MaxLen, args.Approx)
+	}
+}
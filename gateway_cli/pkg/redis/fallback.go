@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// telemetryFallback routes stream writes to a secondary Redis while the
+// primary is failing. The primary is retried at most once per retry interval
+// and takes over again as soon as a write to it succeeds.
+type telemetryFallback struct {
+	client  *redis.Client
+	retry   time.Duration
+	mu      sync.Mutex
+	down    bool
+	retryAt time.Time
+}
+
+func newTelemetryFallback(fallbackURL string, retry time.Duration) (*telemetryFallback, error) {
+	options, err := parseRedisURL(fallbackURL)
+	if err != nil {
+		return nil, err
+	}
+	if retry <= 0 {
+		retry = 10 * time.Second
+	}
+
+	// Not pinged: the fallback only has to be reachable once the primary fails
+	return &telemetryFallback{
+		client: redis.NewClient(options),
+		retry:  retry,
+	}, nil
+}
+
+// usePrimary reports whether the next write should go to the primary
+func (f *telemetryFallback) usePrimary() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.down || time.Now().Before(f.retryAt) {
+		return !f.down
+	}
+	f.retryAt = time.Now().Add(f.retry)
+	return true
+}
+
+// primaryResult records the outcome of a write to the primary, returning true
+// if the primary's state changed
+func (f *telemetryFallback) primaryResult(err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	down := err != nil
+	if down {
+		f.retryAt = time.Now().Add(f.retry)
+	}
+	changed := down != f.down
+	f.down = down
+	return changed
+}
+
+// FallbackActive reports whether telemetry is currently written to the secondary Redis
+func (c *Client) FallbackActive() bool {
+	if c.fallback == nil {
+		return false
+	}
+	c.fallback.mu.Lock()
+	defer c.fallback.mu.Unlock()
+	return c.fallback.down
+}
+
+func (c *Client) publishFallback(ctx context.Context, args *redis.XAddArgs) error {
+	return c.fallback.client.XAdd(ctx, args).Err()
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/quirck3n/smart-home/gateway_cli/pkg/models"
+)
+
+// streamMessages returns the "message" field of each entry in stream
+func streamMessages(t *testing.T, mr *miniredis.Miniredis, stream string) []string {
+	t.Helper()
+	if !mr.Exists(stream) {
+		return nil
+	}
+	entries, err := mr.Stream(stream)
+	if err != nil {
+		t.Fatalf("read %s: %v", stream, err)
+	}
+	var messages []string
+	for _, entry := range entries {
+		for i := 0; i+1 < len(entry.Values); i += 2 {
+			if entry.Values[i] == "message" {
+				messages = append(messages, entry.Values[i+1])
+			}
+		}
+	}
+	return messages
+}
+
+func TestPrimaryFailureSendsTelemetryToFallback(t *testing.T) {
+	secondary := miniredis.RunT(t)
+	client, primary := newTestClient(t, models.RedisConfig{
+		FallbackURL:          "redis://" + secondary.Addr(),
+		FallbackRetrySeconds: 60,
+	})
+
+	if err := client.PublishLog("info", "gateway", "before outage", nil); err != nil {
+		t.Fatalf("publish to primary: %v", err)
+	}
+	if client.FallbackActive() {
+		t.Fatal("fallback active while the primary is up")
+	}
+
+	primary.Close()
+	if err := client.PublishLog("info", "gateway", "during outage", nil); err != nil {
+		t.Fatalf("publish during outage: %v", err)
+	}
+	if err := client.PublishMetrics("request", "gateway", map[string]interface{}{"status": 200}); err != nil {
+		t.Fatalf("publish metrics during outage: %v", err)
+	}
+	if !client.FallbackActive() {
+		t.Fatal("fallback not active after a primary failure")
+	}
+
+	logs := streamMessages(t, secondary, "logs-stream")
+	want := []string{"Primary Redis unavailable, publishing telemetry to fallback", "during outage"}
+	if len(logs) != len(want) || logs[0] != want[0] || logs[1] != want[1] {
+		t.Fatalf("fallback logs = %q, want %q", logs, want)
+	}
+	if !secondary.Exists("metrics-stream") {
+		t.Fatal("metrics not sent to the fallback")
+	}
+
+	// Back on the primary once it answers again after the retry interval
+	if err := primary.Restart(); err != nil {
+		t.Fatalf("restart primary: %v", err)
+	}
+	client.fallback.mu.Lock()
+	client.fallback.retryAt = time.Now()
+	client.fallback.mu.Unlock()
+
+	if err := client.PublishLog("info", "gateway", "after outage", nil); err != nil {
+		t.Fatalf("publish after outage: %v", err)
+	}
+	if client.FallbackActive() {
+		t.Fatal("fallback still active after the primary recovered")
+	}
+	logs = streamMessages(t, primary, "logs-stream")
+	if !slices.Contains(logs, "after outage") || !slices.Contains(logs, "Primary Redis recovered, publishing telemetry to primary") {
+		t.Fatalf("primary logs after recovery = %q", logs)
+	}
+}
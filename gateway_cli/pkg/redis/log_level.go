@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Log levels in increasing severity
+var logLevels = map[string]int32{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+var logLevelNames = map[int32]string{0: "debug", 1: "info", 2: "warn", 3: "error"}
+
+var slogLevels = map[int32]slog.Level{0: slog.LevelDebug, 1: slog.LevelInfo, 2: slog.LevelWarn, 3: slog.LevelError}
+
+// logLevelState holds the minimum level published to the logs stream, globally
+// and per service. Levels can be changed at runtime and revert after a TTL.
+type logLevelState struct {
+	global    atomic.Int32
+	mu        sync.RWMutex
+	overrides map[string]int32
+	// generation invalidates pending reverts when a scope is set again
+	generation map[string]uint64
+	// baselines holds, per scope with a temporary level, the level from before
+	// the first of its stacked temporary changes
+	baselines map[string]levelBaseline
+	// console is the console logger's level, following global changes
+	console slog.LevelVar
+}
+
+// levelBaseline is the level a scope reverts to once its temporary change expires
+type levelBaseline struct {
+	level   int32
+	console slog.Level
+	// set is false for a service that had no override of its own
+	set bool
+}
+
+func newLogLevelState(level string) *logLevelState {
+	state := &logLevelState{
+		overrides:  make(map[string]int32),
+		generation: make(map[string]uint64),
+		baselines:  make(map[string]levelBaseline),
+	}
+	value, ok := logLevels[level]
+	if !ok {
+		value = logLevels["info"]
+	}
+	state.global.Store(value)
+	state.console.Set(slogLevels[value])
+	return state
+}
+
+// enabled reports whether a message at level should be published for service
+func (s *logLevelState) enabled(level, service string) bool {
+	value, ok := logLevels[level]
+	if !ok {
+		return true
+	}
+
+	minLevel := s.global.Load()
+	if service != "" {
+		s.mu.RLock()
+		if override, exists := s.overrides[service]; exists {
+			minLevel = override
+		}
+		s.mu.RUnlock()
+	}
+	return value >= minLevel
+}
+
+// SetLogLevel changes the minimum published log level, for all logs or only for
+// service if set. With a positive ttl the level from before any temporary
+// change of the scope is restored afterwards, so stacked temporary changes
+// never leave one of them behind; a change without ttl becomes the new baseline.
+func (c *Client) SetLogLevel(level, service string, ttl time.Duration) error {
+	value, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	s := c.levels
+	s.mu.Lock()
+	s.generation[service]++
+	generation := s.generation[service]
+
+	previous := levelBaseline{set: true}
+	if service == "" {
+		previous.level = s.global.Swap(value)
+		previous.console = s.console.Level()
+		s.console.Set(slogLevels[value])
+	} else {
+		previous.level, previous.set = s.overrides[service]
+		s.overrides[service] = value
+	}
+
+	if ttl <= 0 {
+		delete(s.baselines, service)
+	} else if _, stacked := s.baselines[service]; !stacked {
+		s.baselines[service] = previous
+	}
+	s.mu.Unlock()
+
+	if ttl > 0 {
+		time.AfterFunc(ttl, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.generation[service] != generation {
+				// Set again since; the newer change owns the revert
+				return
+			}
+			baseline := s.baselines[service]
+			delete(s.baselines, service)
+			switch {
+			case service == "":
+				s.global.Store(baseline.level)
+				s.console.Set(baseline.console)
+			case baseline.set:
+				s.overrides[service] = baseline.level
+			default:
+				delete(s.overrides, service)
+			}
+		})
+	}
+
+	return nil
+}
+
+// ConsoleLevel is the level shared with the console logger. Global SetLogLevel
+// changes apply to it and revert with the published level.
+func (c *Client) ConsoleLevel() *slog.LevelVar {
+	return &c.levels.console
+}
+
+// LogLevels returns the global log level and any per-service overrides
+func (c *Client) LogLevels() (string, map[string]string) {
+	s := c.levels
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	overrides := make(map[string]string, len(s.overrides))
+	for service, value := range s.overrides {
+		overrides[service] = logLevelNames[value]
+	}
+	return logLevelNames[s.global.Load()], overrides
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestGlobalLogLevelChangeAppliesToConsole(t *testing.T) {
+	c := &Client{levels: newLogLevelState("info")}
+	console := c.ConsoleLevel()
+	console.Set(slog.LevelWarn)
+
+	if err := c.SetLogLevel("debug", "", 50*time.Millisecond); err != nil {
+		t.Fatalf("set log level: %v", err)
+	}
+	if got := console.Level(); got != slog.LevelDebug {
+		t.Fatalf("console level = %v, want %v", got, slog.LevelDebug)
+	}
+
+	if err := c.SetLogLevel("error", "devices", 0); err != nil {
+		t.Fatalf("set service log level: %v", err)
+	}
+	if got := console.Level(); got != slog.LevelDebug {
+		t.Fatalf("service override changed console level to %v", got)
+	}
+
+	waitFor(t, func() bool { return console.Level() == slog.LevelWarn })
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLogLevelRevertsAfterTTL(t *testing.T) {
+	c := &Client{levels: newLogLevelState("info")}
+
+	if err := c.SetLogLevel("debug", "", 50*time.Millisecond); err != nil {
+		t.Fatalf("set global level: %v", err)
+	}
+	if err := c.SetLogLevel("error", "devices", 50*time.Millisecond); err != nil {
+		t.Fatalf("set service level: %v", err)
+	}
+
+	if !c.levels.enabled("debug", "") {
+		t.Fatal("debug not published after lowering the global level")
+	}
+	if c.levels.enabled("warn", "devices") {
+		t.Fatal("warn published for a service raised to error")
+	}
+	if global, overrides := c.LogLevels(); global != "debug" || overrides["devices"] != "error" {
+		t.Fatalf("levels = %s %v, want debug with devices=error", global, overrides)
+	}
+
+	waitFor(t, func() bool {
+		global, overrides := c.LogLevels()
+		return global == "info" && len(overrides) == 0
+	})
+	if c.levels.enabled("debug", "") {
+		t.Fatal("debug still published after the TTL")
+	}
+	if !c.levels.enabled("warn", "devices") {
+		t.Fatal("service override still applied after the TTL")
+	}
+}
+
+func TestLogLevelSetAgainOwnsTheRevert(t *testing.T) {
+	c := &Client{levels: newLogLevelState("info")}
+
+	if err := c.SetLogLevel("debug", "", 20*time.Millisecond); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	if err := c.SetLogLevel("warn", "", 0); err != nil {
+		t.Fatalf("set level again: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if global, _ := c.LogLevels(); global != "warn" {
+		t.Fatalf("global level = %s after the first TTL, want warn", global)
+	}
+}
+
+func TestStackedTemporaryLevelsRevertToBaseline(t *testing.T) {
+	c := &Client{levels: newLogLevelState("info")}
+	console := c.ConsoleLevel()
+
+	// debug for longer, then error for shorter: once the shorter one expires
+	// the level must not fall back to debug for good
+	if err := c.SetLogLevel("debug", "", 80*time.Millisecond); err != nil {
+		t.Fatalf("set debug: %v", err)
+	}
+	if err := c.SetLogLevel("error", "", 30*time.Millisecond); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	if err := c.SetLogLevel("debug", "devices", 80*time.Millisecond); err != nil {
+		t.Fatalf("set service debug: %v", err)
+	}
+	if err := c.SetLogLevel("warn", "devices", 30*time.Millisecond); err != nil {
+		t.Fatalf("set service warn: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		global, overrides := c.LogLevels()
+		return global == "info" && len(overrides) == 0
+	})
+	if console.Level() != slog.LevelInfo {
+		t.Fatalf("console level = %v, want the baseline info", console.Level())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if global, overrides := c.LogLevels(); global != "info" || len(overrides) != 0 {
+		t.Fatalf("levels = %s %v after every TTL, want the baseline info without overrides", global, overrides)
+	}
+}
+
+func TestPermanentLevelBecomesBaseline(t *testing.T) {
+	c := &Client{levels: newLogLevelState("info")}
+
+	if err := c.SetLogLevel("debug", "", 30*time.Millisecond); err != nil {
+		t.Fatalf("set debug: %v", err)
+	}
+	if err := c.SetLogLevel("warn", "", 0); err != nil {
+		t.Fatalf("set warn: %v", err)
+	}
+	if err := c.SetLogLevel("error", "", 30*time.Millisecond); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		global, _ := c.LogLevels()
+		return global == "warn"
+	})
+}
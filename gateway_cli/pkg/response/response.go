@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"github.com/quirck3n/smart-home/gateway_cli/internal/gateway/reqctx"
 )
 
 type Response struct {
@@ -11,6 +13,7 @@ type Response struct {
 	Message   string      `json:"message"`
 	Data      interface{} `json:"data,omitempty"`
 	Error     *ErrorInfo  `json:"error,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
 	Timestamp int64       `json:"timestamp"`
 }
 
@@ -19,7 +22,7 @@ type ErrorInfo struct {
 	Details interface{} `json:"details,omitempty"`
 }
 
-func Success(w http.ResponseWriter, message string, data interface{}) {
+func Success(w http.ResponseWriter, r *http.Request, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
@@ -27,13 +30,14 @@ func Success(w http.ResponseWriter, message string, data interface{}) {
 		Success:   true,
 		Message:   message,
 		Data:      data,
+		RequestID: requestID(r),
 		Timestamp: time.Now().Unix(),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-func Error(w http.ResponseWriter, statusCode int, message string, details interface{}) {
+func Error(w http.ResponseWriter, r *http.Request, statusCode int, message string, details interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
@@ -44,6 +48,7 @@ func Error(w http.ResponseWriter, statusCode int, message string, details interf
 			Code:    http.StatusText(statusCode),
 			Details: details,
 		},
+		RequestID: requestID(r),
 		Timestamp: time.Now().Unix(),
 	}
 
@@ -55,3 +60,32 @@ func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(data)
 }
+
+// Wrap builds the envelope for a proxied response. data is the upstream body,
+// e.g. a json.RawMessage; on error statuses it becomes the error details.
+func Wrap(r *http.Request, statusCode int, data interface{}) Response {
+	response := Response{
+		Success:   statusCode < http.StatusBadRequest,
+		Message:   http.StatusText(statusCode),
+		RequestID: requestID(r),
+		Timestamp: time.Now().Unix(),
+	}
+	if response.Success {
+		response.Data = data
+	} else {
+		response.Error = &ErrorInfo{
+			Code:    http.StatusText(statusCode),
+			Details: data,
+		}
+	}
+	return response
+}
+
+// requestID returns the ID the RequestID middleware assigned to r, if any
+func requestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := reqctx.RequestIDFromContext(r.Context())
+	return id
+}